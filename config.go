@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+)
+
+// applyConfigFile sets the flags with the values of a yaml file. The keys
+// are the names of the flags (without --) and the lists are used in the
+// flags that accept multiple values. The flags set in the command line
+// are not changed, so they override the values of the file
+func applyConfigFile(flags *pflag.FlagSet, path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrapf(err, "unexpected error reading the config file %v", path)
+	}
+
+	values := map[string]interface{}{}
+	err = yaml.Unmarshal(b, &values)
+	if err != nil {
+		return errors.Wrapf(err, "unexpected error parsing the config file %v", path)
+	}
+
+	keys := []string{}
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		f := flags.Lookup(key)
+		if f == nil || key == "config" {
+			return fmt.Errorf("invalid option %v in the config file %v", key, path)
+		}
+
+		if f.Changed {
+			continue
+		}
+
+		if _, ok := values[key].([]interface{}); ok && !isListFlag(f) {
+			return fmt.Errorf("invalid option %v in the config file %v (does not accept a list)", key, path)
+		}
+
+		if list, ok := values[key].([]interface{}); ok && len(list) == 0 {
+			// an empty list removes the default values of the flag
+			err := clearListFlag(flags, f)
+			if err != nil {
+				return errors.Wrapf(err, "invalid value [] of the option %v in the config file %v", key, path)
+			}
+			continue
+		}
+
+		for _, value := range configValues(values[key]) {
+			err := flags.Set(key, value)
+			if err != nil {
+				return errors.Wrapf(err, "invalid value %v of the option %v in the config file %v", value, key, path)
+			}
+		}
+	}
+
+	return nil
+}
+
+// configValues returns the value of an option of the config file in the
+// format of the command line (one element for each value of a list)
+func configValues(value interface{}) []string {
+	switch v := value.(type) {
+	case []interface{}:
+		values := []string{}
+		for _, item := range v {
+			values = append(values, configValues(item)...)
+		}
+		return values
+	case float64:
+		// the numbers are decoded as json, 1000000 must not be written as 1e+06
+		return []string{strconv.FormatFloat(v, 'f', -1, 64)}
+	case nil:
+		return []string{""}
+	default:
+		return []string{fmt.Sprint(v)}
+	}
+}
+
+// clearListFlag sets a flag that accepts multiple values to an empty list
+func clearListFlag(flags *pflag.FlagSet, f *pflag.Flag) error {
+	if f.Value.Type() == "stringSlice" {
+		// an empty value is parsed as an empty list
+		return flags.Set(f.Name, "")
+	}
+
+	if f.DefValue == "[]" {
+		return nil
+	}
+	return fmt.Errorf("the option %v does not accept an empty list", f.Name)
+}
+
+// isListFlag returns true if the flag accepts multiple values
+func isListFlag(f *pflag.Flag) bool {
+	t := f.Value.Type()
+	return strings.HasSuffix(t, "Slice") || strings.HasSuffix(t, "Array")
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+// newConfigTestFlags returns a flag set with flags of each kind used by the command
+func newConfigTestFlags() *pflag.FlagSet {
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.String("output", "", "")
+	flags.StringSlice("skip-types", []string{}, "")
+	flags.StringSlice("skip-names", []string{"kubernetes"}, "")
+	flags.StringArray("redact-path", []string{}, "")
+	flags.Int("concurrency", 10, "")
+	flags.Float32("qps", 5, "")
+	flags.Bool("redact-secrets", true, "")
+	flags.String("config", "", "")
+	return flags
+}
+
+// writeConfigTestFile writes a config file and returns its path (the
+// caller must remove it)
+func writeConfigTestFile(t *testing.T, content string) string {
+	f, err := ioutil.TempFile("", "config")
+	if err != nil {
+		t.Fatalf("unexpected error creating the config file: %v", err)
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(content)
+	if err != nil {
+		t.Fatalf("unexpected error writing the config file: %v", err)
+	}
+	return f.Name()
+}
+
+func TestApplyConfigFile(t *testing.T) {
+	path := writeConfigTestFile(t, `
+output: /backups/cluster
+skip-types:
+- secrets
+- events
+concurrency: 20
+qps: 1000000
+redact-secrets: false
+`)
+	defer os.Remove(path)
+
+	flags := newConfigTestFlags()
+	// the flags of the command line override the file
+	err := flags.Parse([]string{"--concurrency=5", "--config=" + path})
+	if err != nil {
+		t.Fatalf("unexpected error parsing the flags: %v", err)
+	}
+
+	err = applyConfigFile(flags, path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	output, _ := flags.GetString("output")
+	skipTypes, _ := flags.GetStringSlice("skip-types")
+	concurrency, _ := flags.GetInt("concurrency")
+	qps, _ := flags.GetFloat32("qps")
+	redact, _ := flags.GetBool("redact-secrets")
+
+	if output != "/backups/cluster" {
+		t.Errorf("expected the output of the file, got %v", output)
+	}
+	if !reflect.DeepEqual(skipTypes, []string{"secrets", "events"}) {
+		t.Errorf("expected the types of the file, got %v", skipTypes)
+	}
+	if concurrency != 5 {
+		t.Errorf("expected the concurrency of the command line, got %v", concurrency)
+	}
+	if qps != 1e6 {
+		t.Errorf("expected the qps of the file, got %v", qps)
+	}
+	if redact {
+		t.Errorf("expected --redact-secrets=false from the file")
+	}
+}
+
+func TestApplyConfigFileInvalid(t *testing.T) {
+	for content, expected := range map[string]string{
+		"unknown: true\n":             "invalid option unknown",
+		"config: other.yaml\n":        "invalid option config",
+		"output:\n- a\n- b\n":         "does not accept a list",
+		"concurrency: many\n":         "invalid value many of the option concurrency",
+		"skip-types: [secrets\n":      "unexpected error parsing the config file",
+		"redact-secrets: sometimes\n": "invalid value sometimes of the option redact-secrets",
+	} {
+		path := writeConfigTestFile(t, content)
+		err := applyConfigFile(newConfigTestFlags(), path)
+		os.Remove(path)
+
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected the error %q for %q, got %v", expected, content, err)
+		}
+	}
+}
+
+func TestApplyConfigFileEmptyList(t *testing.T) {
+	path := writeConfigTestFile(t, "skip-names: []\nredact-path: []\n")
+	defer os.Remove(path)
+
+	flags := newConfigTestFlags()
+	err := applyConfigFile(flags, path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	skipNames, _ := flags.GetStringSlice("skip-names")
+	if len(skipNames) != 0 {
+		t.Errorf("expected the empty list of the file to remove the default names, got %v", skipNames)
+	}
+	redactPaths, _ := flags.GetStringArray("redact-path")
+	if len(redactPaths) != 0 {
+		t.Errorf("expected no redact paths, got %v", redactPaths)
+	}
+
+	f := flags.Lookup("skip-names")
+	if !f.Changed {
+		t.Errorf("expected skip-names to be set by the config file")
+	}
+}
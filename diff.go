@@ -0,0 +1,295 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/golang/glog"
+	"github.com/spf13/pflag"
+
+	"k8s.io/dump/pkg/dump"
+)
+
+// diffSkippedFiles names (without extension) of the files of a dump that
+// do not contain objects of the namespaces or the cluster-scoped types
+var diffSkippedFiles = []string{"_audit-secrets", "kustomization", "_nodes"}
+
+// diffResult counts the objects compared by the diff subcommand
+type diffResult struct {
+	added     int
+	removed   int
+	modified  int
+	unchanged int
+}
+
+func (r diffResult) changed() bool {
+	return r.added+r.removed+r.modified > 0
+}
+
+// runDiff compares the objects of two dumps and prints the objects added,
+// removed and modified (with a unified diff of the yaml of each modified object).
+// It exits with code 1 if the dumps are different
+func runDiff(args []string) {
+	var (
+		flags = pflag.NewFlagSet("diff", pflag.ExitOnError)
+
+		oldDir  = flags.String("old", "", "Directory with the files of the old dump.")
+		newDir  = flags.String("new", "", "Directory with the files of the new dump.")
+		context = flags.Int("context", 3, "Number of unchanged lines shown around the changes of a modified object.")
+	)
+
+	flags.AddGoFlagSet(flag.CommandLine)
+	flags.Parse(args)
+
+	flag.Set("logtostderr", "true")
+
+	if *oldDir == "" || *newDir == "" {
+		glog.Fatalf("the flags --old and --new are required")
+	}
+
+	if *context < 0 {
+		glog.Fatalf("invalid --context %v (must be 0 or greater)", *context)
+	}
+
+	skip := skipFileNames(diffSkippedFiles)
+
+	oldObjects, err := loadDump(*oldDir, skip)
+	if err != nil {
+		glog.Fatalf("unexpected error reading the old dump: %v", err)
+	}
+
+	newObjects, err := loadDump(*newDir, skip)
+	if err != nil {
+		glog.Fatalf("unexpected error reading the new dump: %v", err)
+	}
+
+	result, err := writeDiff(os.Stdout, oldObjects, newObjects, *context)
+	if err != nil {
+		glog.Fatalf("unexpected error comparing the dumps: %v", err)
+	}
+
+	glog.Infof("%v objects added, %v removed, %v modified (%v unchanged)",
+		result.added, result.removed, result.modified, result.unchanged)
+	if result.changed() {
+		os.Exit(1)
+	}
+}
+
+// writeDiff compares the objects of two dumps by kind, namespace and name
+// and writes the differences ordered by the reference of the objects
+func writeDiff(w io.Writer, oldObjects, newObjects []map[string]interface{}, context int) (diffResult, error) {
+	result := diffResult{}
+
+	oldIndex := indexObjects(oldObjects)
+	newIndex := indexObjects(newObjects)
+
+	refs := []string{}
+	for ref := range oldIndex {
+		refs = append(refs, ref)
+	}
+	for ref := range newIndex {
+		if _, ok := oldIndex[ref]; !ok {
+			refs = append(refs, ref)
+		}
+	}
+	sort.Strings(refs)
+
+	for _, ref := range refs {
+		oldObj, inOld := oldIndex[ref]
+		newObj, inNew := newIndex[ref]
+
+		same := false
+		if inOld && inNew {
+			var err error
+			same, err = sameObject(oldObj, newObj)
+			if err != nil {
+				return result, err
+			}
+		}
+
+		switch {
+		case !inOld:
+			result.added++
+			fmt.Fprintf(w, "added %v\n", ref)
+		case !inNew:
+			result.removed++
+			fmt.Fprintf(w, "removed %v\n", ref)
+		case same:
+			result.unchanged++
+		default:
+			result.modified++
+			fmt.Fprintf(w, "modified %v\n", ref)
+
+			oldLines, err := yamlLines(oldObj)
+			if err != nil {
+				return result, err
+			}
+			newLines, err := yamlLines(newObj)
+			if err != nil {
+				return result, err
+			}
+
+			fmt.Fprintf(w, "--- a/%v\n+++ b/%v\n", ref, ref)
+			writeUnifiedDiff(w, oldLines, newLines, context)
+		}
+	}
+
+	return result, nil
+}
+
+// sameObject returns true if two objects are equal once decoded in their Go
+// type with the defaults applied (see dump.NormalizeObject), so the fields
+// written only in one of the dumps with their default value are not changes
+func sameObject(a, b map[string]interface{}) (bool, error) {
+	a, err := dump.NormalizeObject(a)
+	if err != nil {
+		return false, err
+	}
+	b, err = dump.NormalizeObject(b)
+	if err != nil {
+		return false, err
+	}
+	return reflect.DeepEqual(a, b), nil
+}
+
+// indexObjects returns the objects of a dump by reference. The documents
+// without kind (like the summary of the dump) are ignored
+func indexObjects(objects []map[string]interface{}) map[string]map[string]interface{} {
+	index := map[string]map[string]interface{}{}
+	for _, obj := range objects {
+		ref := dump.ReferenceFor(obj)
+		if ref.Kind == "" {
+			continue
+		}
+		index[ref.String()] = obj
+	}
+	return index
+}
+
+// yamlLines returns the lines of the yaml representation of an object
+// (the fields are sorted, so the order of the fields in the files does not matter)
+func yamlLines(obj map[string]interface{}) ([]string, error) {
+	raw, err := yaml.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(strings.TrimSuffix(string(raw), "\n"), "\n"), nil
+}
+
+// diffLine is a line of a diff: ' ' unchanged, '-' removed or '+' added
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// diffLines returns the changes to transform a in b using the longest common subsequence
+func diffLines(a, b []string) []diffLine {
+	// lcs[i][j] length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	lines := []diffLine{}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, diffLine{' ', a[i]})
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] > lcs[i+1][j]):
+			lines = append(lines, diffLine{'+', b[j]})
+			j++
+		default:
+			lines = append(lines, diffLine{'-', a[i]})
+			i++
+		}
+	}
+	return lines
+}
+
+// writeUnifiedDiff writes the changes between a and b in the unified format,
+// with context unchanged lines around each group of changes
+func writeUnifiedDiff(w io.Writer, a, b []string, context int) {
+	lines := diffLines(a, b)
+
+	for start := 0; start < len(lines); {
+		if lines[start].op == ' ' {
+			start++
+			continue
+		}
+
+		// the hunk includes the following changes separated by
+		// less than 2*context unchanged lines
+		end := start
+		for end < len(lines) {
+			if lines[end].op != ' ' {
+				end++
+				continue
+			}
+
+			next := end
+			for next < len(lines) && lines[next].op == ' ' {
+				next++
+			}
+			if next == len(lines) || next-end > 2*context {
+				break
+			}
+			end = next
+		}
+
+		from := start - context
+		if from < 0 {
+			from = 0
+		}
+		to := end + context
+		if to > len(lines) {
+			to = len(lines)
+		}
+
+		// line numbers (starting at 1) of the hunk in a and b
+		oldStart, newStart := 1, 1
+		for _, line := range lines[:from] {
+			if line.op != '+' {
+				oldStart++
+			}
+			if line.op != '-' {
+				newStart++
+			}
+		}
+		oldCount, newCount := 0, 0
+		for _, line := range lines[from:to] {
+			if line.op != '+' {
+				oldCount++
+			}
+			if line.op != '-' {
+				newCount++
+			}
+		}
+
+		fmt.Fprintf(w, "@@ -%v,%v +%v,%v @@\n", oldStart, oldCount, newStart, newCount)
+		for _, line := range lines[from:to] {
+			fmt.Fprintf(w, "%c%v\n", line.op, line.text)
+		}
+
+		start = to
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+// newDiffDeployment returns a deployment as it is decoded from a dump file
+func newDiffDeployment(spec map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"apiVersion": "extensions/v1beta1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "nginx", "namespace": "web"},
+		"spec":       spec,
+	}
+}
+
+// newDiffService returns a service with a port as it is decoded from a dump file
+func newDiffService(port map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Service",
+		"metadata":   map[string]interface{}{"name": "nginx", "namespace": "web"},
+		"spec":       map[string]interface{}{"ports": []interface{}{port}},
+	}
+}
+
+func TestWriteDiffDefaults(t *testing.T) {
+	oldObjects := []map[string]interface{}{
+		newDiffDeployment(map[string]interface{}{}),
+		newDiffService(map[string]interface{}{"port": 80.0}),
+	}
+	// the same objects with the fields set to the default values
+	newObjects := []map[string]interface{}{
+		newDiffDeployment(map[string]interface{}{"replicas": 1.0}),
+		newDiffService(map[string]interface{}{"port": 80.0, "protocol": "TCP"}),
+	}
+
+	out := new(bytes.Buffer)
+	result, err := writeDiff(out, oldObjects, newObjects, 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.changed() || result.unchanged != 2 {
+		t.Errorf("expected the objects to be unchanged, got %+v\n%v", result, out.String())
+	}
+}
+
+func TestWriteDiffModified(t *testing.T) {
+	oldObjects := []map[string]interface{}{
+		newDiffDeployment(map[string]interface{}{}),
+		newDiffService(map[string]interface{}{"port": 80.0}),
+	}
+	newObjects := []map[string]interface{}{
+		newDiffDeployment(map[string]interface{}{"replicas": 2.0}),
+		newDiffService(map[string]interface{}{"port": 80.0, "protocol": "UDP"}),
+	}
+
+	out := new(bytes.Buffer)
+	result, err := writeDiff(out, oldObjects, newObjects, 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.modified != 2 {
+		t.Fatalf("expected 2 objects modified, got %+v", result)
+	}
+	for _, line := range []string{"+  replicas: 2", "+    protocol: UDP"} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("expected the line %q in the diff, got\n%v", line, out.String())
+		}
+	}
+}
+
+func TestLoadDumpDiffSkippedFiles(t *testing.T) {
+	dir := writeDumpTestFiles(t, map[string]string{
+		"_nodes.yaml":         "apiVersion: v1\nkind: Node\nmetadata:\n  name: node-1\n",
+		"_audit-secrets.yaml": "apiVersion: v1\nkind: Secret\nmetadata:\n  name: dns-token\n  namespace: kube-system\n",
+		// the files of the namespaces named nodes and audit-secrets
+		"nodes.yaml":         "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: nodes\n",
+		"audit-secrets.yaml": "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: audit-secrets\n",
+	})
+	defer os.RemoveAll(dir)
+
+	objects, err := loadDump(dir, skipFileNames(diffSkippedFiles))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{"Namespace/audit-secrets", "Namespace/nodes"}
+	if names := objectNames(objects); strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected the objects %v, got %v", expected, names)
+	}
+}
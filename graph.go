@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+
+	"k8s.io/dump/pkg/dump"
+	k8s_yaml "k8s.io/kubernetes/pkg/util/yaml"
+)
+
+// runGraph parses the files of a dump and creates a graphviz (DOT) file
+// showing the references between the objects
+func runGraph(args []string) {
+	var (
+		flags = pflag.NewFlagSet("graph", pflag.ExitOnError)
+
+		input  = flags.String("input", "", "Directory with the dump files.")
+		output = flags.String("output", "", "Path of the DOT file to create. If not specified the graph is written to stdout.")
+	)
+
+	flags.AddGoFlagSet(flag.CommandLine)
+	flags.Parse(args)
+
+	flag.Set("logtostderr", "true")
+
+	if *input == "" {
+		glog.Fatalf("the flag --input is required")
+	}
+
+	objects, err := loadDump(*input, nil)
+	if err != nil {
+		glog.Fatalf("unexpected error reading the dump: %v", err)
+	}
+
+	w := os.Stdout
+	if *output != "" {
+		w, err = os.Create(*output)
+		if err != nil {
+			glog.Fatalf("unexpected error creating the graph file: %v", err)
+		}
+		defer w.Close()
+	}
+
+	err = writeGraph(w, objects)
+	if err != nil {
+		glog.Fatalf("unexpected error writing the graph: %v", err)
+	}
+}
+
+// skipFileNames returns a function for loadDump that skips the files
+// with one of the names (without extension)
+func skipFileNames(names []string) func(path string) bool {
+	return func(path string) bool {
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		for _, skipped := range names {
+			if name == skipped {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// loadDump reads all the yaml and json files located in a directory (including
+// subdirectories) and returns the decoded objects. The items of the json lists
+// are returned as individual objects. The files for which skip returns true are not read
+func loadDump(dir string, skip func(path string) bool) ([]map[string]interface{}, error) {
+	objects := []map[string]interface{}{}
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !(strings.HasSuffix(path, ".yaml") || strings.HasSuffix(path, ".yml") || strings.HasSuffix(path, ".json")) {
+			return nil
+		}
+
+		if skip != nil && skip(path) {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		reader := k8s_yaml.NewYAMLReader(bufio.NewReader(f))
+		for {
+			doc, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return errors.Wrapf(err, "unexpected error reading %v", path)
+			}
+
+			raw, err := yaml.YAMLToJSON(bytes.TrimPrefix(doc, dump.UTF8BOM))
+			if err != nil {
+				return errors.Wrapf(err, "unexpected error decoding %v", path)
+			}
+
+			var obj map[string]interface{}
+			err = json.Unmarshal(raw, &obj)
+			if err != nil {
+				return errors.Wrapf(err, "unexpected error decoding %v", path)
+			}
+
+			// documents with only comments
+			kind, _ := obj["kind"].(string)
+			if kind == "" {
+				continue
+			}
+
+			if kind == "List" {
+				items, _ := obj["items"].([]interface{})
+				for _, item := range items {
+					if item, ok := item.(map[string]interface{}); ok {
+						objects = append(objects, item)
+					}
+				}
+				continue
+			}
+
+			objects = append(objects, obj)
+		}
+
+		return nil
+	})
+
+	return objects, err
+}
+
+// writeGraph writes the objects and the references between them in DOT format.
+// Referenced objects that are not present in the dump are drawn with a dashed line
+func writeGraph(w io.Writer, objects []map[string]interface{}) error {
+	present := map[string]bool{}
+	edges := map[string][]string{}
+
+	for _, obj := range objects {
+		from := dump.ReferenceFor(obj).String()
+		present[from] = true
+		for _, ref := range dump.ExtractReferences(obj) {
+			edges[from] = append(edges[from], ref.String())
+		}
+	}
+
+	nodes := []string{}
+	for node := range present {
+		nodes = append(nodes, node)
+	}
+	for _, targets := range edges {
+		for _, target := range targets {
+			if !present[target] {
+				present[target] = false
+				nodes = append(nodes, target)
+			}
+		}
+	}
+	sort.Strings(nodes)
+
+	buf := new(bytes.Buffer)
+	buf.WriteString("digraph dump {\n")
+	buf.WriteString("  rankdir=LR;\n")
+	buf.WriteString("  node [shape=box];\n")
+	for _, node := range nodes {
+		if !present[node] {
+			buf.WriteString(fmt.Sprintf("  %q [style=dashed];\n", node))
+			continue
+		}
+		buf.WriteString(fmt.Sprintf("  %q;\n", node))
+	}
+
+	sources := []string{}
+	for from := range edges {
+		sources = append(sources, from)
+	}
+	sort.Strings(sources)
+
+	for _, from := range sources {
+		targets := edges[from]
+		sort.Strings(targets)
+		for _, to := range targets {
+			buf.WriteString(fmt.Sprintf("  %q -> %q;\n", from, to))
+		}
+	}
+	buf.WriteString("}\n")
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestWriteGraph(t *testing.T) {
+	dir := writeDumpTestFiles(t, map[string]string{
+		// the byte order mark written with --bom
+		"web.yaml": "\xEF\xBB\xBF" + `# configmaps
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+  namespace: web
+---
+# deployments
+apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: nginx
+  namespace: web
+spec:
+  template:
+    spec:
+      containers:
+      - name: nginx
+        envFrom:
+        - configMapRef:
+            name: settings
+        - secretRef:
+            name: token
+`,
+		"_cluster.json": `{"kind":"List","items":[{"apiVersion":"v1","kind":"PersistentVolume","metadata":{"name":"data"}}]}`,
+	})
+	defer os.RemoveAll(dir)
+
+	objects, err := loadDump(dir, nil)
+	if err != nil {
+		t.Fatalf("unexpected error reading the dump: %v", err)
+	}
+
+	out := &bytes.Buffer{}
+	err = writeGraph(out, objects)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the secret is not in the dump
+	expected := `digraph dump {
+  rankdir=LR;
+  node [shape=box];
+  "ConfigMap/web/settings";
+  "Deployment/web/nginx";
+  "PersistentVolume/data";
+  "Secret/web/token" [style=dashed];
+  "Deployment/web/nginx" -> "ConfigMap/web/settings";
+  "Deployment/web/nginx" -> "Secret/web/token";
+}
+`
+	if out.String() != expected {
+		t.Errorf("expected the graph\n%v\ngot\n%v", expected, out.String())
+	}
+}
@@ -1,37 +1,48 @@
 package main
 
 import (
-	"bytes"
 	"flag"
 	"fmt"
-	"io/ioutil"
+	"net/http"
 	"os"
-	"regexp"
+	"os/signal"
+	"sort"
+	"strconv"
 	"strings"
-	"sync"
-	text_template "text/template"
+	"syscall"
+	"time"
 
 	"github.com/golang/glog"
-	"github.com/pkg/errors"
 	"github.com/spf13/pflag"
 
-	unversioned_api "k8s.io/kubernetes/pkg/api"
-	k8s_errors "k8s.io/kubernetes/pkg/api/errors"
-	api "k8s.io/kubernetes/pkg/api/v1"
-	apps "k8s.io/kubernetes/pkg/apis/apps/v1beta1"
-	autoscalingapiv1 "k8s.io/kubernetes/pkg/apis/autoscaling/v1"
-	batch "k8s.io/kubernetes/pkg/apis/batch/v2alpha1"
-	extensions "k8s.io/kubernetes/pkg/apis/extensions/v1beta1"
-	storage "k8s.io/kubernetes/pkg/apis/storage/v1beta1"
 	client "k8s.io/kubernetes/pkg/client/clientset_generated/release_1_5"
-	restclient "k8s.io/kubernetes/pkg/client/restclient"
 	"k8s.io/kubernetes/pkg/client/unversioned/clientcmd"
 	clientcmdapi "k8s.io/kubernetes/pkg/client/unversioned/clientcmd/api"
-	"k8s.io/kubernetes/pkg/conversion"
-	"k8s.io/kubernetes/pkg/runtime"
+
+	"k8s.io/dump/pkg/dump"
 )
 
+// version of the tool. Set at build time using -ldflags "-X main.version=<version>"
+var version = "dev"
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "graph" {
+		runGraph(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "restore" {
+		runRestore(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "diff" {
+		runDiff(os.Args[2:])
+		return
+	}
+
+	defaults := dump.NewOptions()
+
 	var (
 		flags = pflag.NewFlagSet("", pflag.ExitOnError)
 
@@ -40,23 +51,282 @@ func main() {
 			"http://localhost:8080. If not specified, the assumption is that the binary runs inside a "+
 			"Kubernetes cluster and local discovery is attempted.")
 		kubeConfigFile = flags.String("kubeconfig", "", "Path to kubeconfig file with authorization and master location information.")
-		skipTypes      = flags.StringSlice("skip-types", []string{"serviceaccount"}, "Types to skip in the dump. ")
-		output         = flags.String("output", "", "Directory where the dump files should be created.")
+		skipTypes      = flags.StringSlice("skip-types", defaults.SkipTypes, "Types to skip in the dump (plural, singular or short names, e.g. svc). ")
+		includeTypes   = flags.StringSlice("include-types", []string{}, "Only dump these types (--skip-types is applied on top).")
+		output         = flags.String("output", "", "Directory where the dump files should be created (- writes the dump to the standard output).")
 		namespace      = flags.String("namespace", "", "Only dump the contents of a particular namespace.")
-		skipNames      = flags.StringSlice("skip-names", []string{"kubernetes"}, "Skip objects that fulfill the regex.")
+		namespaces     = flags.StringSlice("namespaces", []string{}, "Only dump the contents of these namespaces (comma separated). "+
+			"The namespaces that do not exist are skipped.")
+		skipNames         = flags.StringSlice("skip-names", defaults.SkipNames, "Skip the namespaced objects with a name that fulfill the regex (the nodes and the cluster objects are not filtered).")
+		excludeAnnotation = flags.String("exclude-annotation", "", "Skip objects with the annotation, in the format key=value "+
+			"(or only the key to skip the objects with the annotation regardless of the value).")
+		redactPaths = flags.StringArray("redact-path", []string{}, "Replace the values matched by a JSONPath expression "+
+			"in objects of a particular kind with <redacted>, in the format <Kind>:<JSONPath>, e.g. Secret:.data.* "+
+			"(can be specified multiple times).")
+		redactSecrets = flags.Bool("redact-secrets", defaults.RedactSecrets, "Replace the values of the data of the secrets with <redacted>, "+
+			"keeping the keys and the type.")
+		maxObjectSize = flags.Int("max-object-size", defaults.MaxObjectSize, "Warn about objects bigger than this size in bytes, "+
+			"which will fail to be restored because they exceed the apiserver request size limit (0 disables the check).")
+		onlyUserNamespaces      = flags.Bool("only-user-namespaces", false, "Skip the system namespaces (see --system-namespace-prefix).")
+		systemNamespacePrefixes = flags.StringSlice("system-namespace-prefix", defaults.SystemNamespacePrefixes,
+			"Prefixes of the names of the system namespaces skipped by --only-user-namespaces.")
+		dumpNodeInfo = flags.Bool("dump-node-info", false, "Dump the nodes of the cluster (labels, taints, capacity and "+
+			"kubelet version) in the file _nodes.yaml.")
+		stripStatus     = flags.Bool("strip-status", false, "Remove volatile status information (like node conditions and allocatable resources).")
+		maxItemsPerType = flags.Int("max-items-per-type", 0, "Skip the types with more items than this value in a namespace (0 means unlimited).")
+		lineEndings     = flags.String("line-endings", defaults.LineEndings, "Line endings used in the dump files (lf or crlf).")
+		bom             = flags.Bool("bom", false, "Write a UTF-8 byte order mark at the beginning of the dump files.")
+		keepStatusFor   = flags.StringSlice("keep-status-for", []string{}, "Kinds that should keep the status section "+
+			"that is removed by default (e.g. Ingress,Service).")
+		includeSystemSecretsMetadata = flags.Bool("include-system-secrets-metadata", false, "List the name, type and "+
+			"creation time of the secrets located in the skipped namespaces in the file _audit-secrets.yaml.")
+		gitopsLayout = flags.Bool("gitops-layout", false, "Create a directory per namespace containing the Namespace object, "+
+			"one file per type and a kustomization.yaml file instead of a single file per namespace.")
+		stripContainerNames = flags.StringSlice("strip-container-name", []string{}, "Remove the containers and init containers "+
+			"with a name matching one of the patterns (e.g. istio-*) from the pod templates.")
+		outputHashNames = flags.Bool("output-hash-names", false, "Name the namespace files using the SHA256 of the content "+
+			"and create the file index.json mapping each namespace to its file.")
+		failOnEmpty = flags.Bool("fail-on-empty", false, fmt.Sprintf("Exit with code %v if there is no namespace to dump.", emptyClusterExitCode))
+		preflight   = flags.Bool("preflight", false, "Check which types can be listed in each namespace before the dump "+
+			"and log the allowed and denied types.")
+		partialWrites = flags.Bool("partial-writes", defaults.PartialWrites, "Write the namespace file with the types that succeeded when "+
+			"a type cannot be queried (the error is recorded in the file). If false the namespace is not dumped.")
+		sortBy      = flags.String("sort-by", defaults.SortBy, "Order of the objects of each type (name or created).")
+		userAgent   = flags.String("user-agent", fmt.Sprintf("k8s-dump/%v (namespace dump)", version), "User-Agent used in the requests to the apiserver.")
+		kubeContext = flags.String("context", "", "Name of the kubeconfig context to use (the current context if not specified).")
+		timeout     = flags.Duration("timeout", defaults.RequestTimeout, "Maximum time for each list or get request to the apiserver (0 means no limit). "+
+			"The requests that time out are retried and recorded as errors of the type. The log streams of --collect-logs are not limited.")
+		qps               = flags.Float32("qps", defaultQPS, "Maximum queries per second to the apiserver (0 uses the client default of 5).")
+		burst             = flags.Int("burst", defaultBurst, "Maximum burst of queries to the apiserver (0 uses the client default of 10).")
+		documentSeparator = flags.String("document-separator", defaults.DocumentSeparator, "Separator between the yaml documents. Must start with ---, "+
+			"e.g. '--- # next'.")
+		leadingSeparator        = flags.Bool("leading-separator", false, "Write the document separator before every document, including the first one.")
+		annotateResourceVersion = flags.Bool("annotate-resource-version", false, "Write the resourceVersion of each object "+
+			"in a comment at the beginning of the document.")
+		collectLogs          = flags.Bool("collect-logs", false, "Write the logs of the containers to <output>/<namespace>/logs/<pod>-<container>.log.")
+		logTailLines         = flags.Int64("log-tail-lines", defaults.LogTailLines, "Number of lines of the logs of each container to collect (0 collects the whole log).")
+		logsIncludeCompleted = flags.Bool("logs-include-completed", false, "Collect the logs of completed (succeeded, failed or evicted) pods.")
+		transformExec        = flags.String("transform-exec", "", "Command (executed using sh -c) that receives each object "+
+			"in stdin and writes the transformed object to stdout. Objects are not dumped if the command fails "+
+			"(the error is reported in the header of the file and the dump fails).")
+		skipDefaultTokens = flags.Bool("skip-default-tokens", defaults.SkipDefaultTokens, "Remove the references to the generated token secrets "+
+			"from the service accounts, so the tokens are recreated after a restore.")
+		pvReclaimPolicy    = flags.String("pv-reclaim-policy", "", "Replace the reclaim policy of the persistent volumes (Retain, Delete or Recycle).")
+		pvClearCloudSource = flags.Bool("pv-clear-cloud-source", false, "Remove the sources specific to a cloud provider "+
+			"(e.g. gcePersistentDisk, awsElasticBlockStore) from the persistent volumes.")
+		stripFieldsFile = flags.String("strip-fields-file", "", "File with the paths of the fields to remove from the objects, "+
+			"one per line (e.g. metadata.annotations.deployment\\.kubernetes\\.io/revision).")
+		replaceImagePullSecrets = flags.String("replace-image-pull-secrets", "", "Replace the image pull secrets of the "+
+			"pod templates and service accounts with this secret.")
+		clearImagePullSecrets = flags.Bool("clear-image-pull-secrets", false, "Remove the image pull secrets of the pod templates "+
+			"and service accounts.")
+		maxTotalSize = flags.Int64("max-total-size", 0, "Stop dumping namespaces once the files written exceed this "+
+			"size in bytes (0 means unlimited). The namespaces already dumped are kept.")
+		perObjectFiles = flags.Bool("per-object-files", false, "Create a directory per namespace containing the Namespace "+
+			"object and one file per object in <kind>/<name>.yaml instead of a single file per namespace.")
+		includePods     = flags.Bool("include-pods", defaults.IncludePods, "Dump the pods (use false to dump only the controllers that manage them).")
+		concurrency     = flags.Int("concurrency", defaults.Concurrency, "Number of namespaces dumped at the same time.")
+		typeConcurrency = flags.Int("type-concurrency", defaults.TypeConcurrency, "Number of types of a namespace listed at the same time "+
+			"(the list requests in flight are limited by --concurrency).")
+		outputFormat   = flags.String("output-format", defaults.OutputFormat, "Format of the dump files (yaml or json).")
+		logFormat      = flags.String("log-format", "text", "Format of the messages of the dump (text or json, one object per line in stderr).")
+		listOutputPlan = flags.Bool("list-output-plan", false, "Print the paths of the files that would be written "+
+			"with the selected layout and exit without dumping the namespaces.")
+		fileMode = flags.String("file-mode", fmt.Sprintf("%#o", defaults.FileMode), "Mode of the files written (in octal).")
+		secure   = flags.Bool("secure", false, "Write the files with the mode 0600 and the output directory with 0700 "+
+			"(--file-mode is ignored).")
+		listOnly = flags.Bool("list-only", false, "List the objects and print the number of objects of each type by namespace "+
+			"without writing any file.")
+		progress = flags.Bool("progress", false, "Write a line with the number of namespaces completed and the elapsed time "+
+			"to stderr during the dump.")
+		failIfExists = flags.Bool("fail-if-exists", false, "Fail without writing any file if a file of the dump already exists "+
+			"in the output directory (or the archive exists).")
+		overwrite      = flags.Bool("overwrite", true, "Replace the files of a previous dump (--overwrite=false is the same as --fail-if-exists).")
+		withReferences = flags.Bool("with-references", false, "Also dump the services, endpoints and TLS secrets of the ingresses "+
+			"and the configmaps, secrets and volume claims used by the deployments, even if the types are skipped or the objects do not match the selectors.")
+		insecureSkipTLSVerify = flags.Bool("insecure-skip-tls-verify", false, "Do not verify the certificate of the apiserver. "+
+			"This makes the connection insecure.")
+		token     = flags.String("token", "", "Bearer token used to authenticate with the apiserver (replaces the credentials of the kubeconfig).")
+		tokenFile = flags.String("token-file", "", "File with the bearer token used to authenticate with the apiserver, read again "+
+			"when it changes (e.g. a projected service account token).")
+		certificateAuthority = flags.String("certificate-authority", "", "Path to a certificate file for the certificate authority "+
+			"used to verify the apiserver (replaces the one of the kubeconfig).")
+		minimal = flags.Bool("minimal", false, "Clear the fields assigned by the apiserver (cluster IPs and node ports of the services, "+
+			"generated service account tokens and empty strings) so the objects can be applied to a new cluster.")
+		discoverCRDs = flags.Bool("discover-crds", false, "Dump the namespaced custom resources found using the API discovery "+
+			"(the groups that are not served by the apiserver itself).")
+		decodeValues = flags.Bool("decode-values", false, "Add a comment after each secret with the decoded values of the data "+
+			"(values that are not text are shown as <binary N bytes>). Requires --redact-secrets=false.")
+		includeEvents = flags.Bool("include-events", false, "Dump the events.")
+		eventsSince   = flags.Duration("events-since", 0, "Only dump the events that occurred in this period (e.g. 1h). 0 dumps all the events.")
+		keepStatus    = flags.Bool("keep-status", false, "Keep the status section of all the kinds (by default it is removed from ingresses, pods and services).")
+		verify        = flags.Bool("verify", false, "Check the files of the dump located in --output against the manifest _manifest.sha256 and exit.")
+		skipOwned     = flags.Bool("skip-owned", false, "Skip the objects managed by a controller (e.g. the replica sets and pods of a deployment).")
+		fieldSelector = flags.String("field-selector", "", "Only dump the objects matching this field selector (e.g. spec.type=LoadBalancer). "+
+			"The types that do not support the fields are recorded as errors.")
+		selector         = flags.String("selector", "", "Only dump the objects matching this label selector (e.g. app=nginx,tier=frontend).")
+		transformTimeout = flags.Duration("transform-timeout", defaults.TransformTimeout, "Maximum time for each invocation of --transform-exec.")
+		maxRetries       = flags.Int("max-retries", defaults.MaxRetries, "Number of times a list call is retried after a transient error "+
+			"(timeouts, throttling, 5xx responses and connection resets). 0 disables the retries.")
+		includeNamespaces = flags.StringSlice("include-namespaces", []string{}, "Only dump the namespaces matching one of these regular expressions "+
+			"(ignored when --namespace or --namespaces are set).")
+		excludeNamespaces = flags.StringSlice("exclude-namespaces", []string{}, "Regular expressions of the namespaces that are not dumped, "+
+			"applied after --include-namespaces (ignored when --namespace or --namespaces are set).")
+		outputLayout = flags.String("output-layout", defaults.OutputLayout, "Layout of the files: flat (one file per namespace) or tree "+
+			"(one file per object in <namespace>/<type>/<name>.yaml and <cluster-scoped type>/<name>.yaml in the directory _cluster).")
+		archive = flags.String("archive", "", "Path of a tar archive compressed with gzip (.tar.gz or .tgz) where the files "+
+			"are written instead of the --output directory.")
+		compressLevel = flags.Int("compress-level", defaults.CompressLevel, "Gzip compression level of the --archive, "+
+			"from 0 (no compression) to 9 (best compression).")
+		templateFile = flags.String("template-file", "", "File with the template of the namespace files used instead of the built-in one "+
+			"(the data contains name, namespace, notFound and types, objectToYaml renders an object).")
+		retryInterval = flags.Duration("retry-interval", defaults.RetryInterval, "Wait before the first retry, doubled after each attempt (with jitter).")
+		configFile    = flags.String("config", "", "YAML file with the values of the options (the keys are the names of the flags). "+
+			"The flags of the command line override the values of the file.")
 	)
 
 	flags.AddGoFlagSet(flag.CommandLine)
 	flags.Parse(os.Args)
 
+	if *configFile != "" {
+		err := applyConfigFile(flags, *configFile)
+		if err != nil {
+			glog.Fatalf("%v", err)
+		}
+	}
+
 	flag.Set("logtostderr", "true")
 
-	kubeClient, err := createApiserverClient(*apiserverHost, *kubeConfigFile)
+	logger, err := dump.NewLogger(*logFormat, os.Stderr)
+	if err != nil {
+		glog.Fatalf("%v", err)
+	}
+
+	if *verify {
+		runVerify(*output)
+		return
+	}
+
+	if *failIfExists && *overwrite && flags.Changed("overwrite") {
+		glog.Fatalf("--fail-if-exists cannot be used with --overwrite")
+	}
+
+	mode, err := strconv.ParseUint(*fileMode, 8, 32)
+	if err != nil {
+		glog.Fatalf("invalid --file-mode %v (must be an octal number, e.g. 0640)", *fileMode)
+	}
+
+	opts := dump.Options{
+		Output:                       *output,
+		Namespace:                    *namespace,
+		Namespaces:                   *namespaces,
+		SkipNames:                    *skipNames,
+		ExcludeAnnotation:            *excludeAnnotation,
+		SkipTypes:                    *skipTypes,
+		IncludeTypes:                 *includeTypes,
+		IncludePods:                  *includePods,
+		RedactPaths:                  *redactPaths,
+		RedactSecrets:                *redactSecrets,
+		MaxObjectSize:                *maxObjectSize,
+		OnlyUserNamespaces:           *onlyUserNamespaces,
+		SystemNamespacePrefixes:      *systemNamespacePrefixes,
+		DumpNodeInfo:                 *dumpNodeInfo,
+		StripStatus:                  *stripStatus,
+		MaxItemsPerType:              *maxItemsPerType,
+		LineEndings:                  *lineEndings,
+		BOM:                          *bom,
+		KeepStatusFor:                *keepStatusFor,
+		IncludeSystemSecretsMetadata: *includeSystemSecretsMetadata,
+		GitOpsLayout:                 *gitopsLayout,
+		PerObjectFiles:               *perObjectFiles,
+		OutputHashNames:              *outputHashNames,
+		StripContainerNames:          *stripContainerNames,
+		Preflight:                    *preflight,
+		PartialWrites:                *partialWrites,
+		SortBy:                       *sortBy,
+		DocumentSeparator:            *documentSeparator,
+		LeadingSeparator:             *leadingSeparator,
+		AnnotateResourceVersion:      *annotateResourceVersion,
+		CollectLogs:                  *collectLogs,
+		LogTailLines:                 *logTailLines,
+		LogsIncludeCompleted:         *logsIncludeCompleted,
+		TransformExec:                *transformExec,
+		TransformTimeout:             *transformTimeout,
+		SkipDefaultTokens:            *skipDefaultTokens,
+		PVReclaimPolicy:              *pvReclaimPolicy,
+		PVClearCloudSource:           *pvClearCloudSource,
+		StripFieldsFile:              *stripFieldsFile,
+		ReplaceImagePullSecrets:      *replaceImagePullSecrets,
+		ClearImagePullSecrets:        *clearImagePullSecrets,
+		ListOutputPlan:               *listOutputPlan,
+		ListOnly:                     *listOnly,
+		Progress:                     *progress,
+		WithReferences:               *withReferences,
+		FailIfExists:                 *failIfExists || !*overwrite,
+		FileMode:                     os.FileMode(mode),
+		Secure:                       *secure,
+		MaxTotalSize:                 *maxTotalSize,
+		OutputFormat:                 *outputFormat,
+		Concurrency:                  *concurrency,
+		TypeConcurrency:              *typeConcurrency,
+		Selector:                     *selector,
+		FieldSelector:                *fieldSelector,
+		SkipOwned:                    *skipOwned,
+		KeepStatus:                   *keepStatus,
+		IncludeEvents:                *includeEvents,
+		DecodeValues:                 *decodeValues,
+		DiscoverCRDs:                 *discoverCRDs,
+		Minimal:                      *minimal,
+		EventsSince:                  *eventsSince,
+		MaxRetries:                   *maxRetries,
+		RetryInterval:                *retryInterval,
+		RequestTimeout:               *timeout,
+		IncludeNamespaces:            *includeNamespaces,
+		ExcludeNamespaces:            *excludeNamespaces,
+		TemplateFile:                 *templateFile,
+		OutputLayout:                 *outputLayout,
+		Archive:                      *archive,
+		CompressLevel:                *compressLevel,
+		Logger:                       logger,
+	}
+
+	err = opts.Validate()
+	if err != nil {
+		glog.Fatalf("%v", err)
+	}
+
+	if *qps < 0 || *burst < 0 {
+		glog.Fatalf("invalid --qps %v or --burst %v (must be 0 or greater)", *qps, *burst)
+	}
+
+	err = validateContext(*kubeConfigFile, *kubeContext)
+	if err != nil {
+		glog.Fatalf("%v", err)
+	}
+
+	kubeClient, err := createApiserverClient(apiserverConfig{
+		host:        *apiserverHost,
+		kubeConfig:  *kubeConfigFile,
+		kubeContext: *kubeContext,
+		userAgent:   *userAgent,
+		qps:         *qps,
+		burst:       *burst,
+		insecure:    *insecureSkipTLSVerify,
+		caFile:      *certificateAuthority,
+		token:       *token,
+		tokenFile:   *tokenFile,
+	})
 	if err != nil {
 		handleFatalInitError(err)
 	}
 
-	dumpCluster(kubeClient, *output, *namespace, *skipNames, *skipTypes)
+	opts.Interrupt = interruptOnSignal(logger)
+	result, err := dump.DumpCluster(kubeClient, opts)
+	if err != nil {
+		glog.Fatalf("%v", err)
+	}
+	result.Log()
+	finishDump(result, *failOnEmpty, logger)
 }
 
 const (
@@ -66,356 +336,213 @@ const (
 	// High enough Burst to fit all expected use cases. Burst=0 is not set here, because
 	// client code is overriding it.
 	defaultBurst = 1e6
+	// defaultTimeout maximum time for each request of the restore to the apiserver
+	defaultTimeout = 30 * time.Second
 
-	template = `
-# errors:
-{{ range $i, $v := .notFound }}
-# {{ $v }}{{ end }}
-
-# namespace
-apiVersion: v1
-kind: Namespace
-metadata:
-  name: {{ .name }}
-
----
-
-{{ template "iterate" . }}
-
-{{ define "iterate" }}
-{{ range $k, $v := .types }}
-{{- if ne (len $v.Runtime.Items) 0 }}
-# {{ $k }}
-{{ range $item := $v.Runtime.Items }}
-{{ objectToYaml $v.Kind $v.APIVersion $item }}
-
----
-{{ end }}
-{{ end }}
-{{- end }}
-{{ end }}
-`
+	// failedDumpExitCode exit code used when a namespace or type could not be dumped
+	failedDumpExitCode = 1
+	// emptyClusterExitCode exit code used when --fail-on-empty is set and there is no namespace to dump
+	emptyClusterExitCode = 2
 )
 
+// exit terminates the command with a code (replaced in the tests)
+var exit = os.Exit
+
+// interruptOnSignal returns a channel closed when the command receives
+// SIGINT or SIGTERM. The dump completes the namespaces in progress and writes
+// the summary; a second signal terminates the command
+func interruptOnSignal(logger *dump.Logger) <-chan struct{} {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	interrupt := make(chan struct{})
+	go func() {
+		<-signals
+		signal.Stop(signals)
+		logger.Warningf("", "", "interrupted, completing the namespaces in progress")
+		close(interrupt)
+	}()
+	return interrupt
+}
+
+// finishDump exits with failedDumpExitCode if any namespace or type could
+// not be dumped (the types without objects are not failures) and with
+// emptyClusterExitCode if failOnEmpty is set and no namespace was dumped.
+// Otherwise it logs that the dump is done and returns
+func finishDump(result *dump.DumpResult, failOnEmpty bool, logger *dump.Logger) {
+	if err := result.Err(); err != nil {
+		logger.Errorf("", "", "%v", err)
+		exit(failedDumpExitCode)
+		return
+	}
+
+	if result.Empty() && failOnEmpty {
+		exit(emptyClusterExitCode)
+		return
+	}
+
+	logger.Infof("", "", "done")
+}
+
+// apiserverConfig contains the settings used to connect to the apiserver
+type apiserverConfig struct {
+	// host in the format of protocol://address:port/pathPrefix, e.g.http://localhost:8001.
+	host string
+	// kubeConfig location of kubeconfig file
+	kubeConfig string
+	// kubeContext name of the kubeconfig context to use (empty uses the current context)
+	kubeContext string
+	// userAgent value of the User-Agent header sent to the apiserver
+	userAgent string
+	// qps and burst limits of the client-side rate limiter
+	qps   float32
+	burst int
+	// timeout maximum time for each request (0 means no limit). It also limits the
+	// streams, the dump sets the timeout of each list request instead (see dump.WrapTransport)
+	timeout time.Duration
+	// insecure disables the verification of the certificate of the apiserver
+	insecure bool
+	// caFile location of the certificate authority used to verify the apiserver (replaces the one of the kubeconfig)
+	caFile string
+	// token bearer token used to authenticate (replaces the credentials of the kubeconfig)
+	token string
+	// tokenFile file with the bearer token, read again when it changes (replaces the credentials of the kubeconfig)
+	tokenFile string
+}
+
 // createApiserverClient creates new Kubernetes Apiserver client. When kubeconfig or apiserverHost param is empty
 // the function assumes that it is running inside a Kubernetes cluster and attempts to
 // discover the Apiserver. Otherwise, it connects to the Apiserver specified.
-//
-// apiserverHost param is in the format of protocol://address:port/pathPrefix, e.g.http://localhost:8001.
-// kubeConfig location of kubeconfig file
-func createApiserverClient(apiserverHost string, kubeConfig string) (*client.Clientset, error) {
+// When a token is configured and the default service account token is not mounted
+// the apiserver is located using the environment variables of the pod
+func createApiserverClient(c apiserverConfig) (*client.Clientset, error) {
+	if c.token != "" && c.tokenFile != "" {
+		return nil, fmt.Errorf("--token and --token-file cannot be used together")
+	}
 
 	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
-		&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeConfig},
-		&clientcmd.ConfigOverrides{ClusterInfo: clientcmdapi.Cluster{Server: apiserverHost}})
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: c.kubeConfig},
+		&clientcmd.ConfigOverrides{ClusterInfo: clientcmdapi.Cluster{Server: c.host}, CurrentContext: c.kubeContext})
 
 	cfg, err := clientConfig.ClientConfig()
-	if err != nil {
+	switch {
+	case err != nil && clientcmd.IsEmptyConfig(err) && (c.token != "" || c.tokenFile != ""):
+		cfg, err = serviceHostConfig()
+		if err != nil {
+			return nil, err
+		}
+	case err != nil:
 		return nil, err
 	}
 
-	cfg.QPS = defaultQPS
-	cfg.Burst = defaultBurst
+	cfg.QPS = c.qps
+	cfg.Burst = c.burst
+	cfg.Timeout = c.timeout
 	cfg.ContentType = "application/vnd.kubernetes.protobuf"
+	cfg.UserAgent = c.userAgent
 
-	glog.Infof("Creating API server client for %s", cfg.Host)
-
-	client, err := client.NewForConfig(cfg)
-
-	if err != nil {
-		return nil, err
-	}
-	return client, nil
-}
-
-/**
- * Handles fatal init error that prevents server from doing any work. Prints verbose error
- * message and quits the server.
- */
-func handleFatalInitError(err error) {
-	glog.Fatalf("Error while initializing connection to Kubernetes apiserver. "+
-		"This most likely means that the cluster is misconfigured (e.g., it has "+
-		"invalid apiserver certificates or service accounts configuration). Reason: %s\n"+
-		"Refer to the troubleshooting guide for more information: "+
-		"https://github.com/kubernetes/ingress/blob/master/docs/troubleshooting.md", err)
-}
-
-// dump extracts information from a Kubernetes cluster and creates multiple
-// files (one per namespace) with the content
-func dumpCluster(kubeClient *client.Clientset, output, namespace string, skipNames, skipTypes []string) {
-	nss, err := kubeClient.Namespaces().List(api.ListOptions{})
-	if err != nil {
-		glog.Fatalf("unexpected error obtaining information about the namespaces: %v", err)
+	if c.caFile != "" {
+		cfg.TLSClientConfig.CAFile = c.caFile
+		cfg.TLSClientConfig.CAData = nil
 	}
 
-	var skipNamesRegex *regexp.Regexp
-
-	if len(skipNames) > 0 {
-		skipNamesRegex = regexp.MustCompile(strings.Join(skipNames, "|"))
+	if c.insecure {
+		glog.Warningf("the certificate of the apiserver will not be verified, the connection is insecure")
+		cfg.Insecure = true
+		cfg.TLSClientConfig.CAFile = ""
+		cfg.TLSClientConfig.CAData = nil
 	}
 
-	glog.Infof("Dumping cluster objects...")
-	if namespace != "" {
-		err := dumpNamespace(kubeClient, namespace, output, skipNamesRegex, skipTypes)
+	switch {
+	case c.token != "":
+		cfg.BearerToken = c.token
+		cfg.Username, cfg.Password = "", ""
+	case c.tokenFile != "":
+		tokens, err := newTokenFileRoundTripper(c.tokenFile)
 		if err != nil {
-			glog.Fatalf("unexpected error obtaining information about the namespaces: %v", err)
+			return nil, err
 		}
-
-		glog.Infof("done")
-		os.Exit(0)
+		cfg.BearerToken = ""
+		cfg.Username, cfg.Password = "", ""
+		cfg.WrapTransport = tokens.wrap
 	}
 
-	var wg sync.WaitGroup
-	for _, ns := range nss.Items {
-		if ns.Status.Phase == api.NamespaceTerminating {
-			glog.Infof("skiping namespace %v (is being terminated)", ns.Name)
-			continue
+	if wrap := cfg.WrapTransport; wrap != nil {
+		cfg.WrapTransport = func(rt http.RoundTripper) http.RoundTripper {
+			return wrap(dump.WrapTransport(rt))
 		}
-
-		wg.Add(1)
-		name := ns.Name
-		go func() {
-			err := dumpNamespace(kubeClient, name, output, skipNamesRegex, skipTypes)
-			if err != nil {
-				glog.Fatalf("unexpected error dumping namespace (%v) content: %v", name, err)
-			}
-			wg.Done()
-		}()
+	} else {
+		cfg.WrapTransport = dump.WrapTransport
 	}
 
-	wg.Wait()
-	glog.Infof("done")
-}
-
-func newMappingFactoring() map[string]*k8sObject {
-	return map[string]*k8sObject{
-		"configmaps": &k8sObject{
-			Kind:    "ConfigMap",
-			Runtime: &api.ConfigMapList{},
-		},
-		"daemonsets": &k8sObject{
-			Kind:    "DaemonSet",
-			Runtime: &extensions.DaemonSetList{},
-		},
-		"deployments": &k8sObject{
-			Kind:    "Deployment",
-			Runtime: &extensions.DeploymentList{},
-		},
-		"endpoints": &k8sObject{
-			Kind:    "Endpoints",
-			Runtime: &api.EndpointsList{},
-		},
-		"horizontalpodautoscalers": &k8sObject{
-			Kind:    "ConfigMap",
-			Runtime: &autoscalingapiv1.HorizontalPodAutoscalerList{},
-		},
-		"ingresses": &k8sObject{
-			Kind:    "Ingress",
-			Runtime: &extensions.IngressList{},
-		},
-		"jobs": &k8sObject{
-			Kind:    "Job",
-			Runtime: &batch.JobList{},
-		},
-		"limitranges": &k8sObject{
-			Kind:    "LimitRange",
-			Runtime: &api.LimitRangeList{},
-		},
-		"networkpolicies": &k8sObject{
-			Kind:    "NetworkPolicy",
-			Runtime: &extensions.NetworkPolicyList{},
-		},
-		"persistentvolumeclaims": &k8sObject{
-			Kind:    "PersistentVolumeClaim",
-			Runtime: &api.PersistentVolumeClaimList{},
-		},
-		"persistentvolumes": &k8sObject{
-			Kind:    "PersistentVolume",
-			Runtime: &api.PersistentVolumeList{},
-		},
-		"podsecuritypolicies": &k8sObject{
-			Kind:    "PodSecurityPolicy",
-			Runtime: &extensions.PodSecurityPolicyList{},
-		},
-		"podtemplates": &k8sObject{
-			Kind:    "PodTemplate",
-			Runtime: &api.PodTemplateList{},
-		},
-		"replicasets": &k8sObject{
-			Kind:    "ReplicaSet",
-			Runtime: &extensions.ReplicaSetList{},
-		},
-		"replicationcontrollers": &k8sObject{
-			Kind:    "ReplicationController",
-			Runtime: &api.ReplicationControllerList{},
-		},
-		"resourcequotas": &k8sObject{
-			Kind:    "ConfigMap",
-			Runtime: &api.ConfigMapList{},
-		},
-		"services": &k8sObject{
-			Kind:    "Service",
-			Runtime: &api.ServiceList{},
-		},
-		"secrets": &k8sObject{
-			Kind:    "Secret",
-			Runtime: &api.SecretList{},
-		},
-		"statefulsets": &k8sObject{
-			Kind:    "StatefulSet",
-			Runtime: &apps.StatefulSetList{},
-		},
-		"storageclasses": &k8sObject{
-			Kind:    "StorageClass",
-			Runtime: &storage.StorageClassList{},
-		},
-		"thirdpartyresources": &k8sObject{
-			Kind:    "ThirdPartyResource",
-			Runtime: &extensions.ThirdPartyResourceList{},
-		},
-	}
-}
+	glog.Infof("Creating API server client for %s", cfg.Host)
 
-var (
-	regex = regexp.MustCompile("(\\s*)resourceVersion: \"(\\d+)\"|(\\s*)ExternalName: \"\"")
-)
+	client, err := client.NewForConfig(cfg)
 
-type k8sObject struct {
-	APIVersion string
-	Kind       string
-	Runtime    runtime.Object
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
 }
 
-// dumpNamespace extracts information about Kubernetes objects located in a
-// particular namespace.
-func dumpNamespace(kubeClient *client.Clientset, ns, output string, skipNames *regexp.Regexp, skipTypes []string) error {
-	glog.Infof("\tdumping namespace %v", ns)
-
-	content := make(map[string]interface{})
-	data := make(map[string]interface{})
-	notFound := []string{}
-
-	t, err := text_template.New("dump").Funcs(text_template.FuncMap{
-		"objectToYaml": func(kind, apiVersion string, obj runtime.Object) string {
-			s, err := marshalYaml(kind, apiVersion, obj, skipNames)
-			if err != nil {
-				glog.Errorf("unexpected error converting object to yaml: %v", err)
-			}
-			return s
-		},
-	}).Parse(template)
+// runVerify checks the files of a dump directory against its manifest.
+// It exits with code 1 if any file is missing or was modified
+func runVerify(dir string) {
+	if dir == "" || dir == "-" {
+		glog.Fatalf("--verify requires the directory of the dump in --output")
+	}
 
+	checked, problems, err := dump.VerifyManifest(dir)
 	if err != nil {
-		return errors.Wrap(err, "unexpected error parsing template")
+		glog.Fatalf("%v", err)
 	}
 
-	for objectType, result := range newMappingFactoring() {
-		if skipType(objectType, skipTypes) {
-			glog.Warningf("skipping type %v", objectType)
-			continue
-		}
-
-		var rc restclient.Interface
-		var apiVersion string
-
-		switch objectType {
-		case "horizontalpodautoscalers":
-			rc = kubeClient.Autoscaling().RESTClient()
-			apiVersion = "extensions/v1beta1"
-		case "jobs":
-			rc = kubeClient.Batch().RESTClient()
-			apiVersion = "batch/v2alpha1"
-		case "statefulsets":
-			rc = kubeClient.Apps().RESTClient()
-			apiVersion = "apps/v1beta1"
-		case "storageclasses":
-			rc = kubeClient.Storage().RESTClient()
-			apiVersion = "storage.k8s.io/v1beta1"
-		case "daemonsets", "deployments", "ingresses", "networkpolicies", "podsecuritypolicies", "replicasets", "thirdpartyresources":
-			rc = kubeClient.Extensions().RESTClient()
-			apiVersion = "extensions/v1beta1"
-		default:
-			rc = kubeClient.Core().RESTClient()
-			apiVersion = "v1"
-		}
-
-		err = rc.Get().
-			Namespace(ns).
-			Resource(objectType).
-			VersionedParams(&api.ListOptions{}, unversioned_api.ParameterCodec).
-			Do().
-			Into(result.Runtime)
-
-		if err != nil {
-			if !k8s_errors.IsNotFound(err) {
-				return errors.Wrap(err, "unexpected error querying type")
-			}
-			notFound = append(notFound, fmt.Sprintf("there is no object of type %v in namespace %v", objectType, ns))
-		}
-
-		result.APIVersion = apiVersion
-		data[objectType] = result
+	for _, problem := range problems {
+		glog.Errorf("%v", problem)
 	}
 
-	content["notFound"] = notFound
-	content["name"] = ns
-	content["types"] = data
-
-	tmplBuf := new(bytes.Buffer)
-	err = t.Execute(tmplBuf, content)
-	if err != nil {
-		return errors.Wrap(err, "unexpected error populating template")
+	if len(problems) > 0 {
+		glog.Errorf("%v of %v files do not match the manifest", len(problems), checked)
+		os.Exit(1)
 	}
 
-	path := fmt.Sprintf("%v/%v.yaml", output, ns)
-	return ioutil.WriteFile(path, tmplBuf.Bytes(), 0644)
+	glog.Infof("verified %v files", checked)
 }
 
-// skipType returns true if a slice contains an element with a particular name
-func skipType(skip string, names []string) bool {
-	for _, name := range names {
-		if skip == name {
-			return true
-		}
+// validateContext checks that a context exists in the kubeconfig
+// (loaded from the explicit path or the default locations)
+func validateContext(kubeConfig, kubeContext string) error {
+	if kubeContext == "" {
+		return nil
 	}
-	return false
-}
 
-func objectMetaFor(obj runtime.Object) (*api.ObjectMeta, error) {
-	v, err := conversion.EnforcePtr(obj)
+	rawConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeConfig},
+		&clientcmd.ConfigOverrides{}).RawConfig()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	var meta *api.ObjectMeta
-	err = runtime.FieldPtr(v, "ObjectMeta", &meta)
-	return meta, err
-}
-
-// marshalYaml converts an instance of Object interface to a yaml representation
-// removing the field resourceVersion
-func marshalYaml(kind, apiVersion string, obj runtime.Object, skipNames *regexp.Regexp) (string, error) {
-	meta, _ := objectMetaFor(obj)
-	if skipNames != nil && skipNames.MatchString(meta.GetName()) {
-		return "", nil
-	}
-
-	printer := &YAMLPrinter{}
-	tmplBuf := new(bytes.Buffer)
-
-	tmplBuf.Write([]byte(fmt.Sprintf("apiVersion: %v\n", apiVersion)))
-	tmplBuf.Write([]byte(fmt.Sprintf("kind: %v\n", kind)))
 
-	if ing, ok := obj.(*extensions.Ingress); ok {
-		ing.Status = extensions.IngressStatus{}
-	}
-	if svc, ok := obj.(*api.Service); ok {
-		svc.Status = api.ServiceStatus{}
+	if _, ok := rawConfig.Contexts[kubeContext]; !ok {
+		contexts := []string{}
+		for name := range rawConfig.Contexts {
+			contexts = append(contexts, name)
+		}
+		sort.Strings(contexts)
+		return fmt.Errorf("context %v not found in the kubeconfig (available contexts: %v)", kubeContext, strings.Join(contexts, ", "))
 	}
 
-	err := printer.PrintObj(obj, tmplBuf)
-	if err != nil {
-		return "", err
-	}
+	return nil
+}
 
-	return regex.ReplaceAllString(tmplBuf.String(), ""), nil
+/**
+ * Handles fatal init error that prevents server from doing any work. Prints verbose error
+ * message and quits the server.
+ */
+func handleFatalInitError(err error) {
+	glog.Fatalf("Error while initializing connection to Kubernetes apiserver. "+
+		"This most likely means that the cluster is misconfigured (e.g., it has "+
+		"invalid apiserver certificates or service accounts configuration). Reason: %s\n"+
+		"Refer to the troubleshooting guide for more information: "+
+		"https://github.com/kubernetes/ingress/blob/master/docs/troubleshooting.md", err)
 }
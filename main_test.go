@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/dump/pkg/dump"
+	api "k8s.io/kubernetes/pkg/api/v1"
+)
+
+// clientTestServer is an apiserver that returns an empty list of namespaces
+// and records the headers of the requests
+type clientTestServer struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	headers []http.Header
+}
+
+func newClientTestServer(secure bool) *clientTestServer {
+	s := &clientTestServer{}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.headers = append(s.headers, r.Header)
+		s.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"kind":"NamespaceList","apiVersion":"v1","metadata":{},"items":[]}`))
+	})
+
+	if secure {
+		s.Server = httptest.NewTLSServer(handler)
+	} else {
+		s.Server = httptest.NewServer(handler)
+	}
+	return s
+}
+
+// lastHeader returns a header of the last request received
+func (s *clientTestServer) lastHeader(name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.headers) == 0 {
+		return ""
+	}
+	return s.headers[len(s.headers)-1].Get(name)
+}
+
+// listNamespaces creates a client with the configuration and lists the namespaces
+func listNamespaces(c apiserverConfig) error {
+	kubeClient, err := createApiserverClient(c)
+	if err != nil {
+		return err
+	}
+	_, err = kubeClient.Core().Namespaces().List(api.ListOptions{})
+	return err
+}
+
+func TestCreateApiserverClientUserAgent(t *testing.T) {
+	s := newClientTestServer(false)
+	defer s.Close()
+
+	err := listNamespaces(apiserverConfig{host: s.URL, userAgent: "k8s-dump/1.2.3 (namespace dump)", qps: 5, burst: 10})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if agent := s.lastHeader("User-Agent"); agent != "k8s-dump/1.2.3 (namespace dump)" {
+		t.Errorf("expected the User-Agent of the configuration, got %q", agent)
+	}
+}
+
+// certificatePEM returns the certificate of a TLS test server in PEM format
+func certificatePEM(s *httptest.Server) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.TLS.Certificates[0].Certificate[0]})
+}
+
+// newCertificatePEM returns a new self-signed certificate in PEM format
+func newCertificatePEM(t *testing.T) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error generating a key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "other-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("unexpected error creating a certificate: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+// writeTestFile writes the content in a new temporary file (the caller must remove it)
+func writeTestFile(t *testing.T, content []byte) string {
+	f, err := ioutil.TempFile("", "dump")
+	if err != nil {
+		t.Fatalf("unexpected error creating a temporary file: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(content); err != nil {
+		t.Fatalf("unexpected error writing %v: %v", f.Name(), err)
+	}
+	return f.Name()
+}
+
+func TestCreateApiserverClientTLS(t *testing.T) {
+	s := newClientTestServer(true)
+	defer s.Close()
+	// the certificate authority of the kubeconfig did not sign the certificate of the server
+	otherCA := newCertificatePEM(t)
+
+	caFile := writeTestFile(t, certificatePEM(s.Server))
+	defer os.Remove(caFile)
+	otherCAFile := writeTestFile(t, otherCA)
+	defer os.Remove(otherCAFile)
+	kubeConfig := writeTestFile(t, []byte(fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: %v
+    certificate-authority-data: %v
+contexts:
+- name: test
+  context:
+    cluster: test
+current-context: test
+`, s.URL, base64.StdEncoding.EncodeToString(otherCA))))
+	defer os.Remove(kubeConfig)
+
+	tests := []struct {
+		name   string
+		config apiserverConfig
+		err    string
+	}{
+		{name: "the certificate authority of the kubeconfig", config: apiserverConfig{kubeConfig: kubeConfig},
+			err: "x509: certificate signed by unknown authority"},
+		{name: "--certificate-authority", config: apiserverConfig{kubeConfig: kubeConfig, caFile: caFile}},
+		{name: "--certificate-authority of another authority", config: apiserverConfig{host: s.URL, caFile: otherCAFile},
+			err: "x509: certificate signed by unknown authority"},
+		{name: "--insecure-skip-tls-verify", config: apiserverConfig{kubeConfig: kubeConfig, insecure: true}},
+		// the certificate authority is ignored in insecure mode
+		{name: "--insecure-skip-tls-verify and --certificate-authority", config: apiserverConfig{host: s.URL, caFile: otherCAFile, insecure: true}},
+	}
+
+	for _, test := range tests {
+		test.config.qps, test.config.burst = 5, 10
+		err := listNamespaces(test.config)
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("%v: unexpected error: %v", test.name, err)
+		case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+			t.Errorf("%v: expected the error %q, got %v", test.name, test.err, err)
+		}
+	}
+}
+
+func TestFinishDump(t *testing.T) {
+	defer func(e func(int)) { exit = e }(exit)
+
+	tests := []struct {
+		name        string
+		record      func(r *dump.DumpResult)
+		failOnEmpty bool
+		code        int
+		message     string
+	}{
+		{"success", func(r *dump.DumpResult) { r.AddNamespace("web") }, false, 0, "done"},
+		{"types without objects", func(r *dump.DumpResult) {
+			r.AddNamespace("web")
+			r.AddNotFound("web", "configmaps")
+		}, true, 0, "done"},
+		{"failed type", func(r *dump.DumpResult) {
+			r.AddNamespace("web")
+			r.AddError("web", "configmaps", errors.New("the server is unavailable"))
+		}, false, failedDumpExitCode, "the dump finished with 1 errors"},
+		{"failed namespace", func(r *dump.DumpResult) {
+			r.AddError("web", "", errors.New("the server is unavailable"))
+		}, true, failedDumpExitCode, "the dump finished with 1 errors"},
+		{"empty", func(r *dump.DumpResult) {}, false, 0, "done"},
+		{"empty with --fail-on-empty", func(r *dump.DumpResult) {}, true, emptyClusterExitCode, ""},
+	}
+
+	for _, test := range tests {
+		code := 0
+		exit = func(c int) { code = c }
+
+		out := new(bytes.Buffer)
+		logger, _ := dump.NewLogger("json", out)
+		result := &dump.DumpResult{}
+		test.record(result)
+
+		finishDump(result, test.failOnEmpty, logger)
+		if code != test.code {
+			t.Errorf("%v: expected the exit code %v, got %v", test.name, test.code, code)
+		}
+		if !strings.Contains(out.String(), test.message) {
+			t.Errorf("%v: expected the message %q, got %q", test.name, test.message, out.String())
+		}
+		if code != 0 && strings.Contains(out.String(), "done") {
+			t.Errorf("%v: expected no done message in a failed dump, got %q", test.name, out.String())
+		}
+	}
+}
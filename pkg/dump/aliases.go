@@ -0,0 +1,62 @@
+package dump
+
+import (
+	"strings"
+)
+
+// typeAliases short names of the types (the ones used by kubectl)
+var typeAliases = map[string]string{
+	"cm":     "configmaps",
+	"ds":     "daemonsets",
+	"deploy": "deployments",
+	"ep":     "endpoints",
+	"ev":     "events",
+	"hpa":    "horizontalpodautoscalers",
+	"ing":    "ingresses",
+	"limits": "limitranges",
+	"netpol": "networkpolicies",
+	"po":     "pods",
+	"psp":    "podsecuritypolicies",
+	"pv":     "persistentvolumes",
+	"pvc":    "persistentvolumeclaims",
+	"quota":  "resourcequotas",
+	"rc":     "replicationcontrollers",
+	"rs":     "replicasets",
+	"sa":     "serviceaccounts",
+	"sc":     "storageclasses",
+	"sts":    "statefulsets",
+	"svc":    "services",
+}
+
+// canonicalType returns the name of a type used in the mapping from the
+// plural name, the singular name (the kind in lowercase) or the short name,
+// ignoring the case. The unknown names are returned unchanged
+func canonicalType(name string, mapping map[string]*k8sObject) string {
+	lower := strings.ToLower(name)
+	if _, ok := mapping[lower]; ok {
+		return lower
+	}
+
+	if objectType, ok := typeAliases[lower]; ok {
+		return objectType
+	}
+
+	for objectType, o := range mapping {
+		if strings.ToLower(o.Kind) == lower {
+			return objectType
+		}
+	}
+
+	return name
+}
+
+// normalizeTypes returns the names of the types used in the mapping
+// for a list of names (see canonicalType)
+func normalizeTypes(names []string) []string {
+	mapping := newMappingFactoring()
+	normalized := []string{}
+	for _, name := range names {
+		normalized = append(normalized, canonicalType(name, mapping))
+	}
+	return normalized
+}
@@ -0,0 +1,64 @@
+package dump
+
+import (
+	"testing"
+)
+
+func TestCanonicalType(t *testing.T) {
+	mapping := newMappingFactoring()
+	for name, expected := range map[string]string{
+		"secret":                "secrets",
+		"secrets":               "secrets",
+		"Secret":                "secrets",
+		"SECRETS":               "secrets",
+		"svc":                   "services",
+		"service":               "services",
+		"services":              "services",
+		"cm":                    "configmaps",
+		"configmap":             "configmaps",
+		"configmaps":            "configmaps",
+		"ConfigMap":             "configmaps",
+		"deploy":                "deployments",
+		"Deployment":            "deployments",
+		"networkpolicy":         "networkpolicies",
+		"persistentvolumeclaim": "persistentvolumeclaims",
+		// the unknown names are not changed
+		"secretz": "secretz",
+		"":        "",
+	} {
+		if objectType := canonicalType(name, mapping); objectType != expected {
+			t.Errorf("expected the type %q for %q, got %q", expected, name, objectType)
+		}
+	}
+}
+
+func TestSkipTypeAliases(t *testing.T) {
+	options := newTestOptions("")
+	options.SkipTypes = []string{"secret", "svc", "CM"}
+	opts := completeTestOptions(t, options)
+
+	for objectType, skipped := range map[string]bool{
+		"secrets":     true,
+		"services":    true,
+		"configmaps":  true,
+		"deployments": false,
+	} {
+		if skipType(objectType, opts) != skipped {
+			t.Errorf("expected skipped %v for the type %v with --skip-types=%v", skipped, objectType, options.SkipTypes)
+		}
+	}
+
+	options = newTestOptions("")
+	options.IncludeTypes = []string{"Secret", "svc"}
+	opts = completeTestOptions(t, options)
+
+	for objectType, skipped := range map[string]bool{
+		"secrets":    false,
+		"services":   false,
+		"configmaps": true,
+	} {
+		if skipType(objectType, opts) != skipped {
+			t.Errorf("expected skipped %v for the type %v with --include-types=%v", skipped, objectType, options.IncludeTypes)
+		}
+	}
+}
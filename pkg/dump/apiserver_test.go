@@ -0,0 +1,421 @@
+package dump
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	client "k8s.io/kubernetes/pkg/client/clientset_generated/release_1_5"
+	restclient "k8s.io/kubernetes/pkg/client/restclient"
+	"k8s.io/kubernetes/pkg/labels"
+	"k8s.io/kubernetes/pkg/runtime"
+)
+
+// fakeGroupVersions group versions served by the fake apiserver in /apis
+var fakeGroupVersions = []string{"apps/v1beta1", "autoscaling/v1", "batch/v1", "batch/v2alpha1",
+	"extensions/v1beta1", "rbac.authorization.k8s.io/v1alpha1", "storage.k8s.io/v1beta1"}
+
+// fakeAPIServer is an apiserver that keeps the objects in memory, by type,
+// namespace and name (the version used in the request is ignored)
+type fakeAPIServer struct {
+	*httptest.Server
+
+	mu sync.Mutex
+	// objects the stored objects by key (see objectKey)
+	objects map[string]map[string]interface{}
+	// logs content of the logs of the pods by namespace/name
+	logs map[string]string
+	// requests method and path of the requests received
+	requests []string
+	// minor version returned in /version
+	minor string
+	// resourceVersion last resourceVersion assigned
+	resourceVersion int
+	// handle if not nil is called before each request and returns
+	// true if the request was served
+	handle func(w http.ResponseWriter, r *http.Request) bool
+}
+
+// newFakeAPIServer starts an empty fake apiserver (the caller must close it)
+func newFakeAPIServer() *fakeAPIServer {
+	s := &fakeAPIServer{
+		objects: map[string]map[string]interface{}{},
+		logs:    map[string]string{},
+		minor:   "5",
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// client returns a clientset for the fake apiserver with the transport of
+// the command (without the default rate limit of the client, that would
+// slow down the dumps)
+func (s *fakeAPIServer) client(t *testing.T) *client.Clientset {
+	kubeClient, err := client.NewForConfig(&restclient.Config{Host: s.URL, QPS: 1000, Burst: 1000, WrapTransport: WrapTransport})
+	if err != nil {
+		t.Fatalf("unexpected error creating the client: %v", err)
+	}
+	return kubeClient
+}
+
+// add stores an object of a type
+func (s *fakeAPIServer) add(t *testing.T, objectType string, obj runtime.Object) {
+	b, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatalf("unexpected error encoding %v: %v", objectType, err)
+	}
+
+	var o map[string]interface{}
+	err = json.Unmarshal(b, &o)
+	if err != nil {
+		t.Fatalf("unexpected error decoding %v: %v", objectType, err)
+	}
+
+	metadata, _ := o["metadata"].(map[string]interface{})
+	name, _ := metadata["name"].(string)
+	ns, _ := metadata["namespace"].(string)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.store(objectKey(objectType, ns, name), o)
+}
+
+// object returns a stored object (nil if it does not exist)
+func (s *fakeAPIServer) object(objectType, ns, name string) map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.objects[objectKey(objectType, ns, name)]
+}
+
+// received returns the requests received with a method
+func (s *fakeAPIServer) received(method string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	requests := []string{}
+	for _, r := range s.requests {
+		if strings.HasPrefix(r, method+" ") {
+			requests = append(requests, r)
+		}
+	}
+	return requests
+}
+
+// store saves an object assigning a new resourceVersion
+func (s *fakeAPIServer) store(key string, o map[string]interface{}) {
+	s.resourceVersion++
+	metadata, _ := o["metadata"].(map[string]interface{})
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+		o["metadata"] = metadata
+	}
+	metadata["resourceVersion"] = fmt.Sprint(s.resourceVersion)
+	s.objects[key] = o
+}
+
+// objectKey returns the key of an object in the fake apiserver
+func objectKey(objectType, ns, name string) string {
+	return fmt.Sprintf("%v/%v/%v", objectType, ns, name)
+}
+
+// fakeKind returns the kind of the objects of a type
+func fakeKind(objectType string) string {
+	switch objectType {
+	case "namespaces":
+		return "Namespace"
+	case "nodes":
+		return "Node"
+	}
+	if o, ok := newMappingFactoring()[objectType]; ok {
+		return o.Kind
+	}
+	return ""
+}
+
+// fakeRequest is a request to a resource of the fake apiserver
+type fakeRequest struct {
+	apiVersion  string
+	namespace   string
+	objectType  string
+	name        string
+	subresource string
+}
+
+// parseFakeRequest parses the path of a request to a resource, e.g.
+// /apis/extensions/v1beta1/namespaces/default/deployments/nginx
+func parseFakeRequest(path string) (fakeRequest, bool) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	req := fakeRequest{}
+	switch {
+	case len(segments) >= 3 && segments[0] == "api":
+		req.apiVersion, segments = segments[1], segments[2:]
+	case len(segments) >= 4 && segments[0] == "apis":
+		req.apiVersion, segments = segments[1]+"/"+segments[2], segments[3:]
+	default:
+		return req, false
+	}
+
+	if len(segments) >= 3 && segments[0] == "namespaces" {
+		req.namespace, segments = segments[1], segments[2:]
+	}
+
+	req.objectType = segments[0]
+	if len(segments) > 1 {
+		req.name = segments[1]
+	}
+	if len(segments) > 2 {
+		req.subresource = segments[2]
+	}
+	return req, true
+}
+
+func (s *fakeAPIServer) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+	handle := s.handle
+	s.mu.Unlock()
+
+	if handle != nil && handle(w, r) {
+		return
+	}
+
+	switch r.URL.Path {
+	case "/version":
+		writeFakeJSON(w, http.StatusOK, map[string]interface{}{"major": "1", "minor": s.minor, "gitVersion": fmt.Sprintf("v1.%v.0", s.minor)})
+		return
+	case "/api":
+		writeFakeJSON(w, http.StatusOK, map[string]interface{}{"kind": "APIVersions", "versions": []string{"v1"}})
+		return
+	case "/apis":
+		groups := map[string][]interface{}{}
+		names := []string{}
+		for _, gv := range fakeGroupVersions {
+			parts := strings.SplitN(gv, "/", 2)
+			if _, ok := groups[parts[0]]; !ok {
+				names = append(names, parts[0])
+			}
+			groups[parts[0]] = append(groups[parts[0]], map[string]interface{}{"groupVersion": gv, "version": parts[1]})
+		}
+		list := []interface{}{}
+		for _, name := range names {
+			list = append(list, map[string]interface{}{"name": name, "versions": groups[name]})
+		}
+		writeFakeJSON(w, http.StatusOK, map[string]interface{}{"kind": "APIGroupList", "groups": list})
+		return
+	}
+
+	req, ok := parseFakeRequest(r.URL.Path)
+	if !ok {
+		writeFakeStatus(w, http.StatusNotFound, "NotFound", fmt.Sprintf("the path %v does not exist", r.URL.Path))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := objectKey(req.objectType, req.namespace, req.name)
+	dryRun := r.URL.Query().Get("dryRun") == "All"
+
+	switch {
+	case r.Method == "GET" && req.subresource == "log":
+		log, ok := s.logs[req.namespace+"/"+req.name]
+		if !ok {
+			writeFakeStatus(w, http.StatusNotFound, "NotFound", fmt.Sprintf("pods %q not found", req.name))
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(log))
+	case r.Method == "GET" && req.name == "":
+		selector, err := labels.Parse(r.URL.Query().Get("labelSelector"))
+		if err != nil {
+			writeFakeStatus(w, http.StatusBadRequest, "BadRequest", err.Error())
+			return
+		}
+
+		keys := []string{}
+		prefix := objectKey(req.objectType, req.namespace, "")
+		for k := range s.objects {
+			if strings.HasPrefix(k, prefix) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+
+		items := []interface{}{}
+		for _, k := range keys {
+			if selector.Matches(fakeLabels(s.objects[k])) {
+				items = append(items, s.objects[k])
+			}
+		}
+		writeFakeJSON(w, http.StatusOK, map[string]interface{}{
+			"kind":       fakeKind(req.objectType) + "List",
+			"apiVersion": req.apiVersion,
+			"metadata":   map[string]interface{}{"resourceVersion": fmt.Sprint(s.resourceVersion)},
+			"items":      items,
+		})
+	case r.Method == "GET":
+		o, ok := s.objects[key]
+		if !ok {
+			writeFakeStatus(w, http.StatusNotFound, "NotFound", fmt.Sprintf("%v %q not found", req.objectType, req.name))
+			return
+		}
+		writeFakeObject(w, http.StatusOK, req, o)
+	case r.Method == "POST":
+		o, err := readFakeObject(r)
+		if err != nil {
+			writeFakeStatus(w, http.StatusBadRequest, "BadRequest", err.Error())
+			return
+		}
+		metadata, _ := o["metadata"].(map[string]interface{})
+		name, _ := metadata["name"].(string)
+		key = objectKey(req.objectType, req.namespace, name)
+		if _, ok := s.objects[key]; ok {
+			writeFakeStatus(w, http.StatusConflict, "AlreadyExists", fmt.Sprintf("%v %q already exists", req.objectType, name))
+			return
+		}
+		if !dryRun {
+			s.store(key, o)
+		}
+		writeFakeObject(w, http.StatusCreated, req, o)
+	case r.Method == "PUT":
+		current, ok := s.objects[key]
+		if !ok {
+			writeFakeStatus(w, http.StatusNotFound, "NotFound", fmt.Sprintf("%v %q not found", req.objectType, req.name))
+			return
+		}
+		o, err := readFakeObject(r)
+		if err != nil {
+			writeFakeStatus(w, http.StatusBadRequest, "BadRequest", err.Error())
+			return
+		}
+		if resourceVersionOf(o) != resourceVersionOf(current) {
+			writeFakeStatus(w, http.StatusConflict, "Conflict", fmt.Sprintf("the object %v %q has been modified", req.objectType, req.name))
+			return
+		}
+		if immutable, _ := current["immutable"].(bool); immutable {
+			writeFakeStatus(w, http.StatusUnprocessableEntity, "Invalid", fmt.Sprintf("%v %q is invalid: field is immutable", req.objectType, req.name))
+			return
+		}
+		if !dryRun {
+			s.store(key, o)
+		}
+		writeFakeObject(w, http.StatusOK, req, o)
+	case r.Method == "PATCH":
+		current, ok := s.objects[key]
+		if !ok {
+			writeFakeStatus(w, http.StatusNotFound, "NotFound", fmt.Sprintf("%v %q not found", req.objectType, req.name))
+			return
+		}
+		patch, err := readFakeObject(r)
+		if err != nil {
+			writeFakeStatus(w, http.StatusBadRequest, "BadRequest", err.Error())
+			return
+		}
+		if immutable, _ := current["immutable"].(bool); immutable {
+			writeFakeStatus(w, http.StatusUnprocessableEntity, "Invalid", fmt.Sprintf("%v %q is invalid: field is immutable", req.objectType, req.name))
+			return
+		}
+		o := mergePatch(current, patch).(map[string]interface{})
+		if !dryRun {
+			s.store(key, o)
+		}
+		writeFakeObject(w, http.StatusOK, req, o)
+	case r.Method == "DELETE":
+		if _, ok := s.objects[key]; !ok {
+			writeFakeStatus(w, http.StatusNotFound, "NotFound", fmt.Sprintf("%v %q not found", req.objectType, req.name))
+			return
+		}
+		if !dryRun {
+			delete(s.objects, key)
+		}
+		writeFakeJSON(w, http.StatusOK, map[string]interface{}{"kind": "Status", "apiVersion": "v1", "status": "Success"})
+	default:
+		writeFakeStatus(w, http.StatusMethodNotAllowed, "MethodNotAllowed", fmt.Sprintf("%v is not supported", r.Method))
+	}
+}
+
+// mergePatch applies a json merge patch (RFC 7386) to a decoded object
+func mergePatch(current, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	c, ok := current.(map[string]interface{})
+	merged := map[string]interface{}{}
+	if ok {
+		for k, v := range c {
+			merged[k] = v
+		}
+	}
+
+	for k, v := range p {
+		if v == nil {
+			delete(merged, k)
+			continue
+		}
+		merged[k] = mergePatch(merged[k], v)
+	}
+	return merged
+}
+
+// fakeLabels returns the labels of a stored object
+func fakeLabels(o map[string]interface{}) labels.Set {
+	metadata, _ := o["metadata"].(map[string]interface{})
+	values, _ := metadata["labels"].(map[string]interface{})
+	set := labels.Set{}
+	for k, v := range values {
+		set[k], _ = v.(string)
+	}
+	return set
+}
+
+func resourceVersionOf(o map[string]interface{}) string {
+	metadata, _ := o["metadata"].(map[string]interface{})
+	rv, _ := metadata["resourceVersion"].(string)
+	return rv
+}
+
+func readFakeObject(r *http.Request) (map[string]interface{}, error) {
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var o map[string]interface{}
+	err = json.Unmarshal(b, &o)
+	return o, err
+}
+
+func writeFakeObject(w http.ResponseWriter, code int, req fakeRequest, o map[string]interface{}) {
+	obj := map[string]interface{}{}
+	for k, v := range o {
+		obj[k] = v
+	}
+	obj["kind"] = fakeKind(req.objectType)
+	obj["apiVersion"] = req.apiVersion
+	writeFakeJSON(w, code, obj)
+}
+
+func writeFakeStatus(w http.ResponseWriter, code int, reason, message string) {
+	writeFakeJSON(w, code, map[string]interface{}{
+		"kind":       "Status",
+		"apiVersion": "v1",
+		"status":     "Failure",
+		"reason":     reason,
+		"message":    message,
+		"code":       code,
+	})
+}
+
+func writeFakeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
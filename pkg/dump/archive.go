@@ -0,0 +1,97 @@
+package dump
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// validArchive checks the value of the --archive flag
+func validArchive(path string) error {
+	if path != "" && !strings.HasSuffix(path, ".tar.gz") && !strings.HasSuffix(path, ".tgz") {
+		return fmt.Errorf("invalid archive %v (the name must end with .tar.gz or .tgz)", path)
+	}
+	return nil
+}
+
+// validCompressLevel checks the value of the --compress-level flag
+func validCompressLevel(level int) error {
+	if level < gzip.NoCompression || level > gzip.BestCompression {
+		return fmt.Errorf("invalid compress level %v (must be between %v and %v)", level, gzip.NoCompression, gzip.BestCompression)
+	}
+	return nil
+}
+
+// archiveWriter writes the files of the dump to a tar archive compressed with
+// gzip. The files are added from the goroutines that dump each namespace
+type archiveWriter struct {
+	sync.Mutex
+	f  *os.File
+	gz *gzip.Writer
+	tw *tar.Writer
+	// mode of the files added to the archive
+	mode os.FileMode
+}
+
+func newArchiveWriter(path string, mode os.FileMode, level int, exclusive bool) (*archiveWriter, error) {
+	f, err := createFile(path, mode, exclusive)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unexpected error creating the archive %v", path)
+	}
+
+	gz, err := gzip.NewWriterLevel(f, level)
+	if err != nil {
+		f.Close()
+		return nil, errors.Wrap(err, "unexpected error creating the archive")
+	}
+	return &archiveWriter{f: f, gz: gz, tw: tar.NewWriter(gz), mode: mode}, nil
+}
+
+// add writes a file to the archive
+func (a *archiveWriter) add(name string, content []byte) error {
+	a.Lock()
+	defer a.Unlock()
+
+	err := a.tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    int64(a.mode),
+		Size:    int64(len(content)),
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "unexpected error adding %v to the archive", name)
+	}
+
+	_, err = a.tw.Write(content)
+	if err != nil {
+		return errors.Wrapf(err, "unexpected error adding %v to the archive", name)
+	}
+	return nil
+}
+
+// close flushes the archive and closes the file
+func (a *archiveWriter) close() error {
+	a.Lock()
+	defer a.Unlock()
+
+	err := a.tw.Close()
+	if err == nil {
+		err = a.gz.Close()
+	}
+
+	closeErr := a.f.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "unexpected error closing the archive")
+	}
+	return nil
+}
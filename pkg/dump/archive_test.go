@@ -0,0 +1,131 @@
+package dump
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readArchiveFiles returns the content of the files of a tar.gz archive by name
+func readArchiveFiles(t *testing.T, path string) map[string][]byte {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("unexpected error opening the archive: %v", err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("unexpected error reading the archive: %v", err)
+	}
+
+	files := map[string][]byte{}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			if err != io.EOF {
+				t.Fatalf("unexpected error reading the archive: %v", err)
+			}
+			break
+		}
+
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("unexpected error reading %v from the archive: %v", header.Name, err)
+		}
+		files[header.Name] = content
+	}
+	return files
+}
+
+// dumpTestClusterArchive dumps the cluster to an archive in dir and returns its path
+func dumpTestClusterArchive(t *testing.T, s *fakeAPIServer, dir string, configure func(*Options)) string {
+	path := filepath.Join(dir, "dump.tar.gz")
+	opts := newTestOptions("")
+	opts.Archive = path
+	if configure != nil {
+		configure(&opts)
+	}
+
+	result, err := DumpCluster(s.client(t), opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Failed() {
+		t.Fatalf("unexpected errors in the dump: %v", result.Err())
+	}
+	return path
+}
+
+func TestDumpClusterArchiveCompressLevel(t *testing.T) {
+	s := newTestCluster(t)
+	defer s.Close()
+
+	sizes := map[int]int64{}
+	var files map[string][]byte
+	for _, level := range []int{0, 1, 9} {
+		dir, err := ioutil.TempDir("", "dump")
+		if err != nil {
+			t.Fatalf("unexpected error creating a temporary directory: %v", err)
+		}
+		defer os.RemoveAll(dir)
+
+		path := dumpTestClusterArchive(t, s, dir, func(o *Options) { o.CompressLevel = level })
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("unexpected error reading the archive: %v", err)
+		}
+		sizes[level] = info.Size()
+
+		archived := readArchiveFiles(t, path)
+		if _, ok := archived["web.yaml"]; !ok {
+			t.Errorf("expected web.yaml in the archive with the level %v, got %v files", level, len(archived))
+		}
+		if files != nil && len(files) != len(archived) {
+			t.Errorf("expected the same files with the level %v, got %v and %v files", level, len(files), len(archived))
+		}
+		files = archived
+	}
+
+	if sizes[0] <= sizes[1] || sizes[0] <= sizes[9] {
+		t.Errorf("expected the archive without compression to be the biggest, got the sizes %v", sizes)
+	}
+}
+
+func TestValidCompressLevel(t *testing.T) {
+	for _, level := range []int{-1, 10} {
+		opts := newTestOptions("")
+		opts.CompressLevel = level
+		_, err := opts.complete()
+		if err == nil || !strings.Contains(err.Error(), "invalid compress level") {
+			t.Errorf("expected an error with the compress level %v, got %v", level, err)
+		}
+	}
+}
+
+func TestDumpClusterArchiveMatchesDirectory(t *testing.T) {
+	s := newTestCluster(t)
+	defer s.Close()
+
+	for _, format := range []string{"yaml", "json"} {
+		dir, err := ioutil.TempDir("", "dump")
+		if err != nil {
+			t.Fatalf("unexpected error creating a temporary directory: %v", err)
+		}
+		defer os.RemoveAll(dir)
+
+		configure := func(o *Options) { o.OutputFormat = format }
+		files := dumpTestCluster(t, s, configure)
+		archived := readArchiveFiles(t, dumpTestClusterArchive(t, s, dir, configure))
+		if _, ok := archived["web."+format]; !ok {
+			t.Errorf("expected web.%v in the archive, got %v files", format, len(archived))
+		}
+		compareDumps(t, files, archived)
+	}
+}
@@ -0,0 +1,61 @@
+package dump
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+
+	api "k8s.io/kubernetes/pkg/api/v1"
+	client "k8s.io/kubernetes/pkg/client/clientset_generated/release_1_5"
+)
+
+// creationTimestampAnnotation annotation with the creation time of the audited secrets
+const creationTimestampAnnotation = "k8s-dump/creation-timestamp"
+
+// auditSecretsFile name (without extension) of the file with the secrets of
+// the skipped namespaces (it does not collide with the file of a namespace)
+const auditSecretsFile = "_audit-secrets"
+
+// dumpSecretsAudit creates the file _audit-secrets.yaml (or .json) listing the
+// secrets located in namespaces skipped from the dump. Only the name, type and
+// creation time of the secrets are included, never the content
+func dumpSecretsAudit(kubeClient *client.Clientset, namespaces []string, opts *dumpOptions) error {
+	opts.log.Infof("", "", "\tauditing secrets in skipped namespaces")
+
+	w := newDocumentWriter("# secrets in skipped namespaces (metadata only)\n", opts)
+	for _, ns := range namespaces {
+		secrets, err := kubeClient.Core().Secrets(ns).List(api.ListOptions{})
+		if err != nil {
+			return errors.Wrapf(err, "unexpected error obtaining the secrets in namespace %v", ns)
+		}
+
+		for _, secret := range secrets.Items {
+			metadataOnly := &api.Secret{
+				ObjectMeta: api.ObjectMeta{
+					Name:      secret.Name,
+					Namespace: secret.Namespace,
+					// the creationTimestamp field is removed by marshalObject
+					Annotations: map[string]string{
+						creationTimestampAnnotation: secret.CreationTimestamp.UTC().Format(time.RFC3339),
+					},
+				},
+				Type: secret.Type,
+			}
+
+			// all the secrets are audited, the filters of the dump are not applied
+			s, err := convertObject("Secret", "v1", metadataOnly, opts)
+			if err != nil {
+				return errors.Wrapf(err, "unexpected error encoding secret %v/%v", secret.Namespace, secret.Name)
+			}
+
+			w.add(s)
+		}
+	}
+
+	content, err := w.bytes()
+	if err != nil {
+		return err
+	}
+
+	return writeOutput(fileName(auditSecretsFile, opts), content, opts)
+}
@@ -0,0 +1,61 @@
+package dump
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	api "k8s.io/kubernetes/pkg/api/v1"
+)
+
+func TestDumpSecretsAudit(t *testing.T) {
+	s := newFakeAPIServer()
+	defer s.Close()
+	for _, ns := range []string{"kube-system", "audit-secrets"} {
+		s.add(t, "namespaces", &api.Namespace{ObjectMeta: api.ObjectMeta{Name: ns}})
+	}
+	s.add(t, "secrets", &api.Secret{
+		ObjectMeta: api.ObjectMeta{
+			Name:              "dns-token",
+			Namespace:         "kube-system",
+			CreationTimestamp: unversioned.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC),
+		},
+		Type: api.SecretTypeServiceAccountToken,
+		Data: map[string][]byte{"token": []byte("secret")},
+	})
+	// the filters of the dump (the default --skip-names, --minimal) do not hide secrets of the audit
+	s.add(t, "secrets", &api.Secret{
+		ObjectMeta: api.ObjectMeta{
+			Name:        "kubernetes-dashboard-token-9ds2x",
+			Namespace:   "kube-system",
+			Annotations: map[string]string{api.ServiceAccountNameKey: "kubernetes-dashboard"},
+		},
+		Type: api.SecretTypeServiceAccountToken,
+	})
+	s.add(t, "configmaps", newTestConfigMap("audit-secrets", "settings"))
+
+	files := dumpTestCluster(t, s, func(o *Options) {
+		o.OnlyUserNamespaces = true
+		o.IncludeSystemSecretsMetadata = true
+		o.Minimal = true
+	})
+
+	audit := string(files["_audit-secrets.yaml"])
+	for _, field := range []string{"name: dns-token", "name: kubernetes-dashboard-token-9ds2x", "namespace: kube-system", "type: kubernetes.io/service-account-token",
+		creationTimestampAnnotation + ": 2017-01-02T03:04:05Z"} {
+		if !strings.Contains(audit, field) {
+			t.Errorf("expected %v in _audit-secrets.yaml, got\n%v", field, audit)
+		}
+	}
+	if strings.Contains(audit, "\ndata:") {
+		t.Errorf("expected only the metadata of the secrets, got\n%v", audit)
+	}
+
+	if namespace := string(files["audit-secrets.yaml"]); !strings.Contains(namespace, "name: settings") {
+		t.Errorf("expected the namespace audit-secrets in audit-secrets.yaml, got\n%v", namespace)
+	}
+	if _, ok := files["kube-system.yaml"]; ok {
+		t.Errorf("expected the namespace kube-system to be skipped")
+	}
+}
@@ -0,0 +1,121 @@
+package dump
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	k8s_errors "k8s.io/kubernetes/pkg/api/errors"
+	"k8s.io/kubernetes/pkg/api/meta"
+	client "k8s.io/kubernetes/pkg/client/clientset_generated/release_1_5"
+)
+
+// clusterFile name (without extension) of the file with the cluster-scoped objects
+const clusterFile = "_cluster"
+
+// dumpClusterScoped lists the cluster-scoped types once and writes the
+// objects to _cluster.yaml (or _cluster/<type>/<name>.yaml with the tree
+// layout). The problems found querying the types are
+// recorded in the result (without namespace) and in the header of the file.
+// A type that is not served by the apiserver is skipped
+func dumpClusterScoped(kubeClient *client.Clientset, opts *dumpOptions, dr *DumpResult) error {
+	mapping := newMappingFactoring()
+	types := []string{}
+	for _, objectType := range clusterScopedTypes {
+		if skipType(objectType, opts) {
+			opts.log.Debugf("", objectType, "skipping cluster-scoped type %v", objectType)
+			continue
+		}
+		types = append(types, objectType)
+	}
+
+	if len(types) == 0 {
+		return nil
+	}
+
+	opts.log.Infof("", "", "\tdumping cluster-scoped objects")
+
+	data := []*k8sObject{}
+	listed := []string{}
+	for _, objectType := range types {
+		result := mapping[objectType]
+		apiVersion, err := listType(kubeClient, "", objectType, result.Runtime, opts)
+		if err != nil {
+			switch {
+			case k8s_errors.IsNotFound(err):
+				opts.log.Debugf("", objectType, "type %v is not available in the cluster", objectType)
+			case k8s_errors.IsForbidden(err):
+				dr.AddForbidden("", objectType)
+			default:
+				dr.AddError("", objectType, err)
+			}
+			continue
+		}
+
+		err = sortItems(result.Runtime, opts.sortBy)
+		if err != nil {
+			return errors.Wrap(err, "unexpected error sorting items")
+		}
+
+		count, err := countObjects(result.Runtime, opts)
+		if err != nil {
+			return err
+		}
+		dr.addCount("", objectType, count)
+
+		result.APIVersion = apiVersion
+		data = append(data, result)
+		listed = append(listed, objectType)
+	}
+
+	if opts.listOnly {
+		return nil
+	}
+
+	objects := marshaledObjects{}
+	for i, result := range data {
+		err := objects.add("", listed[i], result, opts, dr)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.treeLayout {
+		for i, result := range data {
+			err := writeObjectFiles(fmt.Sprintf("%v/%v", clusterFile, sanitizePathSegment(listed[i])), result, objects, opts)
+			if err != nil {
+				return errors.Wrapf(err, "unexpected error writing the objects of type %v", listed[i])
+			}
+		}
+		return nil
+	}
+
+	header := new(bytes.Buffer)
+	header.WriteString("# errors:\n")
+	for _, msg := range dr.messagesFor("") {
+		header.WriteString(fmt.Sprintf("# %v\n", msg))
+	}
+	header.WriteString("\n# cluster-scoped objects\n")
+
+	w := newDocumentWriter(header.String(), opts)
+	for _, result := range data {
+		items, err := meta.ExtractList(result.Runtime)
+		if err != nil {
+			return errors.Wrap(err, "unexpected error extracting items")
+		}
+
+		for _, item := range items {
+			if s := objects[item]; s != "" {
+				w.add(s)
+			}
+		}
+	}
+
+	content, err := w.bytes()
+	if err != nil {
+		return err
+	}
+
+	return writeOutput(fileName(clusterFile, opts), content, opts)
+}
@@ -0,0 +1,170 @@
+package dump
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	unversioned_api "k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	api "k8s.io/kubernetes/pkg/api/v1"
+	client "k8s.io/kubernetes/pkg/client/clientset_generated/release_1_5"
+)
+
+// builtinGroups API groups served by the apiserver. The resources of these
+// groups are not discovered, the dumped types are listed in newMappingFactoring
+var builtinGroups = []string{"", "apps", "authentication.k8s.io", "authorization.k8s.io", "autoscaling", "batch",
+	"certificates.k8s.io", "componentconfig", "extensions", "federation", "imagepolicy.k8s.io", "policy",
+	"rbac.authorization.k8s.io", "storage.k8s.io"}
+
+// customResource is a namespaced resource found using the API discovery
+// that is not part of the static mapping (e.g. the objects of a third party resource)
+type customResource struct {
+	name         string
+	kind         string
+	groupVersion string
+}
+
+// discoverCustomResources returns the namespaced resources of the preferred
+// version of the groups that are not served by the apiserver itself.
+// The resources skipped by --skip-types/--include-types are not returned
+func discoverCustomResources(kubeClient *client.Clientset, opts *dumpOptions) ([]customResource, error) {
+	groups, err := kubeClient.Discovery().ServerGroups()
+	if err != nil {
+		return nil, errors.Wrap(err, "unexpected error obtaining the API groups")
+	}
+
+	mapping := newMappingFactoring()
+	resources := []customResource{}
+	for _, group := range groups.Groups {
+		if containsName(group.Name, builtinGroups) {
+			continue
+		}
+
+		groupVersion := group.PreferredVersion.GroupVersion
+		list, err := kubeClient.Discovery().ServerResourcesForGroupVersion(groupVersion)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unexpected error obtaining the resources of %v", groupVersion)
+		}
+
+		for _, resource := range list.APIResources {
+			// subresources (e.g. status) are not listed
+			if !resource.Namespaced || strings.Contains(resource.Name, "/") {
+				continue
+			}
+
+			if _, ok := mapping[resource.Name]; ok {
+				opts.log.Warningf("", resource.Name, "skipping resource %v of %v (the name is used by a dumped type)", resource.Name, groupVersion)
+				continue
+			}
+
+			if skipType(resource.Name, opts) {
+				opts.log.Debugf("", resource.Name, "skipping resource %v of %v", resource.Name, groupVersion)
+				continue
+			}
+
+			resources = append(resources, customResource{name: resource.Name, kind: resource.Kind, groupVersion: groupVersion})
+		}
+	}
+
+	return resources, nil
+}
+
+// typesMapping returns the static mapping of the dumped types with the
+// custom resources found using the API discovery
+func typesMapping(opts *dumpOptions) map[string]*k8sObject {
+	mapping := newMappingFactoring()
+	for _, resource := range opts.customResources {
+		mapping[resource.name] = &k8sObject{
+			Kind:    resource.kind,
+			Runtime: &customObjectList{groupVersion: resource.groupVersion},
+		}
+	}
+	return mapping
+}
+
+// listCustomResource lists the objects of a custom resource located in a namespace.
+// There is no Go type for the objects, the response is decoded as customObjectList.
+// The client accepts protobuf, which is not supported by the custom resources,
+// so the request asks for JSON
+func listCustomResource(kubeClient *client.Clientset, ns, objectType string, into *customObjectList, opts *dumpOptions) (string, error) {
+	err := withRetries(fmt.Sprintf("listing resource %v in %v", objectType, scope(ns)), opts, func() error {
+		raw, err := kubeClient.Core().RESTClient().Get().
+			SetHeader("Accept", "application/json").
+			AbsPath("/apis", into.groupVersion).
+			Namespace(ns).
+			Resource(objectType).
+			VersionedParams(&api.ListOptions{LabelSelector: opts.labelSelector, FieldSelector: opts.fieldSelector}, unversioned_api.ParameterCodec).
+			Timeout(opts.requestTimeout).
+			DoRaw()
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(raw, into)
+	})
+
+	return into.groupVersion, err
+}
+
+// customObjectList is the list of objects of a custom resource
+type customObjectList struct {
+	unversioned.TypeMeta `json:",inline"`
+	Items                []customObject `json:"items"`
+
+	// groupVersion of the resource (used to build the path of the requests)
+	groupVersion string
+}
+
+// customObject is an object of a custom resource. The metadata is decoded
+// so the object is processed like the dumped types, the rest of the
+// fields are kept as they were received
+type customObject struct {
+	api.ObjectMeta
+
+	fields map[string]interface{}
+}
+
+func (o *customObject) GetObjectKind() unversioned.ObjectKind {
+	return unversioned.EmptyObjectKind
+}
+
+// UnmarshalJSON decodes the metadata and the fields of the object.
+// The apiVersion and kind are removed, they are written by the printers
+func (o *customObject) UnmarshalJSON(data []byte) error {
+	var content struct {
+		Metadata api.ObjectMeta `json:"metadata"`
+	}
+	err := json.Unmarshal(data, &content)
+	if err != nil {
+		return err
+	}
+
+	// the numbers are kept as they were received
+	fields := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	err = decoder.Decode(&fields)
+	if err != nil {
+		return err
+	}
+	delete(fields, "apiVersion")
+	delete(fields, "kind")
+	delete(fields, "metadata")
+
+	o.ObjectMeta = content.Metadata
+	o.fields = fields
+	return nil
+}
+
+// MarshalJSON encodes the fields of the object with the current metadata
+func (o *customObject) MarshalJSON() ([]byte, error) {
+	content := map[string]interface{}{}
+	for k, v := range o.fields {
+		content[k] = v
+	}
+	content["metadata"] = o.ObjectMeta
+	return json.Marshal(content)
+}
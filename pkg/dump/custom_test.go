@@ -0,0 +1,91 @@
+package dump
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	api "k8s.io/kubernetes/pkg/api/v1"
+	client "k8s.io/kubernetes/pkg/client/clientset_generated/release_1_5"
+	restclient "k8s.io/kubernetes/pkg/client/restclient"
+)
+
+// serveWidgets serves the custom resource widgets of the group example.com
+// (the objects of custom resources can only be returned in JSON)
+func serveWidgets(w http.ResponseWriter, r *http.Request) bool {
+	switch r.URL.Path {
+	case "/apis":
+		list := []interface{}{}
+		for _, gv := range append(fakeGroupVersions, "example.com/v1") {
+			parts := strings.SplitN(gv, "/", 2)
+			version := map[string]interface{}{"groupVersion": gv, "version": parts[1]}
+			list = append(list, map[string]interface{}{"name": parts[0], "versions": []interface{}{version}, "preferredVersion": version})
+		}
+		writeFakeJSON(w, http.StatusOK, map[string]interface{}{"kind": "APIGroupList", "groups": list})
+	case "/apis/example.com/v1":
+		writeFakeJSON(w, http.StatusOK, map[string]interface{}{
+			"kind":         "APIResourceList",
+			"groupVersion": "example.com/v1",
+			"resources":    []interface{}{map[string]interface{}{"name": "widgets", "namespaced": true, "kind": "Widget"}},
+		})
+	case "/apis/example.com/v1/namespaces/web/widgets":
+		if strings.Contains(r.Header.Get("Accept"), "protobuf") {
+			writeFakeStatus(w, http.StatusNotAcceptable, "NotAcceptable", "only application/json is supported")
+			return true
+		}
+		writeFakeJSON(w, http.StatusOK, map[string]interface{}{
+			"kind":       "WidgetList",
+			"apiVersion": "example.com/v1",
+			"metadata":   map[string]interface{}{},
+			"items": []interface{}{map[string]interface{}{
+				"apiVersion": "example.com/v1",
+				"kind":       "Widget",
+				"metadata":   map[string]interface{}{"name": "blue", "namespace": "web", "resourceVersion": "3"},
+				"spec":       map[string]interface{}{"color": "blue"},
+			}},
+		})
+	default:
+		return false
+	}
+	return true
+}
+
+func TestDumpClusterCustomResourcesProtobufClient(t *testing.T) {
+	s := newFakeAPIServer()
+	defer s.Close()
+	s.add(t, "namespaces", &api.Namespace{ObjectMeta: api.ObjectMeta{Name: "web"}})
+	s.handle = serveWidgets
+
+	// the content type used by the command
+	kubeClient, err := client.NewForConfig(&restclient.Config{Host: s.URL, QPS: 1000, Burst: 1000,
+		ContentConfig: restclient.ContentConfig{ContentType: "application/vnd.kubernetes.protobuf"}})
+	if err != nil {
+		t.Fatalf("unexpected error creating the client: %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "dump")
+	if err != nil {
+		t.Fatalf("unexpected error creating a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := newTestOptions(dir)
+	opts.DiscoverCRDs = true
+	opts.IncludeTypes = []string{"widgets"}
+	result, err := DumpCluster(kubeClient, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Failed() {
+		t.Fatalf("unexpected errors in the dump: %v", result.Err())
+	}
+
+	dumped := string(readDumpFiles(t, dir)["web.yaml"])
+	for _, field := range []string{"# widgets\n", "apiVersion: example.com/v1\nkind: Widget\n", "name: blue", "color: blue"} {
+		if !strings.Contains(dumped, field) {
+			t.Errorf("expected %q in the dump, got\n%v", field, dumped)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package dump
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"k8s.io/kubernetes/pkg/runtime"
+)
+
+// lineBreakReplacer replaces the characters that yaml reads as line breaks
+// with \n, so every line of a value is written in its own comment line
+var lineBreakReplacer = strings.NewReplacer("\r\n", "\n", "\r", "\n", "\u2028", "\n", "\u2029", "\n")
+
+// decodedValuesComment returns a yaml comment with the decoded values of the
+// data of a secret, so the content can be read without changing the data.
+// Values that are not text are shown as <binary N bytes>, the values that
+// are not base64 as <invalid base64> and the redacted values are skipped
+func decodedValuesComment(obj runtime.Object) (string, error) {
+	var raw []byte
+	if unknown, ok := obj.(*runtime.Unknown); ok {
+		raw = unknown.Raw
+	} else {
+		var err error
+		raw, err = json.Marshal(obj)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	var secret struct {
+		Data map[string]string `json:"data"`
+	}
+	err := json.Unmarshal(raw, &secret)
+	if err != nil {
+		return "", err
+	}
+
+	if len(secret.Data) == 0 {
+		return "", nil
+	}
+
+	keys := []string{}
+	for key := range secret.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	buf := bytes.NewBufferString("# decoded data:\n")
+	decoded := 0
+	for _, key := range keys {
+		if secret.Data[key] == redactedValue {
+			continue
+		}
+		decoded++
+
+		value, err := base64.StdEncoding.DecodeString(secret.Data[key])
+		if err != nil {
+			buf.WriteString(fmt.Sprintf("#   %v: <invalid base64>\n", key))
+			continue
+		}
+		if !isText(value) {
+			buf.WriteString(fmt.Sprintf("#   %v: <binary %v bytes>\n", key, len(value)))
+			continue
+		}
+
+		text := lineBreakReplacer.Replace(string(value))
+		if !strings.Contains(text, "\n") {
+			buf.WriteString(fmt.Sprintf("#   %v: %v\n", key, text))
+			continue
+		}
+
+		buf.WriteString(fmt.Sprintf("#   %v: |\n", key))
+		for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+			buf.WriteString(fmt.Sprintf("#     %v\n", line))
+		}
+	}
+
+	if decoded == 0 {
+		return "", nil
+	}
+	return buf.String(), nil
+}
+
+// isText returns true if the value is valid UTF-8 without control
+// characters (other than tabs and line breaks)
+func isText(value []byte) bool {
+	if !utf8.Valid(value) {
+		return false
+	}
+
+	for _, r := range string(value) {
+		if unicode.IsControl(r) && r != '\n' && r != '\r' && r != '\t' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,75 @@
+package dump
+
+import (
+	"strings"
+	"testing"
+
+	api "k8s.io/kubernetes/pkg/api/v1"
+	"k8s.io/kubernetes/pkg/runtime"
+)
+
+func TestDecodedValuesComment(t *testing.T) {
+	secret := &api.Secret{
+		ObjectMeta: api.ObjectMeta{Name: "credentials", Namespace: "web"},
+		Data: map[string][]byte{
+			"binary":    {0x00, 0xff, 0x10, 0x02},
+			"crlf":      []byte("line 1\r\nline 2\r\n"),
+			"cr":        []byte("value\rkind: Injected"),
+			"separator": []byte("first\u2028second\u2029third"),
+			"user":      []byte("admin"),
+		},
+	}
+
+	comment, err := decodedValuesComment(secret)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "# decoded data:\n" +
+		"#   binary: <binary 4 bytes>\n" +
+		"#   cr: |\n" +
+		"#     value\n" +
+		"#     kind: Injected\n" +
+		"#   crlf: |\n" +
+		"#     line 1\n" +
+		"#     line 2\n" +
+		"#   separator: |\n" +
+		"#     first\n" +
+		"#     second\n" +
+		"#     third\n" +
+		"#   user: admin\n"
+	if comment != expected {
+		t.Errorf("expected the comment\n%q\ngot\n%q", expected, comment)
+	}
+}
+
+func TestDecodedValuesCommentRedacted(t *testing.T) {
+	// the redacted objects are decoded JSON with the values replaced
+	for raw, expected := range map[string]string{
+		`{"data":{"password":"<redacted>","token":"<redacted>"}}`:                                     "",
+		`{"data":{"password":"<redacted>","user":"YWRtaW4=","invalid":"not base64\rkind: Injected"}}`: "# decoded data:\n#   invalid: <invalid base64>\n#   user: admin\n",
+	} {
+		comment, err := decodedValuesComment(&runtime.Unknown{Raw: []byte(raw), ContentType: runtime.ContentTypeJSON})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if comment != expected {
+			t.Errorf("expected the comment %q for %v, got %q", expected, raw, comment)
+		}
+	}
+}
+
+func TestDecodeValuesRedactSecrets(t *testing.T) {
+	opts := newTestOptions("")
+	opts.DecodeValues = true
+	_, err := opts.complete()
+	if err == nil || !strings.Contains(err.Error(), "--decode-values requires --redact-secrets=false") {
+		t.Errorf("expected an error using --decode-values with the redacted secrets, got %v", err)
+	}
+
+	opts.RedactSecrets = false
+	dopts := completeTestOptions(t, opts)
+	if !dopts.decodeValues {
+		t.Errorf("expected the values of the secrets to be decoded")
+	}
+}
@@ -0,0 +1,159 @@
+package dump
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+
+	k8s_errors "k8s.io/kubernetes/pkg/api/errors"
+	api "k8s.io/kubernetes/pkg/api/v1"
+	"k8s.io/kubernetes/pkg/api/validation/path"
+	client "k8s.io/kubernetes/pkg/client/clientset_generated/release_1_5"
+	"k8s.io/kubernetes/pkg/util/validation"
+)
+
+// dryRunMinorVersion first minor version of Kubernetes 1 with dry-run requests
+const dryRunMinorVersion = 13
+
+// supportsDryRun returns true if the apiserver supports dry-run requests
+func supportsDryRun(kubeClient *client.Clientset) (bool, error) {
+	info, err := kubeClient.Discovery().ServerVersion()
+	if err != nil {
+		return false, errors.Wrap(err, "unexpected error obtaining the version of the apiserver")
+	}
+
+	// the versions of some providers end with + (e.g. 14+)
+	major, err := strconv.Atoi(strings.TrimSuffix(info.Major, "+"))
+	if err != nil {
+		return false, fmt.Errorf("invalid major version %q of the apiserver", info.Major)
+	}
+	minor, err := strconv.Atoi(strings.TrimSuffix(info.Minor, "+"))
+	if err != nil {
+		return false, fmt.Errorf("invalid minor version %q of the apiserver", info.Minor)
+	}
+
+	return major > 1 || (major == 1 && minor >= dryRunMinorVersion), nil
+}
+
+// dryRunObject sends an object to the apiserver with dryRun=All and returns
+// true if it would be created. The objects that already exist are skipped and
+// the rejected objects are recorded as errors with the reason of the apiserver
+func dryRunObject(kubeClient *client.Clientset, item restoreItem, opts RestoreOptions, result *RestoreResult) bool {
+	rc, err := clientForVersion(kubeClient, item.apiVersion)
+	if err != nil {
+		result.addError(errors.Wrapf(err, "unexpected error validating %v", item))
+		return false
+	}
+
+	body, err := requestBody(item, opts)
+	if err != nil {
+		result.addError(err)
+		return false
+	}
+
+	err = rc.Post().
+		NamespaceIfScoped(item.namespace, item.namespace != "").
+		Resource(item.objectType).
+		Param("dryRun", "All").
+		Body(body).
+		Do().
+		Error()
+
+	switch {
+	case err == nil:
+		glog.Infof("\tvalidated %v", item)
+		result.Created++
+		return true
+	case k8s_errors.IsAlreadyExists(err):
+		glog.Infof("\tskipping %v (already exists)", item)
+		result.Skipped++
+	default:
+		result.addError(fmt.Errorf("%v would be rejected: %v", item, err))
+	}
+	return false
+}
+
+// validateObject checks in the client the fields validated by the apiserver
+// in every kind: the name, the labels, the annotations and the keys of the data
+// of the configmaps and secrets. The rejected objects are recorded as errors
+func validateObject(item restoreItem, result *RestoreResult) {
+	problems, err := objectProblems(item)
+	if err != nil {
+		result.addError(errors.Wrapf(err, "unexpected error validating %v", item))
+		return
+	}
+
+	if len(problems) > 0 {
+		result.addError(fmt.Errorf("%v would be rejected: %v", item, strings.Join(problems, "; ")))
+		return
+	}
+
+	glog.Infof("\tvalidated %v", item)
+	result.Created++
+}
+
+// objectProblems returns the fields of an object that the apiserver rejects
+func objectProblems(item restoreItem) ([]string, error) {
+	objectMeta, err := objectMetaFor(item.obj)
+	if err != nil {
+		return nil, err
+	}
+
+	problems := []string{}
+	add := func(field string, msgs []string) {
+		for _, msg := range msgs {
+			problems = append(problems, fmt.Sprintf("%v: %v", field, msg))
+		}
+	}
+
+	// the same rules used by the apiserver for the names of each kind
+	switch item.objectType {
+	case "namespaces":
+		add("metadata.name", validation.IsDNS1123Label(objectMeta.Name))
+	case "services":
+		add("metadata.name", validation.IsDNS1035Label(objectMeta.Name))
+	case "clusterrolebindings", "clusterroles", "rolebindings", "roles":
+		add("metadata.name", path.IsValidPathSegmentName(objectMeta.Name))
+	default:
+		add("metadata.name", validation.IsDNS1123Subdomain(objectMeta.Name))
+	}
+
+	for _, key := range sortedKeys(objectMeta.Labels) {
+		add("metadata.labels", validation.IsQualifiedName(key))
+		add("metadata.labels", validation.IsValidLabelValue(objectMeta.Labels[key]))
+	}
+
+	for _, key := range sortedKeys(objectMeta.Annotations) {
+		add("metadata.annotations", validation.IsQualifiedName(strings.ToLower(key)))
+	}
+
+	keys := []string{}
+	switch o := item.obj.(type) {
+	case *api.ConfigMap:
+		keys = sortedKeys(o.Data)
+	case *api.Secret:
+		for key := range o.Data {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+	}
+	for _, key := range keys {
+		add("data", validation.IsConfigMapKey(key))
+	}
+
+	return problems, nil
+}
+
+// sortedKeys returns the keys of a map in alphabetical order
+func sortedKeys(m map[string]string) []string {
+	keys := []string{}
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
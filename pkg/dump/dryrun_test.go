@@ -0,0 +1,113 @@
+package dump
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	api "k8s.io/kubernetes/pkg/api/v1"
+)
+
+func TestRestoreDryRunServer(t *testing.T) {
+	s := newFakeAPIServer()
+	defer s.Close()
+	s.minor = "15"
+	s.add(t, "namespaces", &api.Namespace{ObjectMeta: api.ObjectMeta{Name: "default"}})
+	s.handle = func(w http.ResponseWriter, r *http.Request) bool {
+		// the admission of the cluster rejects a configmap
+		if r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/configmaps") && r.URL.Query().Get("dryRun") == "All" {
+			o, _ := readFakeObject(r)
+			if metadata, _ := o["metadata"].(map[string]interface{}); metadata["name"] == "rejected" {
+				writeFakeStatus(w, http.StatusForbidden, "Forbidden", `configmaps "rejected" is forbidden: denied by the policy`)
+				return true
+			}
+			writeFakeObject(w, http.StatusCreated, fakeRequest{apiVersion: "v1", objectType: "configmaps"}, o)
+			return true
+		}
+		return false
+	}
+
+	objects := []map[string]interface{}{
+		newTestObject("ConfigMap", "v1", "default", "accepted"),
+		newTestObject("ConfigMap", "v1", "default", "rejected"),
+	}
+	result := Restore(s.client(t), objects, RestoreOptions{DryRunServer: true})
+
+	if result.Created != 1 || len(result.Errors) != 1 {
+		t.Fatalf("expected 1 object validated and 1 rejected, got %v validated and errors %v", result.Created, result.Errors)
+	}
+	if !strings.Contains(result.Errors[0], "configmaps/default/rejected would be rejected") ||
+		!strings.Contains(result.Errors[0], "denied by the policy") {
+		t.Errorf("expected the reason of the rejected object, got %v", result.Errors[0])
+	}
+	if s.object("configmaps", "default", "accepted") != nil {
+		t.Errorf("the objects must not be created in a dry run")
+	}
+}
+
+func TestRestoreDryRunServerNewNamespace(t *testing.T) {
+	s := newFakeAPIServer()
+	defer s.Close()
+	s.minor = "15"
+
+	objects := []map[string]interface{}{
+		newTestObject("ConfigMap", "v1", "new", "settings"),
+	}
+	result := Restore(s.client(t), objects, RestoreOptions{DryRunServer: true})
+
+	// the namespace is sent to the apiserver and the configmap is validated by the client
+	if result.Created != 2 || result.Failed() {
+		t.Fatalf("expected 2 objects validated, got %v (errors %v)", result.Created, result.Errors)
+	}
+	posts := s.received("POST")
+	if len(posts) != 1 || posts[0] != "POST /api/v1/namespaces" {
+		t.Errorf("expected only the namespace sent to the apiserver, got %v", posts)
+	}
+	if s.object("namespaces", "", "new") != nil {
+		t.Errorf("the namespace must not be created in a dry run")
+	}
+}
+
+func TestRestoreDryRunServerClientValidation(t *testing.T) {
+	s := newFakeAPIServer()
+	defer s.Close()
+	s.minor = "12"
+	s.add(t, "namespaces", &api.Namespace{ObjectMeta: api.ObjectMeta{Name: "default"}})
+
+	invalid := newTestObject("ConfigMap", "v1", "default", "Invalid_Name")
+	invalid["metadata"].(map[string]interface{})["labels"] = map[string]interface{}{"app": "not valid"}
+	objects := []map[string]interface{}{
+		newTestObject("ConfigMap", "v1", "default", "valid"),
+		newTestObject("ClusterRole", "rbac.authorization.k8s.io/v1alpha1", "", "system:valid"),
+		invalid,
+	}
+	result := Restore(s.client(t), objects, RestoreOptions{DryRunServer: true})
+
+	if len(s.received("POST")) != 0 {
+		t.Errorf("expected no objects sent to an apiserver without dry-run, got %v", s.received("POST"))
+	}
+	if result.Created != 3 || len(result.Errors) != 1 {
+		t.Fatalf("expected 3 objects validated and 1 rejected, got %v validated and errors %v", result.Created, result.Errors)
+	}
+	for _, field := range []string{"metadata.name", "metadata.labels"} {
+		if !strings.Contains(result.Errors[0], field) {
+			t.Errorf("expected the error of %v, got %v", field, result.Errors[0])
+		}
+	}
+}
+
+func TestSupportsDryRun(t *testing.T) {
+	s := newFakeAPIServer()
+	defer s.Close()
+
+	for minor, expected := range map[string]bool{"5": false, "12": false, "13": true, "14+": true} {
+		s.minor = minor
+		supported, err := supportsDryRun(s.client(t))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if supported != expected {
+			t.Errorf("expected dry-run support %v for 1.%v, got %v", expected, minor, supported)
+		}
+	}
+}
@@ -0,0 +1,1369 @@
+package dump
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	text_template "text/template"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+
+	unversioned_api "k8s.io/kubernetes/pkg/api"
+	k8s_errors "k8s.io/kubernetes/pkg/api/errors"
+	"k8s.io/kubernetes/pkg/api/meta"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	api "k8s.io/kubernetes/pkg/api/v1"
+	apps "k8s.io/kubernetes/pkg/apis/apps/v1beta1"
+	autoscalingapiv1 "k8s.io/kubernetes/pkg/apis/autoscaling/v1"
+	batch "k8s.io/kubernetes/pkg/apis/batch/v1"
+	extensions "k8s.io/kubernetes/pkg/apis/extensions/v1beta1"
+	rbac "k8s.io/kubernetes/pkg/apis/rbac/v1alpha1"
+	storage "k8s.io/kubernetes/pkg/apis/storage/v1beta1"
+	client "k8s.io/kubernetes/pkg/client/clientset_generated/release_1_5"
+	restclient "k8s.io/kubernetes/pkg/client/restclient"
+	"k8s.io/kubernetes/pkg/conversion"
+	"k8s.io/kubernetes/pkg/runtime"
+)
+
+// template renders the yaml file of a namespace
+const template = `
+# errors:
+{{ range $i, $v := .notFound }}
+# {{ $v }}{{ end }}
+
+{{ with objectToYaml "Namespace" "v1" .namespace -}}
+# namespace
+{{ if $.leadingSeparator }}{{ $.separator }}
+{{ end -}}
+{{ . -}}
+{{ end -}}
+{{ template "iterate" . }}
+{{ define "iterate" }}
+{{- $separator := .separator }}
+{{- range $k, $v := .types }}
+{{- if ne (len $v.Runtime.Items) 0 }}
+# {{ $k }}
+{{- range $item := $v.Runtime.Items }}
+{{- with objectToYaml $v.Kind $v.APIVersion $item }}
+{{ $separator }}
+{{ . }}
+{{- end }}
+{{- end }}
+{{- end }}
+{{- end }}
+{{- end }}
+`
+
+// dumpOptions contains the settings used to extract and render the objects
+type dumpOptions struct {
+	// log writes the messages of the dump
+	log *Logger
+	// output directory where the dump files should be created
+	output string
+	// skipNames objects with a name that fulfill the regex are not dumped
+	skipNames *regexp.Regexp
+	// excludeAnnotation objects with the annotation are not dumped
+	excludeAnnotation *annotationFilter
+	// skipTypes types to skip in the dump
+	skipTypes []string
+	// includeTypes if not empty only these types are dumped
+	includeTypes []string
+	// redactRules fields to redact per kind
+	redactRules []redactRule
+	// maxObjectSize size in bytes after which a warning is logged
+	maxObjectSize int
+	// namespaceFilters filters applied to the namespaces when the whole cluster is dumped
+	namespaceFilters []namespaceFilter
+	// dumpNodeInfo dumps the nodes of the cluster
+	dumpNodeInfo bool
+	// stripStatus removes volatile status information
+	stripStatus bool
+	// maxItemsPerType number of items in a type after which the type is skipped
+	maxItemsPerType int
+	// lineEndings line endings used in the dump files (lf or crlf)
+	lineEndings string
+	// bom writes a UTF-8 byte order mark at the beginning of the dump files
+	bom bool
+	// keepStatusFor kinds that should keep the status section
+	keepStatusFor []string
+	// includeSystemSecretsMetadata lists the secrets located in skipped namespaces
+	includeSystemSecretsMetadata bool
+	// gitopsLayout creates a directory per namespace with one file per type
+	gitopsLayout bool
+	// stripContainerNames patterns of container names to remove from the pod templates
+	stripContainerNames []string
+	// hashIndex if not nil the namespace files are named using the SHA256 of the content
+	hashIndex *hashIndex
+	// preflight checks the permissions of the current identity before the dump
+	preflight bool
+	// partialWrites writes the namespace file even if some of the types cannot be queried
+	partialWrites bool
+	// sortBy order of the objects of each type (name or created)
+	sortBy string
+	// documentSeparator separator between the yaml documents
+	documentSeparator string
+	// leadingSeparator writes the separator before the first document
+	leadingSeparator bool
+	// annotateResourceVersion writes the resourceVersion in a comment
+	annotateResourceVersion bool
+	// collectLogs writes the logs of the containers of each namespace
+	collectLogs bool
+	// logTailLines number of lines of the logs to collect
+	logTailLines int64
+	// logsIncludeCompleted collects the logs of completed pods
+	logsIncludeCompleted bool
+	// transformExec command used to transform each object
+	transformExec string
+	// transformTimeout maximum time for each invocation of transformExec
+	transformTimeout time.Duration
+	// skipDefaultTokens removes the references to generated tokens from the service accounts
+	skipDefaultTokens bool
+	// minimal clears the fields assigned by the apiserver (cluster IPs, node ports, generated tokens and empty strings)
+	minimal bool
+	// pvReclaimPolicy replaces the reclaim policy of the persistent volumes
+	pvReclaimPolicy string
+	// pvClearCloudSource removes the cloud provider sources from the persistent volumes
+	pvClearCloudSource bool
+	// fieldStripper if not nil removes fields from the objects
+	fieldStripper *fieldStripper
+	// replaceImagePullSecrets name of the secret that replaces the image pull secrets
+	replaceImagePullSecrets string
+	// clearImagePullSecrets removes the image pull secrets
+	clearImagePullSecrets bool
+	// listOutputPlan prints the paths of the files instead of dumping the namespaces
+	listOutputPlan bool
+	// fileMode mode of the files written
+	fileMode os.FileMode
+	// dirMode mode of the directories created
+	dirMode os.FileMode
+	// secure is set when the files are only accessible by the user
+	secure bool
+	// listOnly lists the objects and prints the number of objects of each type instead of writing the files
+	listOnly bool
+	// progress writes the number of namespaces completed to stderr
+	progress bool
+	// withReferences adds the objects referenced by the ingresses and deployments
+	withReferences bool
+	// failIfExists fails the dump if any file of the dump already exists instead of replacing it
+	failIfExists bool
+	// sizeBudget if not nil tracks the bytes written when --max-total-size is set
+	sizeBudget *sizeBudget
+	// perObjectFiles creates a directory per namespace with one file per object
+	perObjectFiles bool
+	// treeLayout creates a directory per namespace and type with one file per object
+	treeLayout bool
+	// outputFormat format of the dump files (yaml or json)
+	outputFormat string
+	// concurrency number of namespaces dumped at the same time
+	concurrency int
+	// typeConcurrency number of types of a namespace listed at the same time
+	typeConcurrency int
+	// listSlots limits the list requests in flight to the concurrency
+	listSlots chan struct{}
+	// stdout if not nil collects the files to write them to the standard output
+	stdout *stdoutBuffer
+	// labelSelector if not empty only the objects matching the selector are dumped
+	labelSelector string
+	// discoverCustomResources dumps the namespaced resources found using the API discovery
+	discoverCustomResources bool
+	// customResources resources found using the API discovery
+	customResources []customResource
+	// servedVersions group versions served by the apiserver (nil if unknown)
+	servedVersions map[string]bool
+	// unservedTypes types without any of the supported versions served by the apiserver
+	unservedTypes map[string]bool
+	// decodeValues adds a comment with the decoded values of the secrets
+	decodeValues bool
+	// eventsSince if greater than 0 only the events that occurred in this period are dumped
+	eventsSince time.Duration
+	// keepStatus keeps the status section of all the kinds
+	keepStatus bool
+	// skipOwned skips the objects managed by a controller
+	skipOwned bool
+	// fieldSelector if not empty only the objects matching the selector are dumped.
+	// Each resource supports different fields, the apiserver rejects the others
+	fieldSelector string
+	// manifest collects the SHA-256 of the files written (nil when the dump is written to the standard output)
+	manifest *manifest
+	// archivePath if not empty the files are written to this tar.gz archive
+	archivePath string
+	// compressLevel gzip compression level of the archive
+	compressLevel int
+	// archive writes the files to the archive (created when the dump starts)
+	archive *archiveWriter
+	// template renders the namespace files in yaml
+	template *text_template.Template
+	// maxRetries number of times a list call is retried after a transient error
+	maxRetries int
+	// retryInterval wait before the first retry (doubled after each attempt)
+	retryInterval time.Duration
+	// requestTimeout maximum time for each list or get request (0 means no limit)
+	requestTimeout time.Duration
+	// interrupt is closed to stop the dump
+	interrupt <-chan struct{}
+}
+
+// dump extracts information from a Kubernetes cluster and creates multiple
+// files (one per namespace) with the content
+func dumpCluster(kubeClient *client.Clientset, namespaces []string, opts *dumpOptions) *DumpResult {
+	result := &DumpResult{selector: describeSelectors(opts), log: opts.log, started: time.Now()}
+
+	var selected []*api.Namespace
+	var skipped []string
+	if len(namespaces) > 0 {
+		selected = requestedNamespaces(kubeClient, namespaces, opts, result)
+	} else {
+		nss, err := kubeClient.Namespaces().List(api.ListOptions{})
+		if err != nil {
+			result.AddError("", "", errors.Wrap(err, "unexpected error obtaining information about the namespaces"))
+			return result
+		}
+
+		selected, skipped = selectNamespaces(nss.Items, opts)
+		if len(selected) == 0 {
+			opts.log.Warningf("", "", "no namespaces to dump (the cluster returned %v namespaces)", len(nss.Items))
+		}
+	}
+
+	names := []string{}
+	for _, ns := range selected {
+		names = append(names, ns.Name)
+	}
+
+	var err error
+
+	opts.servedVersions, err = discoverServedVersions(kubeClient)
+	if err != nil {
+		opts.log.Warningf("", "", "%v, using the default version of each type", err)
+	} else {
+		opts.unservedTypes = unservedTypes(opts)
+	}
+
+	if opts.discoverCustomResources {
+		opts.customResources, err = discoverCustomResources(kubeClient, opts)
+		if err != nil {
+			result.AddError("", "", err)
+			return result
+		}
+		opts.log.Debugf("", "", "found %v custom resources", len(opts.customResources))
+	}
+
+	if opts.listOutputPlan {
+		for _, path := range outputPlan(names, skipped, opts) {
+			fmt.Println(path)
+		}
+		return result
+	}
+
+	if opts.failIfExists && opts.archive == nil && opts.stdout == nil && !opts.listOnly {
+		// nothing is written if any file of the dump exists
+		existing := existingOutputFiles(outputPlan(names, skipped, opts), opts)
+		if len(existing) > 0 {
+			result.AddError("", "", fmt.Errorf("%v files of the dump already exist (%v)",
+				len(existing), strings.Join(existing, ", ")))
+			return result
+		}
+	}
+
+	opts.log.Infof("", "", "Dumping cluster objects...")
+	if opts.dumpNodeInfo && !opts.listOnly {
+		err := dumpNodes(kubeClient, opts)
+		if err != nil {
+			result.AddError("", "", errors.Wrap(err, "unexpected error dumping nodes"))
+		}
+	}
+
+	err = dumpClusterScoped(kubeClient, opts, result)
+	if err != nil {
+		result.AddError("", "", errors.Wrap(err, "unexpected error dumping cluster-scoped objects"))
+	}
+
+	if opts.preflight {
+		runPreflight(kubeClient, names, opts)
+	}
+
+	var p *progress
+	if opts.progress {
+		p = newProgress(os.Stderr, len(selected), result.started)
+	}
+
+	// notStarted records a namespace that is not dumped because the dump was interrupted
+	notStarted := func(ns string) {
+		result.AddNotStarted(ns)
+		p.namespaceDone()
+		if opts.stdout != nil {
+			opts.stdout.done(ns)
+		}
+	}
+
+	// the namespaces are dumped by a fixed number of workers
+	queue := make(chan *api.Namespace)
+	var wg sync.WaitGroup
+	for i := 0; i < opts.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ns := range queue {
+				if interrupted(opts) {
+					notStarted(ns.Name)
+					continue
+				}
+
+				start := time.Now()
+				err := dumpNamespace(kubeClient, ns, opts, result)
+				if err != nil {
+					result.AddError(ns.Name, "", err)
+				}
+				if opts.stdout != nil {
+					opts.stdout.done(ns.Name)
+				}
+
+				elapsed := time.Since(start)
+				opts.log.Infof(ns.Name, "", "\tnamespace %v dumped in %v (%v objects)",
+					ns.Name, truncateDuration(elapsed, time.Millisecond), result.objectsIn(ns.Name))
+				p.namespaceDone()
+			}
+		}()
+	}
+
+	if opts.stdout != nil {
+		opts.stdout.expect(names)
+	}
+
+	for _, ns := range selected {
+		result.AddNamespace(ns.Name)
+		select {
+		case queue <- ns:
+		case <-opts.interrupt:
+			notStarted(ns.Name)
+		}
+	}
+	close(queue)
+
+	wg.Wait()
+	p.close()
+
+	if interrupted(opts) {
+		result.AddError("", "", fmt.Errorf("the dump was interrupted, %v namespaces were not started", result.notStartedCount()))
+	}
+
+	if opts.listOnly {
+		err := result.writeCounts(os.Stdout)
+		if err != nil {
+			result.AddError("", "", errors.Wrap(err, "unexpected error writing the number of objects"))
+		}
+		return result
+	}
+
+	if opts.hashIndex != nil {
+		err := opts.hashIndex.write(opts)
+		if err != nil {
+			result.AddError("", "", errors.Wrap(err, "unexpected error writing index"))
+		}
+	}
+
+	if opts.includeSystemSecretsMetadata {
+		err := dumpSecretsAudit(kubeClient, skipped, opts)
+		if err != nil {
+			result.AddError("", "", errors.Wrap(err, "unexpected error auditing secrets"))
+		}
+	}
+
+	if opts.stdout == nil {
+		err := writeSummary(result, opts)
+		if err != nil {
+			result.AddError("", "", errors.Wrap(err, "unexpected error writing summary"))
+		}
+	}
+
+	if opts.manifest != nil {
+		err := opts.manifest.write(opts)
+		if err != nil {
+			result.AddError("", "", errors.Wrap(err, "unexpected error writing manifest"))
+		}
+	}
+
+	if opts.stdout != nil {
+		err := opts.stdout.flush(os.Stdout, result, opts)
+		if err != nil {
+			result.AddError("", "", errors.Wrap(err, "unexpected error writing to the standard output"))
+		}
+	}
+
+	if opts.fieldStripper != nil {
+		for _, path := range opts.fieldStripper.unmatched() {
+			opts.log.Warningf("", "", "the field %v was not found in any object", path)
+		}
+	}
+
+	return result
+}
+
+// interrupted returns true if the dump was interrupted
+func interrupted(opts *dumpOptions) bool {
+	select {
+	case <-opts.interrupt:
+		return true
+	default:
+		return false
+	}
+}
+
+// describeSelectors returns the label and field selectors used to list the
+// objects, separated by commas
+func describeSelectors(opts *dumpOptions) string {
+	selectors := []string{}
+	for _, selector := range []string{opts.labelSelector, opts.fieldSelector} {
+		if selector != "" {
+			selectors = append(selectors, selector)
+		}
+	}
+	return strings.Join(selectors, ",")
+}
+
+// countTrue returns the number of values that are true
+func countTrue(values ...bool) int {
+	n := 0
+	for _, v := range values {
+		if v {
+			n++
+		}
+	}
+	return n
+}
+
+// requestedNamespaces returns the namespaces of the list that exist in the
+// cluster, in the order of the list. The missing namespaces are skipped with a warning
+func requestedNamespaces(kubeClient *client.Clientset, namespaces []string, opts *dumpOptions, dr *DumpResult) []*api.Namespace {
+	selected := []*api.Namespace{}
+	for _, name := range namespaces {
+		ns, err := kubeClient.Namespaces().Get(name)
+		switch {
+		case k8s_errors.IsNotFound(err):
+			opts.log.Warningf(name, "", "namespace %v does not exist, skipping", name)
+			continue
+		case err != nil:
+			dr.AddError(name, "", errors.Wrapf(err, "unexpected error obtaining information about the namespace %v", name))
+			continue
+		case ns.Status.Phase == api.NamespaceTerminating:
+			opts.log.Infof(name, "", "skiping namespace %v (is being terminated)", name)
+			continue
+		}
+
+		selected = append(selected, ns)
+	}
+
+	if len(selected) == 0 {
+		opts.log.Warningf("", "", "no namespaces to dump (none of the %v namespaces requested exists)", len(namespaces))
+	}
+
+	return selected
+}
+
+// selectNamespaces returns the namespaces to dump and the names of the
+// namespaces skipped by the filters
+func selectNamespaces(nss []api.Namespace, opts *dumpOptions) ([]*api.Namespace, []string) {
+	skipped := []string{}
+	selected := []*api.Namespace{}
+	for i := range nss {
+		ns := &nss[i]
+		if ns.Status.Phase == api.NamespaceTerminating {
+			opts.log.Infof(ns.Name, "", "skiping namespace %v (is being terminated)", ns.Name)
+			continue
+		}
+
+		if skipNamespace(ns, opts.namespaceFilters) {
+			opts.log.Infof(ns.Name, "", "skiping namespace %v", ns.Name)
+			skipped = append(skipped, ns.Name)
+			continue
+		}
+
+		selected = append(selected, ns)
+	}
+
+	return selected, skipped
+}
+
+func newMappingFactoring() map[string]*k8sObject {
+	return map[string]*k8sObject{
+		"clusterrolebindings": &k8sObject{
+			Kind:    "ClusterRoleBinding",
+			Runtime: &rbac.ClusterRoleBindingList{},
+		},
+		"clusterroles": &k8sObject{
+			Kind:    "ClusterRole",
+			Runtime: &rbac.ClusterRoleList{},
+		},
+		"configmaps": &k8sObject{
+			Kind:    "ConfigMap",
+			Runtime: &api.ConfigMapList{},
+		},
+		"daemonsets": &k8sObject{
+			Kind:    "DaemonSet",
+			Runtime: &extensions.DaemonSetList{},
+		},
+		"deployments": &k8sObject{
+			Kind:    "Deployment",
+			Runtime: &extensions.DeploymentList{},
+		},
+		"endpoints": &k8sObject{
+			Kind:    "Endpoints",
+			Runtime: &api.EndpointsList{},
+		},
+		"events": &k8sObject{
+			Kind:    "Event",
+			Runtime: &api.EventList{},
+		},
+		"horizontalpodautoscalers": &k8sObject{
+			Kind:    "HorizontalPodAutoscaler",
+			Runtime: &autoscalingapiv1.HorizontalPodAutoscalerList{},
+		},
+		"ingresses": &k8sObject{
+			Kind:    "Ingress",
+			Runtime: &extensions.IngressList{},
+		},
+		"jobs": &k8sObject{
+			Kind:    "Job",
+			Runtime: &batch.JobList{},
+		},
+		"limitranges": &k8sObject{
+			Kind:    "LimitRange",
+			Runtime: &api.LimitRangeList{},
+		},
+		"networkpolicies": &k8sObject{
+			Kind:    "NetworkPolicy",
+			Runtime: &extensions.NetworkPolicyList{},
+		},
+		"persistentvolumeclaims": &k8sObject{
+			Kind:    "PersistentVolumeClaim",
+			Runtime: &api.PersistentVolumeClaimList{},
+		},
+		"persistentvolumes": &k8sObject{
+			Kind:    "PersistentVolume",
+			Runtime: &api.PersistentVolumeList{},
+		},
+		"pods": &k8sObject{
+			Kind:    "Pod",
+			Runtime: &api.PodList{},
+		},
+		"podsecuritypolicies": &k8sObject{
+			Kind:    "PodSecurityPolicy",
+			Runtime: &extensions.PodSecurityPolicyList{},
+		},
+		"podtemplates": &k8sObject{
+			Kind:    "PodTemplate",
+			Runtime: &api.PodTemplateList{},
+		},
+		"replicasets": &k8sObject{
+			Kind:    "ReplicaSet",
+			Runtime: &extensions.ReplicaSetList{},
+		},
+		"replicationcontrollers": &k8sObject{
+			Kind:    "ReplicationController",
+			Runtime: &api.ReplicationControllerList{},
+		},
+		"resourcequotas": &k8sObject{
+			Kind:    "ResourceQuota",
+			Runtime: &api.ResourceQuotaList{},
+		},
+		"services": &k8sObject{
+			Kind:    "Service",
+			Runtime: &api.ServiceList{},
+		},
+		"rolebindings": &k8sObject{
+			Kind:    "RoleBinding",
+			Runtime: &rbac.RoleBindingList{},
+		},
+		"roles": &k8sObject{
+			Kind:    "Role",
+			Runtime: &rbac.RoleList{},
+		},
+		"secrets": &k8sObject{
+			Kind:    "Secret",
+			Runtime: &api.SecretList{},
+		},
+		"serviceaccounts": &k8sObject{
+			Kind:    "ServiceAccount",
+			Runtime: &api.ServiceAccountList{},
+		},
+		"statefulsets": &k8sObject{
+			Kind:    "StatefulSet",
+			Runtime: &apps.StatefulSetList{},
+		},
+		"storageclasses": &k8sObject{
+			Kind:    "StorageClass",
+			Runtime: &storage.StorageClassList{},
+		},
+		"thirdpartyresources": &k8sObject{
+			Kind:    "ThirdPartyResource",
+			Runtime: &extensions.ThirdPartyResourceList{},
+		},
+	}
+}
+
+// sortedTypes returns the names of the types of a mapping in alphabetical order.
+// The types are always iterated in this order so two dumps of the same
+// cluster produce the same files and logs
+func sortedTypes(mapping map[string]*k8sObject) []string {
+	types := []string{}
+	for objectType := range mapping {
+		types = append(types, objectType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+type k8sObject struct {
+	APIVersion string
+	Kind       string
+	Runtime    runtime.Object
+}
+
+// dumpNamespace extracts information about Kubernetes objects located in a
+// particular namespace and writes the files with the layout of the options.
+func dumpNamespace(kubeClient *client.Clientset, namespace *api.Namespace, opts *dumpOptions, dr *DumpResult) error {
+	ns := namespace.Name
+	if opts.sizeBudget.exceeded() {
+		dr.AddOverBudget(ns)
+		return nil
+	}
+
+	opts.log.Infof(ns, "", "\tdumping namespace %v", ns)
+
+	data, err := queryNamespace(kubeClient, ns, opts, dr)
+	if err != nil {
+		return err
+	}
+
+	if data == nil {
+		opts.log.Warningf(ns, "", "namespace %v was deleted during the dump, skipping", ns)
+		dr.AddDeleted(ns)
+		return nil
+	}
+
+	if opts.listOnly {
+		// the objects were counted in the result
+		return nil
+	}
+
+	if opts.collectLogs {
+		err = collectPodLogs(kubeClient, ns, opts)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.sizeBudget.exceeded() {
+		opts.log.Warningf(ns, "", "skipping namespace %v (the maximum total size was exceeded)", ns)
+		dr.AddOverBudget(ns)
+		return nil
+	}
+
+	objects, err := marshalNamespace(namespace, data, opts, dr)
+	if err != nil {
+		return err
+	}
+
+	notFound := dr.messagesFor(ns)
+	if opts.gitopsLayout {
+		return writeGitOpsLayout(namespace, data, objects, notFound, opts)
+	}
+
+	if opts.perObjectFiles || opts.treeLayout {
+		return writeObjectLayout(namespace, data, objects, notFound, opts)
+	}
+
+	name := fileName(sanitizePathSegment(ns), opts)
+	if opts.outputFormat == "yaml" && opts.hashIndex == nil && opts.stdout == nil && opts.archive == nil {
+		// the file is written while it is rendered instead of
+		// keeping the content of the whole namespace in memory
+		return streamOutput(name, func(w io.Writer) error {
+			return executeTemplate(w, namespace, data, objects, notFound, opts)
+		}, opts)
+	}
+
+	if opts.stdout != nil {
+		// the Namespace objects lead the stream, so they are
+		// created before the objects they contain
+		opts.stdout.addNamespace(ns, objects[namespace])
+		delete(objects, namespace)
+	}
+
+	out, err := renderNamespace(namespace, data, objects, notFound, opts)
+	if err != nil {
+		return err
+	}
+
+	if opts.stdout != nil {
+		opts.sizeBudget.add(int64(len(out)))
+		opts.stdout.addNamespaceFile(ns, out)
+		return nil
+	}
+
+	if opts.hashIndex != nil {
+		name = hashName(out, opts)
+		opts.hashIndex.add(ns, name)
+	}
+
+	return writeOutput(name, out, opts)
+}
+
+// queryNamespace lists the objects of each type located in a namespace
+// (opts.typeConcurrency types at the same time).
+// The problems found querying the types are recorded in the result.
+// If every type returns NotFound and the namespace no longer exists
+// the returned data is nil
+func queryNamespace(kubeClient *client.Clientset, ns string, opts *dumpOptions, dr *DumpResult) (map[string]interface{}, error) {
+	mapping := typesMapping(opts)
+	types := []string{}
+	for _, objectType := range sortedTypes(mapping) {
+		if isClusterScoped(objectType) {
+			continue
+		}
+
+		if skipType(objectType, opts) {
+			opts.log.Debugf(ns, objectType, "skipping type %v in namespace %v", objectType, ns)
+			continue
+		}
+
+		types = append(types, objectType)
+	}
+
+	var (
+		mu       sync.Mutex
+		data     = make(map[string]interface{})
+		listed   = 0
+		missing  = 0
+		firstErr error
+	)
+
+	queue := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < opts.typeConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for objectType := range queue {
+				query, err := queryType(kubeClient, ns, objectType, mapping[objectType], opts, dr)
+
+				mu.Lock()
+				switch {
+				case err != nil:
+					if firstErr == nil {
+						firstErr = err
+					}
+				case query.notFound:
+					missing++
+				case query.listed:
+					listed++
+				}
+				if err == nil && query.object != nil {
+					data[objectType] = query.object
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, objectType := range types {
+		queue <- objectType
+	}
+	close(queue)
+
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	if listed == 0 && missing > 0 {
+		// every type returned NotFound, check if the namespace still exists
+		_, err := kubeClient.Namespaces().Get(ns)
+		if k8s_errors.IsNotFound(err) {
+			return nil, nil
+		}
+	}
+
+	if opts.withReferences {
+		err := addReferences(kubeClient, ns, data, opts, dr)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return data, nil
+}
+
+// typeQuery is the outcome of listing a type in a namespace
+type typeQuery struct {
+	// listed is true if the apiserver returned the objects
+	listed bool
+	// notFound is true if the apiserver returned NotFound
+	notFound bool
+	// object is the list of objects to render (nil if the type is not dumped)
+	object *k8sObject
+}
+
+// queryType lists the objects of a type located in a namespace. The
+// problems found are recorded in the result, an error is returned only when
+// the dump of the namespace must fail
+func queryType(kubeClient *client.Clientset, ns, objectType string, result *k8sObject, opts *dumpOptions, dr *DumpResult) (typeQuery, error) {
+	query := typeQuery{}
+
+	if list := listForVersion(objectType, servedAPIVersion(objectType, opts)); list != nil {
+		result.Runtime = list
+	}
+
+	apiVersion, err := listType(kubeClient, ns, objectType, result.Runtime, opts)
+	if err != nil {
+		switch {
+		case k8s_errors.IsNotFound(err):
+			dr.AddNotFound(ns, objectType)
+			query.notFound = true
+		case k8s_errors.IsForbidden(err):
+			dr.AddForbidden(ns, objectType)
+			return query, nil
+		case k8s_errors.IsBadRequest(err) && opts.fieldSelector != "":
+			// the field selector is not supported by this type
+			dr.AddError(ns, objectType, err)
+			return query, nil
+		case !opts.partialWrites:
+			return query, errors.Wrapf(err, "unexpected error querying type %v", objectType)
+		default:
+			dr.AddError(ns, objectType, err)
+			return query, nil
+		}
+	} else {
+		query.listed = true
+	}
+
+	if events, ok := result.Runtime.(*api.EventList); ok && opts.eventsSince > 0 {
+		filterEvents(events, time.Now().Add(-opts.eventsSince))
+	}
+
+	err = sortItems(result.Runtime, opts.sortBy)
+	if err != nil {
+		return query, errors.Wrap(err, "unexpected error sorting items")
+	}
+
+	if opts.maxItemsPerType > 0 {
+		items, err := meta.ExtractList(result.Runtime)
+		if err != nil {
+			return query, errors.Wrap(err, "unexpected error extracting items")
+		}
+
+		if len(items) > opts.maxItemsPerType {
+			opts.log.Warningf(ns, objectType, "skipping type %v in namespace %v (%v items)", objectType, ns, len(items))
+			dr.addSkipped(ns, objectType, fmt.Sprintf("contains %v objects (more than %v)", len(items), opts.maxItemsPerType))
+			return query, nil
+		}
+	}
+
+	count, err := countObjects(result.Runtime, opts)
+	if err != nil {
+		return query, err
+	}
+	dr.addCount(ns, objectType, count)
+
+	result.APIVersion = apiVersion
+	query.object = result
+	return query, nil
+}
+
+// listType lists the objects of a type located in a namespace (or in the
+// whole cluster when ns is empty) and returns the apiVersion of the objects
+func listType(kubeClient *client.Clientset, ns, objectType string, into runtime.Object, opts *dumpOptions) (string, error) {
+	if opts.listSlots != nil {
+		opts.listSlots <- struct{}{}
+		defer func() { <-opts.listSlots }()
+	}
+
+	if list, ok := into.(*customObjectList); ok {
+		return listCustomResource(kubeClient, ns, objectType, list, opts)
+	}
+
+	rc, apiVersion, err := clientFor(kubeClient, objectType, opts)
+	if err != nil {
+		return "", err
+	}
+
+	err = withRetries(fmt.Sprintf("listing type %v in %v", objectType, scope(ns)), opts, func() error {
+		return rc.Get().
+			Namespace(ns).
+			Resource(objectType).
+			VersionedParams(&api.ListOptions{LabelSelector: opts.labelSelector, FieldSelector: opts.fieldSelector}, unversioned_api.ParameterCodec).
+			Timeout(opts.requestTimeout).
+			Do().
+			Into(into)
+	})
+
+	return apiVersion, err
+}
+
+// parseTemplate parses the template of the namespace files. The function
+// objectToYaml returns an object converted by marshalNamespace (it is
+// replaced with the objects of each namespace in executeTemplate)
+func parseTemplate(text string) (*text_template.Template, error) {
+	return text_template.New("dump").Funcs(text_template.FuncMap{
+		"objectToYaml": marshaledObjects(nil).toYaml,
+	}).Parse(text)
+}
+
+// renderNamespace returns the content of the file of a namespace in the
+// output format, with the errors found during the dump (only in yaml)
+func renderNamespace(namespace *api.Namespace, data map[string]interface{}, objects marshaledObjects, notFound []string, opts *dumpOptions) ([]byte, error) {
+	if opts.outputFormat == "json" {
+		return namespaceJSON(namespace, data, objects, opts)
+	}
+
+	tmplBuf := new(bytes.Buffer)
+	err := executeTemplate(tmplBuf, namespace, data, objects, notFound, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return tmplBuf.Bytes(), nil
+}
+
+// executeTemplate renders the yaml file of a namespace in w. The objects
+// are written as the template is executed
+func executeTemplate(w io.Writer, namespace *api.Namespace, data map[string]interface{}, objects marshaledObjects, notFound []string, opts *dumpOptions) error {
+	// the namespaces are rendered concurrently, each one uses
+	// a copy of the template with its objects
+	tmpl, err := opts.template.Clone()
+	if err != nil {
+		return errors.Wrap(err, "unexpected error copying template")
+	}
+	tmpl.Funcs(text_template.FuncMap{"objectToYaml": objects.toYaml})
+
+	content := make(map[string]interface{})
+	content["notFound"] = notFound
+	content["name"] = namespace.Name
+	content["namespace"] = namespace
+	content["separator"] = opts.documentSeparator
+	content["leadingSeparator"] = opts.leadingSeparator
+	content["types"] = data
+
+	err = tmpl.Execute(w, content)
+	if err != nil {
+		return errors.Wrap(err, "unexpected error populating template")
+	}
+
+	return nil
+}
+
+// clientFor returns the REST client used to list a type and the
+// apiVersion of the objects (the version served by the apiserver)
+func clientFor(kubeClient *client.Clientset, objectType string, opts *dumpOptions) (restclient.Interface, string, error) {
+	apiVersion := servedAPIVersion(objectType, opts)
+	if apiVersion == "" {
+		return nil, "", fmt.Errorf("the apiserver does not serve the type %v", objectType)
+	}
+
+	rc, err := clientForVersion(kubeClient, apiVersion)
+	if err != nil {
+		return nil, "", err
+	}
+	return rc, apiVersion, nil
+}
+
+// apiVersionFor returns the apiVersion of the objects of a type
+func apiVersionFor(objectType string) string {
+	switch objectType {
+	case "horizontalpodautoscalers":
+		return "autoscaling/v1"
+	case "jobs":
+		return "batch/v1"
+	case "clusterrolebindings", "clusterroles", "rolebindings", "roles":
+		return "rbac.authorization.k8s.io/v1alpha1"
+	case "statefulsets":
+		return "apps/v1beta1"
+	case "storageclasses":
+		return "storage.k8s.io/v1beta1"
+	case "daemonsets", "deployments", "ingresses", "networkpolicies", "podsecuritypolicies", "replicasets", "thirdpartyresources":
+		return "extensions/v1beta1"
+	default:
+		return "v1"
+	}
+}
+
+// skipObject returns true if an object should not be dumped: the name of a
+// namespaced object matches --skip-names, the object has the annotation of --exclude-annotation, with
+// --skip-owned the object is managed by a controller or, with --minimal,
+// the object is a token generated for a service account
+func skipObject(obj runtime.Object, opts *dumpOptions) bool {
+	if _, ok := obj.(*api.Namespace); ok {
+		// the namespaces are selected with the namespace filters
+		return false
+	}
+
+	objectMeta, err := objectMetaFor(obj)
+	if err != nil {
+		return false
+	}
+
+	if opts.minimal && isGeneratedToken(obj) {
+		return true
+	}
+
+	// the default --skip-names (kubernetes) must not filter the nodes
+	if opts.skipNames != nil && objectMeta.GetNamespace() != "" && opts.skipNames.MatchString(objectMeta.GetName()) {
+		return true
+	}
+
+	if opts.excludeAnnotation.matches(objectMeta.GetAnnotations()) {
+		return true
+	}
+
+	if opts.skipOwned {
+		for _, owner := range objectMeta.OwnerReferences {
+			if owner.Controller != nil && *owner.Controller {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// annotationFilter matches the objects with an annotation. When anyValue
+// is set the value of the annotation is not checked
+type annotationFilter struct {
+	key      string
+	value    string
+	anyValue bool
+}
+
+// parseAnnotationFilter parses a filter in the format key=value or key
+func parseAnnotationFilter(filter string) (*annotationFilter, error) {
+	parts := strings.SplitN(filter, "=", 2)
+	if parts[0] == "" {
+		return nil, fmt.Errorf("invalid annotation filter %q (the format is key=value or key)", filter)
+	}
+
+	if len(parts) == 1 {
+		return &annotationFilter{key: parts[0], anyValue: true}, nil
+	}
+	return &annotationFilter{key: parts[0], value: parts[1]}, nil
+}
+
+// matches returns true if the annotations contain the annotation of the filter.
+// A nil filter does not match any object
+func (f *annotationFilter) matches(annotations map[string]string) bool {
+	if f == nil {
+		return false
+	}
+
+	value, ok := annotations[f.key]
+	return ok && (f.anyValue || value == f.value)
+}
+
+// clusterScopedTypes types that do not belong to a namespace (in alphabetical
+// order). They are listed once and written to the file _cluster.yaml instead
+// of being queried in each namespace
+var clusterScopedTypes = []string{"clusterrolebindings", "clusterroles", "persistentvolumes", "podsecuritypolicies",
+	"storageclasses", "thirdpartyresources"}
+
+// isClusterScoped returns true if a type does not belong to a namespace
+func isClusterScoped(objectType string) bool {
+	return containsName(objectType, clusterScopedTypes)
+}
+
+// skipType returns true if a type should not be dumped: when --include-types
+// is set and the type is not included, the type is listed in --skip-types or
+// the apiserver does not serve any of its versions
+func skipType(objectType string, opts *dumpOptions) bool {
+	if len(opts.includeTypes) > 0 && !containsName(objectType, opts.includeTypes) {
+		return true
+	}
+	return containsName(objectType, opts.skipTypes) || opts.unservedTypes[objectType]
+}
+
+// containsName returns true if a slice contains an element with a particular name
+func containsName(name string, names []string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// warnUnknownTypes logs the names passed to a flag that are not dumped types
+// (or their singular or short names)
+func warnUnknownTypes(flag string, names []string) {
+	mapping := newMappingFactoring()
+	for _, name := range names {
+		if _, ok := mapping[canonicalType(name, mapping)]; !ok && name != "" {
+			glog.Warningf("unknown type %v in --%v", name, flag)
+		}
+	}
+}
+
+func objectMetaFor(obj runtime.Object) (*api.ObjectMeta, error) {
+	v, err := conversion.EnforcePtr(obj)
+	if err != nil {
+		return nil, err
+	}
+	var meta *api.ObjectMeta
+	err = runtime.FieldPtr(v, "ObjectMeta", &meta)
+	return meta, err
+}
+
+// cleanObjectMeta resets the metadata fields set by the apiserver (resourceVersion,
+// uid, selfLink, creationTimestamp and generation) so the object can be applied
+// to another cluster
+func cleanObjectMeta(obj runtime.Object) error {
+	objectMeta, err := objectMetaFor(obj)
+	if err != nil {
+		return err
+	}
+
+	objectMeta.ResourceVersion = ""
+	objectMeta.UID = ""
+	objectMeta.SelfLink = ""
+	objectMeta.CreationTimestamp = unversioned.Time{}
+	objectMeta.Generation = 0
+	return nil
+}
+
+// statusClearedKinds kinds with a status section that is removed from the dump
+var statusClearedKinds = map[string]bool{
+	"Ingress":   true,
+	"Namespace": true,
+	"Pod":       true,
+	"Service":   true,
+}
+
+// clearStatus removes the status section of an object if the kind is one
+// of statusClearedKinds and is not present in the keep list
+func clearStatus(kind string, obj runtime.Object, keep []string) error {
+	if !statusClearedKinds[kind] {
+		return nil
+	}
+
+	for _, k := range keep {
+		if k == kind {
+			return nil
+		}
+	}
+
+	v, err := conversion.EnforcePtr(obj)
+	if err != nil {
+		return err
+	}
+
+	status := v.FieldByName("Status")
+	if !status.IsValid() || !status.CanSet() {
+		return nil
+	}
+
+	status.Set(reflect.Zero(status.Type()))
+	return nil
+}
+
+// removeGeneratedTokens removes from the service account the references to the
+// token secrets generated by the token controller (named <service account>-token-<suffix>).
+// The controller creates new tokens when the service account is restored
+func removeGeneratedTokens(sa *api.ServiceAccount) {
+	if sa.Secrets == nil {
+		return
+	}
+
+	prefix := fmt.Sprintf("%v-token-", sa.Name)
+	secrets := []api.ObjectReference{}
+	for _, secret := range sa.Secrets {
+		if !strings.HasPrefix(secret.Name, prefix) {
+			secrets = append(secrets, secret)
+		}
+	}
+
+	if len(secrets) == 0 {
+		secrets = nil
+	}
+	sa.Secrets = secrets
+}
+
+// marshalObject converts an instance of Object interface to the representation
+// in the output format (yaml or json) removing the metadata set by the apiserver and
+// redacting the fields matched by the rules. The objects skipped by the filters
+// return ""
+func marshalObject(kind, apiVersion string, obj runtime.Object, opts *dumpOptions) (string, error) {
+	if skipObject(obj, opts) {
+		return "", nil
+	}
+	return convertObject(kind, apiVersion, obj, opts)
+}
+
+// convertObject converts an object like marshalObject without applying the filters
+func convertObject(kind, apiVersion string, obj runtime.Object, opts *dumpOptions) (string, error) {
+	meta, err := objectMetaFor(obj)
+	if err != nil {
+		return "", err
+	}
+	// cleanObjectMeta clears the resourceVersion of meta
+	resourceVersion := meta.ResourceVersion
+
+	if !opts.keepStatus {
+		err := clearStatus(kind, obj, opts.keepStatusFor)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	err = stripContainers(obj, opts.stripContainerNames)
+	if err != nil {
+		return "", err
+	}
+
+	if opts.replaceImagePullSecrets != "" || opts.clearImagePullSecrets {
+		replaceImagePullSecrets(obj, opts.replaceImagePullSecrets)
+	}
+
+	if sa, ok := obj.(*api.ServiceAccount); ok && opts.skipDefaultTokens {
+		removeGeneratedTokens(sa)
+	}
+
+	if svc, ok := obj.(*api.Service); ok && svc.Spec.Type == api.ServiceTypeExternalName {
+		// the cluster IP is ignored for these services and fails the validation on create
+		svc.Spec.ClusterIP = ""
+	}
+
+	if opts.minimal {
+		minimizeObject(obj)
+	}
+
+	if pv, ok := obj.(*api.PersistentVolume); ok {
+		rewritePersistentVolume(pv, opts.pvReclaimPolicy, opts.pvClearCloudSource)
+	}
+
+	err = cleanObjectMeta(obj)
+	if err != nil {
+		return "", err
+	}
+
+	obj, err = cleanupFields(kind, obj, opts)
+	if err != nil {
+		return "", err
+	}
+
+	var s string
+	if opts.outputFormat == "json" {
+		s, err = printJSON(kind, apiVersion, obj)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		printer := &YAMLPrinter{version: apiVersion, converter: unversioned_api.Scheme}
+		if _, ok := obj.(*customObject); ok {
+			// there is no Go type to convert the objects of custom resources
+			printer = &YAMLPrinter{}
+		}
+		tmplBuf := new(bytes.Buffer)
+
+		if opts.annotateResourceVersion && resourceVersion != "" {
+			tmplBuf.Write([]byte(fmt.Sprintf("# resourceVersion: %v\n", resourceVersion)))
+		}
+
+		tmplBuf.Write([]byte(fmt.Sprintf("apiVersion: %v\n", apiVersion)))
+		tmplBuf.Write([]byte(fmt.Sprintf("kind: %v\n", kind)))
+
+		err = printer.PrintObj(obj, tmplBuf)
+		if err != nil {
+			return "", err
+		}
+
+		if opts.decodeValues && kind == "Secret" {
+			comment, err := decodedValuesComment(obj)
+			if err != nil {
+				return "", errors.Wrap(err, "unexpected error decoding the values of the secret")
+			}
+			tmplBuf.WriteString(comment)
+		}
+
+		s = tmplBuf.String()
+	}
+
+	if opts.transformExec != "" {
+		s, err = transformObject(s, opts.transformExec, opts.transformTimeout)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if opts.maxObjectSize > 0 && len(s) > opts.maxObjectSize {
+		opts.log.Warningf(meta.GetNamespace(), kind, "object %v/%v/%v has a size of %v bytes (bigger than %v). It will fail to be restored",
+			meta.GetNamespace(), kind, meta.GetName(), len(s), opts.maxObjectSize)
+	}
+
+	return s, nil
+}
+
+// marshaledObjects contains the objects of a dump converted by marshalObject
+// ("" for the objects excluded by the filters). The layouts write these
+// documents instead of converting the objects again
+type marshaledObjects map[runtime.Object]string
+
+// add converts the objects of a list. The objects that cannot be converted
+// (e.g. the --transform-exec command failed) are recorded in the result and
+// left out of the dump, so the errors header of the file lists them
+func (m marshaledObjects) add(ns, objectType string, result *k8sObject, opts *dumpOptions, dr *DumpResult) error {
+	items, err := meta.ExtractList(result.Runtime)
+	if err != nil {
+		return errors.Wrap(err, "unexpected error extracting items")
+	}
+
+	for _, item := range items {
+		objectMeta, err := objectMetaFor(item)
+		if err != nil {
+			return errors.Wrap(err, "unexpected error reading object metadata")
+		}
+
+		s, err := marshalObject(result.Kind, result.APIVersion, item, opts)
+		if err != nil {
+			dr.addObjectError(ns, objectType, objectMeta.Name, err)
+			continue
+		}
+		m[item] = s
+	}
+
+	return nil
+}
+
+// toYaml returns a converted object, it is the function objectToYaml of the template
+func (m marshaledObjects) toYaml(kind, apiVersion string, obj runtime.Object) string {
+	return m[obj]
+}
+
+// marshalNamespace converts the Namespace object and the objects of each
+// type of a namespace before any file is written
+func marshalNamespace(namespace *api.Namespace, data map[string]interface{}, opts *dumpOptions, dr *DumpResult) (marshaledObjects, error) {
+	s, err := marshalObject("Namespace", "v1", namespace, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "unexpected error encoding namespace")
+	}
+	objects := marshaledObjects{namespace: s}
+
+	types := []string{}
+	for objectType := range data {
+		types = append(types, objectType)
+	}
+	sort.Strings(types)
+
+	for _, objectType := range types {
+		err := objects.add(namespace.Name, objectType, data[objectType].(*k8sObject), opts, dr)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return objects, nil
+}
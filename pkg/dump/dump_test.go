@@ -0,0 +1,937 @@
+package dump
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ghodss/yaml"
+
+	"k8s.io/kubernetes/pkg/api/resource"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	api "k8s.io/kubernetes/pkg/api/v1"
+	autoscaling "k8s.io/kubernetes/pkg/apis/autoscaling/v1"
+	extensions "k8s.io/kubernetes/pkg/apis/extensions/v1beta1"
+	rbac "k8s.io/kubernetes/pkg/apis/rbac/v1alpha1"
+)
+
+// newTestOptions returns the default options of a dump written to dir
+// without writing the messages
+func newTestOptions(dir string) Options {
+	opts := NewOptions()
+	opts.Output = dir
+	opts.Logger, _ = NewLogger("json", ioutil.Discard)
+	opts.MaxRetries = 0
+	return opts
+}
+
+// completeTestOptions returns the settings of a dump with the options
+func completeTestOptions(t *testing.T, opts Options) *dumpOptions {
+	dopts, err := opts.complete()
+	if err != nil {
+		t.Fatalf("unexpected error completing the options: %v", err)
+	}
+	return dopts
+}
+
+// decodeTestObject decodes an object written by marshalObject
+func decodeTestObject(t *testing.T, s string, into interface{}) {
+	b, err := yaml.YAMLToJSON([]byte(s))
+	if err != nil {
+		t.Fatalf("unexpected error converting the object to json: %v\n%v", err, s)
+	}
+	err = json.Unmarshal(b, into)
+	if err != nil {
+		t.Fatalf("unexpected error decoding the object: %v\n%v", err, s)
+	}
+}
+
+// newTestConfigMap returns a configmap with the metadata set by the apiserver
+func newTestConfigMap(ns, name string) *api.ConfigMap {
+	return &api.ConfigMap{
+		ObjectMeta: api.ObjectMeta{
+			Name:              name,
+			Namespace:         ns,
+			ResourceVersion:   "4242",
+			UID:               "8d5f3c1e-uid",
+			SelfLink:          "/api/v1/namespaces/" + ns + "/configmaps/" + name,
+			CreationTimestamp: unversioned.Now(),
+			Generation:        3,
+		},
+		Data: map[string]string{"color": "blue"},
+	}
+}
+
+func TestMarshalObjectCleansMetadata(t *testing.T) {
+	opts := completeTestOptions(t, newTestOptions(""))
+
+	s, err := marshalObject("ConfigMap", "v1", newTestConfigMap("web", "settings"), opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, field := range []string{"resourceVersion", "uid", "selfLink", "creationTimestamp: \"", "generation"} {
+		if strings.Contains(s, field) {
+			t.Errorf("expected the field %v to be removed, got\n%v", field, s)
+		}
+	}
+	if !strings.Contains(s, "name: settings") || !strings.Contains(s, "color: blue") {
+		t.Errorf("expected the configmap, got\n%v", s)
+	}
+}
+
+func TestMarshalObjectAnnotateResourceVersion(t *testing.T) {
+	options := newTestOptions("")
+	options.AnnotateResourceVersion = true
+	opts := completeTestOptions(t, options)
+
+	s, err := marshalObject("ConfigMap", "v1", newTestConfigMap("web", "settings"), opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !strings.HasPrefix(s, "# resourceVersion: 4242\napiVersion: v1\n") {
+		t.Errorf("expected the resourceVersion in a leading comment, got\n%v", s)
+	}
+	if strings.Contains(s, "resourceVersion: \"4242\"") || strings.Count(s, "4242") != 1 {
+		t.Errorf("expected the resourceVersion to be removed from the object, got\n%v", s)
+	}
+}
+
+func TestMarshalObjectWithoutMetadata(t *testing.T) {
+	opts := completeTestOptions(t, newTestOptions(""))
+
+	// a list has no ObjectMeta
+	_, err := marshalObject("ConfigMapList", "v1", &api.ConfigMapList{}, opts)
+	if err == nil {
+		t.Errorf("expected an error converting an object without metadata")
+	}
+}
+
+// logMessages returns the level, namespace, type and message of each line
+// written by a json Logger, without the times and durations
+func logMessages(t *testing.T, out *bytes.Buffer) []string {
+	messages := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var entry logEntry
+		err := json.Unmarshal([]byte(line), &entry)
+		if err != nil {
+			t.Fatalf("unexpected error decoding the log line %q: %v", line, err)
+		}
+		messages = append(messages, fmt.Sprintf("%v %v %v %v", entry.Level, entry.Namespace, entry.Type, durationPattern.ReplaceAllString(entry.Message, "<duration>")))
+	}
+	return messages
+}
+
+// durationPattern matches the durations of the log messages
+var durationPattern = regexp.MustCompile(`[0-9.]+(ns|µs|ms|s)\b`)
+
+func TestDumpClusterDeterministic(t *testing.T) {
+	s := newTestCluster(t)
+	defer s.Close()
+
+	logs := []*bytes.Buffer{new(bytes.Buffer), new(bytes.Buffer)}
+	dumps := []map[string][]byte{}
+	for _, out := range logs {
+		logger, _ := NewLogger("json", out)
+		dumps = append(dumps, dumpTestCluster(t, s, func(o *Options) {
+			o.Logger = logger
+			o.Concurrency = 1
+		}))
+	}
+
+	for _, path := range []string{"_cluster.yaml", "_manifest.sha256", "_summary.json", "other.yaml", "web.yaml"} {
+		if _, ok := dumps[0][path]; !ok {
+			t.Fatalf("expected the file %v in the dump", path)
+		}
+	}
+	compareDumps(t, dumps[0], dumps[1])
+	first, second := logMessages(t, logs[0]), logMessages(t, logs[1])
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("expected the same messages in each dump, got\n%v\n---\n%v", strings.Join(first, "\n"), strings.Join(second, "\n"))
+	}
+}
+
+func TestDumpClusterConcurrency(t *testing.T) {
+	s := newFakeAPIServer()
+	defer s.Close()
+	for i := 0; i < 8; i++ {
+		s.add(t, "namespaces", &api.Namespace{ObjectMeta: api.ObjectMeta{Name: fmt.Sprintf("ns-%v", i)}})
+	}
+
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	s.handle = func(w http.ResponseWriter, r *http.Request) bool {
+		req, ok := parseFakeRequest(r.URL.Path)
+		if !ok || r.Method != "GET" || req.namespace == "" || req.name != "" {
+			return false
+		}
+
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+
+		// keep the list in flight while the other workers send their requests
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		return false
+	}
+
+	dumpTestCluster(t, s, func(o *Options) {
+		o.Concurrency = 3
+		o.TypeConcurrency = 4
+	})
+
+	if maxInFlight > 3 {
+		t.Errorf("expected at most 3 list requests in flight, got %v", maxInFlight)
+	}
+	if maxInFlight < 2 {
+		t.Errorf("expected the namespaces to be dumped concurrently, got %v list requests in flight", maxInFlight)
+	}
+}
+
+func TestDumpClusterTypeConcurrency(t *testing.T) {
+	s := newTestCluster(t)
+	defer s.Close()
+	s.handle = func(w http.ResponseWriter, r *http.Request) bool {
+		req, ok := parseFakeRequest(r.URL.Path)
+		if !ok || r.Method != "GET" || req.namespace != "web" || req.name != "" {
+			return false
+		}
+
+		// the latency of each list call
+		time.Sleep(10 * time.Millisecond)
+		if req.objectType == "secrets" {
+			writeFakeStatus(w, http.StatusNotFound, "NotFound", "the server could not find the requested resource")
+			return true
+		}
+		return false
+	}
+
+	dump := func(typeConcurrency int) (time.Duration, *DumpResult, map[string][]byte) {
+		start := time.Now()
+		result, files := runTestDump(t, s, func(o *Options) {
+			o.Namespace = "web"
+			o.Concurrency = 8
+			o.TypeConcurrency = typeConcurrency
+		})
+		return time.Since(start), result, files
+	}
+
+	sequential, sequentialResult, sequentialFiles := dump(1)
+	concurrent, concurrentResult, concurrentFiles := dump(8)
+
+	if concurrent > sequential/2 {
+		t.Errorf("expected --type-concurrency=8 to reduce the time of the dump, got %v (sequential %v)", concurrent, sequential)
+	}
+	// the same dump and issues
+	compareDumps(t, sequentialFiles, concurrentFiles)
+	if first, second := sequentialResult.messagesFor("web"), concurrentResult.messagesFor("web"); !reflect.DeepEqual(first, second) || len(first) != 1 {
+		t.Errorf("expected the same message of the missing type, got %q and %q", first, second)
+	}
+
+	opts := newTestOptions(stdoutOutput)
+	opts.TypeConcurrency = 0
+	if _, err := DumpCluster(s.client(t), opts); err == nil || !strings.Contains(err.Error(), "invalid type concurrency 0") {
+		t.Errorf("expected an invalid type concurrency error, got %v", err)
+	}
+}
+
+func TestDumpExternalNameService(t *testing.T) {
+	s := newFakeAPIServer()
+	defer s.Close()
+	s.add(t, "namespaces", &api.Namespace{ObjectMeta: api.ObjectMeta{Name: "web"}})
+	s.add(t, "services", &api.Service{
+		ObjectMeta: api.ObjectMeta{Name: "db", Namespace: "web"},
+		Spec: api.ServiceSpec{
+			Type:         api.ServiceTypeExternalName,
+			ExternalName: "db.example.com",
+			// left by a service whose type was changed
+			ClusterIP: "10.0.0.20",
+		},
+	})
+
+	files := dumpTestCluster(t, s, func(o *Options) { o.OutputLayout = "tree" })
+	content := string(files["web/services/db.yaml"])
+	if !strings.Contains(content, "externalName: db.example.com\n") || strings.Contains(content, "clusterIP") {
+		t.Fatalf("expected the external name without the cluster IP, got\n%v", content)
+	}
+
+	// the dumped manifest is restored with the same spec
+	var obj map[string]interface{}
+	decodeTestObject(t, content, &obj)
+	target := newFakeAPIServer()
+	defer target.Close()
+	result := Restore(target.client(t), []map[string]interface{}{obj}, RestoreOptions{})
+	if result.Failed() {
+		t.Fatalf("unexpected errors restoring the service: %v", result.Errors)
+	}
+
+	b, err := json.Marshal(target.object("services", "web", "db"))
+	if err != nil {
+		t.Fatalf("unexpected error encoding the restored service: %v", err)
+	}
+	var restored api.Service
+	decodeTestObject(t, string(b), &restored)
+	expected := api.ServiceSpec{Type: api.ServiceTypeExternalName, ExternalName: "db.example.com"}
+	if !reflect.DeepEqual(restored.Spec, expected) {
+		t.Errorf("expected the restored spec %+v, got %+v", expected, restored.Spec)
+	}
+}
+
+func TestDumpNamespaceMetadata(t *testing.T) {
+	s := newFakeAPIServer()
+	defer s.Close()
+	s.add(t, "namespaces", &api.Namespace{
+		ObjectMeta: api.ObjectMeta{
+			Name:        "web",
+			Labels:      map[string]string{"istio-injection": "enabled"},
+			Annotations: map[string]string{"example.com/quota": "small"},
+		},
+		Spec:   api.NamespaceSpec{Finalizers: []api.FinalizerName{api.FinalizerKubernetes}},
+		Status: api.NamespaceStatus{Phase: api.NamespaceActive},
+	})
+	s.add(t, "configmaps", newTestConfigMap("web", "settings"))
+
+	for _, layout := range []string{"flat", "tree"} {
+		files := dumpTestCluster(t, s, func(o *Options) { o.OutputLayout = layout })
+		file := "web.yaml"
+		if layout == "tree" {
+			file = "web/namespace.yaml"
+		}
+
+		// the namespace is the first document of the file
+		content := string(files[file])
+		if i := strings.Index(content, "\n---"); i >= 0 {
+			content = content[:i]
+		}
+		var ns api.Namespace
+		decodeTestObject(t, content, &ns)
+
+		if ns.Kind != "Namespace" || ns.Name != "web" {
+			t.Fatalf("expected the namespace web in %v, got\n%v", file, content)
+		}
+		if ns.Labels["istio-injection"] != "enabled" || ns.Annotations["example.com/quota"] != "small" {
+			t.Errorf("expected the labels and annotations of the namespace in %v, got\n%v", file, content)
+		}
+		if len(ns.Spec.Finalizers) != 1 || ns.Spec.Finalizers[0] != api.FinalizerKubernetes {
+			t.Errorf("expected the finalizers of the namespace in %v, got\n%v", file, content)
+		}
+		if ns.ResourceVersion != "" || ns.Status.Phase != "" {
+			t.Errorf("expected the namespace without resourceVersion and status in %v, got\n%v", file, content)
+		}
+	}
+}
+
+func TestDumpClusterNamespaceFailure(t *testing.T) {
+	s := newTestCluster(t)
+	defer s.Close()
+	s.handle = func(w http.ResponseWriter, r *http.Request) bool {
+		req, ok := parseFakeRequest(r.URL.Path)
+		if ok && req.objectType == "services" && req.namespace == "web" {
+			writeFakeStatus(w, http.StatusInternalServerError, "InternalError", "etcd is unavailable")
+			return true
+		}
+		return false
+	}
+
+	for _, partialWrites := range []bool{false, true} {
+		result, files := runTestDump(t, s, func(o *Options) { o.PartialWrites = partialWrites })
+
+		if _, ok := files["other.yaml"]; !ok {
+			t.Errorf("expected the namespace other to be dumped with partial writes %v", partialWrites)
+		}
+		if _, ok := files["web.yaml"]; ok != partialWrites {
+			t.Errorf("expected the file of the namespace web with partial writes %v to be written: %v", partialWrites, ok)
+		}
+
+		// finishDump exits with failedDumpExitCode when Err is not nil
+		if err := result.Err(); err == nil || err.Error() != "the dump finished with 1 errors in namespace web" {
+			t.Errorf("expected the error of the namespace web with partial writes %v, got %v", partialWrites, err)
+		}
+		if web := string(files["web.yaml"]); partialWrites && !strings.Contains(web, "# unexpected error querying type services in namespace web") {
+			t.Errorf("expected the error in the header of the namespace web, got\n%v", web)
+		}
+	}
+}
+
+func TestDumpClusterMaxObjectSize(t *testing.T) {
+	s := newFakeAPIServer()
+	defer s.Close()
+	s.add(t, "namespaces", &api.Namespace{ObjectMeta: api.ObjectMeta{Name: "web"}})
+	s.add(t, "configmaps", newTestConfigMap("web", "settings"))
+	big := newTestConfigMap("web", "big")
+	big.Data["payload"] = strings.Repeat("x", 2048)
+	s.add(t, "configmaps", big)
+
+	out := &bytes.Buffer{}
+	logger, _ := NewLogger("json", out)
+	files := dumpTestCluster(t, s, func(o *Options) {
+		o.Logger = logger
+		o.IncludeTypes = []string{"configmaps"}
+		o.MaxObjectSize = 1024
+	})
+
+	warnings := []string{}
+	for _, message := range logMessages(t, out) {
+		if strings.Contains(message, "bigger than 1024") {
+			warnings = append(warnings, message)
+		}
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "object web/ConfigMap/big has a size of") {
+		t.Errorf("expected a warning for the configmap big, got %v", warnings)
+	}
+	// the object is dumped anyway
+	if !strings.Contains(string(files["web.yaml"]), "name: big") {
+		t.Errorf("expected the configmap big in the dump, got\n%s", files["web.yaml"])
+	}
+}
+
+func TestDumpClusterMaxItemsPerType(t *testing.T) {
+	s := newTestCluster(t)
+	defer s.Close()
+
+	// each namespace has 3 configmaps, one service and one deployment
+	result, files := runTestDump(t, s, func(o *Options) { o.MaxItemsPerType = 2 })
+	if result.Failed() {
+		t.Fatalf("unexpected errors in the dump: %v", result.Err())
+	}
+
+	if len(result.skipped) != 2 {
+		t.Fatalf("expected the configmaps to be skipped in each namespace, got %v", result.skipped)
+	}
+	for _, issue := range result.skipped {
+		if issue.objectType != "configmaps" || !strings.Contains(issue.message, "contains 3 objects (more than 2)") {
+			t.Errorf("expected the configmaps to be skipped, got %+v", issue)
+		}
+	}
+
+	web := string(files["web.yaml"])
+	if strings.Contains(web, "kind: ConfigMap") {
+		t.Errorf("expected the configmaps to be skipped, got\n%v", web)
+	}
+	if !strings.Contains(web, "kind: Service") || !strings.Contains(web, "kind: Deployment") {
+		t.Errorf("expected the types with less items in the dump, got\n%v", web)
+	}
+
+	// the limit is inclusive
+	result, files = runTestDump(t, s, func(o *Options) { o.MaxItemsPerType = 3 })
+	if len(result.skipped) != 0 || !strings.Contains(string(files["web.yaml"]), "kind: ConfigMap") {
+		t.Errorf("expected the configmaps with --max-items-per-type=3, got %v", result.skipped)
+	}
+}
+
+// newStatusTestCluster returns a fake apiserver with a service, a pod and a
+// deployment with a status section
+func newStatusTestCluster(t *testing.T) *fakeAPIServer {
+	s := newFakeAPIServer()
+	s.add(t, "namespaces", &api.Namespace{ObjectMeta: api.ObjectMeta{Name: "web"}})
+	s.add(t, "services", &api.Service{
+		ObjectMeta: api.ObjectMeta{Name: "nginx", Namespace: "web"},
+		Spec:       api.ServiceSpec{Type: api.ServiceTypeLoadBalancer, Ports: []api.ServicePort{{Port: 80}}},
+		Status:     api.ServiceStatus{LoadBalancer: api.LoadBalancerStatus{Ingress: []api.LoadBalancerIngress{{IP: "203.0.113.10"}}}},
+	})
+	s.add(t, "pods", &api.Pod{
+		ObjectMeta: api.ObjectMeta{Name: "debug", Namespace: "web"},
+		Spec:       api.PodSpec{Containers: []api.Container{{Name: "debug", Image: "busybox"}}},
+		Status:     api.PodStatus{Phase: api.PodRunning, PodIP: "10.2.0.7"},
+	})
+	s.add(t, "deployments", &extensions.Deployment{
+		ObjectMeta: api.ObjectMeta{Name: "nginx", Namespace: "web"},
+		Status:     extensions.DeploymentStatus{ObservedGeneration: 7, AvailableReplicas: 2},
+	})
+	return s
+}
+
+func TestDumpClusterExcludeAnnotation(t *testing.T) {
+	s := newFakeAPIServer()
+	defer s.Close()
+	s.add(t, "namespaces", &api.Namespace{ObjectMeta: api.ObjectMeta{Name: "web"}})
+	for name, annotations := range map[string]map[string]string{
+		"excluded": {"dump.k8s.io/exclude": "true"},
+		"kept":     {"dump.k8s.io/exclude": "false"},
+		"empty":    {"dump.k8s.io/exclude": ""},
+		"plain":    nil,
+	} {
+		s.add(t, "configmaps", &api.ConfigMap{ObjectMeta: api.ObjectMeta{Name: name, Namespace: "web", Annotations: annotations}})
+	}
+	// the filter applies to all the types
+	s.add(t, "services", &api.Service{ObjectMeta: api.ObjectMeta{
+		Name: "excluded", Namespace: "web", Annotations: map[string]string{"dump.k8s.io/exclude": "true"},
+	}})
+
+	tests := []struct {
+		filter   string
+		expected []string
+	}{
+		{filter: "", expected: []string{"empty", "excluded", "kept", "plain", "excluded"}},
+		{filter: "dump.k8s.io/exclude=true", expected: []string{"empty", "kept", "plain"}},
+		{filter: "dump.k8s.io/exclude=", expected: []string{"excluded", "kept", "plain", "excluded"}},
+		// only the key matches any value
+		{filter: "dump.k8s.io/exclude", expected: []string{"plain"}},
+		{filter: "dump.k8s.io/other", expected: []string{"empty", "excluded", "kept", "plain", "excluded"}},
+	}
+
+	names := regexp.MustCompile(`(?m)^  name: (\S+)\n  namespace: web$`)
+	for _, test := range tests {
+		files := dumpTestCluster(t, s, func(o *Options) {
+			o.IncludeTypes = []string{"configmaps", "services"}
+			o.ExcludeAnnotation = test.filter
+		})
+
+		dumped := []string{}
+		for _, match := range names.FindAllStringSubmatch(string(files["web.yaml"]), -1) {
+			dumped = append(dumped, match[1])
+		}
+		if !reflect.DeepEqual(dumped, test.expected) {
+			t.Errorf("expected the objects %v with --exclude-annotation=%q, got %v", test.expected, test.filter, dumped)
+		}
+	}
+
+	opts := newTestOptions(stdoutOutput)
+	opts.ExcludeAnnotation = "=true"
+	if _, err := DumpCluster(s.client(t), opts); err == nil || !strings.Contains(err.Error(), "invalid annotation filter") {
+		t.Errorf("expected an invalid annotation filter error, got %v", err)
+	}
+}
+
+func TestDumpClusterListOnly(t *testing.T) {
+	s := newTestCluster(t)
+	defer s.Close()
+	s.add(t, "clusterroles", &rbac.ClusterRole{ObjectMeta: api.ObjectMeta{Name: "admin"}})
+
+	dir, err := ioutil.TempDir("", "dump")
+	if err != nil {
+		t.Fatalf("unexpected error creating a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	out := dumpTestClusterStdout(t, s, func(o *Options) {
+		o.Output = dir
+		o.ListOnly = true
+		o.DumpNodeInfo = true
+		o.IncludeTypes = []string{"clusterroles", "configmaps", "secrets", "services"}
+	})
+
+	expected := "NAMESPACE  TYPE          OBJECTS\n" +
+		"<cluster>  clusterroles  1\n" +
+		"other      configmaps    3\n" +
+		"other      secrets       0\n" +
+		"other      services      1\n" +
+		"web        configmaps    3\n" +
+		"web        secrets       0\n" +
+		"web        services      1\n" +
+		"TOTAL                    9\n"
+	if out != expected {
+		t.Errorf("expected the table\n%v\ngot\n%v", expected, out)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("expected no files written with --list-only, got %v files", len(files))
+	}
+
+	opts := newTestOptions(dir)
+	opts.ListOnly = true
+	opts.ListOutputPlan = true
+	if _, err := DumpCluster(s.client(t), opts); err == nil || !strings.Contains(err.Error(), "--list-only cannot be used with --list-output-plan") {
+		t.Errorf("expected an error with --list-only and --list-output-plan, got %v", err)
+	}
+}
+
+func TestDumpClusterKeepStatusFor(t *testing.T) {
+	s := newStatusTestCluster(t)
+	defer s.Close()
+
+	files := dumpTestCluster(t, s, func(o *Options) {
+		o.IncludeTypes = []string{"services", "pods", "deployments"}
+		o.KeepStatusFor = []string{"Service"}
+	})
+
+	web := string(files["web.yaml"])
+	if !strings.Contains(web, "ip: 203.0.113.10") {
+		t.Errorf("expected the status of the service with --keep-status-for=Service, got\n%v", web)
+	}
+	if strings.Contains(web, "podIP: 10.2.0.7") || strings.Contains(web, "phase: Running") {
+		t.Errorf("expected the status of the pod to be removed, got\n%v", web)
+	}
+	// the status of the kinds that are not cleared by default is kept
+	if !strings.Contains(web, "availableReplicas: 2") {
+		t.Errorf("expected the status of the deployment, got\n%v", web)
+	}
+}
+
+func TestDumpClusterKeepStatus(t *testing.T) {
+	s := newStatusTestCluster(t)
+	defer s.Close()
+
+	for _, keepStatus := range []bool{false, true} {
+		files := dumpTestCluster(t, s, func(o *Options) {
+			o.IncludeTypes = []string{"services", "pods", "deployments"}
+			o.KeepStatus = keepStatus
+		})
+
+		web := string(files["web.yaml"])
+		if strings.Contains(web, "status:\n  loadBalancer:\n    ingress:\n    - ip: 203.0.113.10\n") != keepStatus {
+			t.Errorf("expected the status of the service only with --keep-status (%v), got\n%v", keepStatus, web)
+		}
+		if strings.Contains(web, "podIP: 10.2.0.7") != keepStatus || strings.Contains(web, "phase: Running") != keepStatus {
+			t.Errorf("expected the status of the pod only with --keep-status (%v), got\n%v", keepStatus, web)
+		}
+		if !keepStatus && !strings.Contains(web, "status:\n  loadBalancer: {}\n") {
+			t.Errorf("expected an empty status of the service without --keep-status, got\n%v", web)
+		}
+		if !strings.Contains(web, "availableReplicas: 2") {
+			t.Errorf("expected the status of the deployment with --keep-status=%v, got\n%v", keepStatus, web)
+		}
+	}
+}
+
+func TestDumpClusterEmpty(t *testing.T) {
+	s := newFakeAPIServer()
+	defer s.Close()
+	s.add(t, "namespaces", &api.Namespace{ObjectMeta: api.ObjectMeta{Name: "kube-system"}})
+
+	tests := []struct {
+		name      string
+		configure func(*Options)
+		message   string
+	}{
+		{"all the namespaces skipped", func(o *Options) { o.OnlyUserNamespaces = true },
+			"no namespaces to dump (the cluster returned 1 namespaces)"},
+		{"missing requested namespaces", func(o *Options) { o.Namespaces = []string{"web", "other"} },
+			"no namespaces to dump (none of the 2 namespaces requested exists)"},
+	}
+
+	for _, test := range tests {
+		out := &bytes.Buffer{}
+		logger, _ := NewLogger("json", out)
+		result, files := runTestDump(t, s, func(o *Options) {
+			o.Logger = logger
+			test.configure(o)
+		})
+
+		if !result.Empty() || result.Failed() {
+			t.Errorf("%v: expected an empty dump without errors, got %v", test.name, result.Err())
+		}
+		if !strings.Contains(out.String(), test.message) {
+			t.Errorf("%v: expected the warning %q, got\n%v", test.name, test.message, out.String())
+		}
+		if _, ok := files["kube-system.yaml"]; ok {
+			t.Errorf("%v: expected no file for the namespace kube-system", test.name)
+		}
+	}
+}
+
+func TestDumpClusterPartialWrites(t *testing.T) {
+	s := newTestCluster(t)
+	defer s.Close()
+	s.handle = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path == "/api/v1/namespaces/web/services" {
+			writeFakeStatus(w, http.StatusInternalServerError, "InternalError", "etcd is unavailable")
+			return true
+		}
+		return false
+	}
+
+	for _, partialWrites := range []bool{true, false} {
+		_, files := runTestDump(t, s, func(o *Options) { o.PartialWrites = partialWrites })
+
+		web := string(files["web.yaml"])
+		if partialWrites {
+			// the types that succeeded are written
+			if strings.Count(web, "kind: ConfigMap") != 3 || !strings.Contains(web, "kind: Deployment") || strings.Contains(web, "kind: Service") {
+				t.Errorf("expected the configmaps and the deployment of web, got\n%v", web)
+			}
+		}
+
+		var summary Summary
+		err := json.Unmarshal(files[summaryFile], &summary)
+		if err != nil {
+			t.Fatalf("unexpected error decoding the summary: %v", err)
+		}
+		states := map[string]string{}
+		for _, ns := range summary.Namespaces {
+			states[ns.Name] = ns.State
+		}
+		if states["other"] != NamespaceWritten {
+			t.Errorf("expected the namespace other to be written with --partial-writes=%v, got %v", partialWrites, states)
+		}
+		expected := NamespaceFailed
+		if partialWrites {
+			expected = NamespacePartial
+		}
+		if states["web"] != expected {
+			t.Errorf("expected the namespace web to be %v with --partial-writes=%v, got %v", expected, partialWrites, states)
+		}
+	}
+}
+
+func TestDumpClusterSkipDefaultTokens(t *testing.T) {
+	s := newFakeAPIServer()
+	defer s.Close()
+	s.add(t, "namespaces", &api.Namespace{ObjectMeta: api.ObjectMeta{Name: "web"}})
+	s.add(t, "serviceaccounts", &api.ServiceAccount{
+		ObjectMeta: api.ObjectMeta{Name: "default", Namespace: "web"},
+		Secrets:    []api.ObjectReference{{Name: "default-token-x7k2p"}},
+	})
+	s.add(t, "serviceaccounts", &api.ServiceAccount{
+		ObjectMeta: api.ObjectMeta{Name: "builder", Namespace: "web"},
+		Secrets:    []api.ObjectReference{{Name: "builder-token-9ds2x"}, {Name: "registry-credentials"}},
+	})
+
+	for _, skipDefaultTokens := range []bool{true, false} {
+		files := dumpTestCluster(t, s, func(o *Options) {
+			o.SkipTypes = nil
+			o.IncludeTypes = []string{"serviceaccounts"}
+			o.SkipDefaultTokens = skipDefaultTokens
+		})
+
+		web := string(files["web.yaml"])
+		if !strings.Contains(web, "name: registry-credentials") || strings.Count(web, "kind: ServiceAccount") != 2 {
+			t.Errorf("expected the service accounts and the secrets that are not generated, got\n%v", web)
+		}
+		for _, token := range []string{"default-token-x7k2p", "builder-token-9ds2x"} {
+			if strings.Contains(web, token) == skipDefaultTokens {
+				t.Errorf("expected the token %v only with --skip-default-tokens=false (%v), got\n%v", token, skipDefaultTokens, web)
+			}
+		}
+		// the service account without other secrets has no secrets field
+		if strings.Contains(web, "secrets: []") || strings.Contains(web, "secrets: null") {
+			t.Errorf("expected no empty list of secrets, got\n%v", web)
+		}
+	}
+}
+
+func TestDumpClusterNamespaceDeleted(t *testing.T) {
+	s := newTestCluster(t)
+	defer s.Close()
+	s.add(t, "namespaces", &api.Namespace{ObjectMeta: api.ObjectMeta{Name: "gone"}})
+	s.add(t, "configmaps", newTestConfigMap("gone", "settings"))
+	// the namespace gone is deleted after the list of namespaces
+	s.handle = func(w http.ResponseWriter, r *http.Request) bool {
+		req, ok := parseFakeRequest(r.URL.Path)
+		if ok && (req.namespace == "gone" || req.objectType == "namespaces" && req.name == "gone") {
+			writeFakeStatus(w, http.StatusNotFound, "NotFound", "namespaces \"gone\" not found")
+			return true
+		}
+		return false
+	}
+
+	result, files := runTestDump(t, s, nil)
+	if result.Failed() {
+		t.Errorf("unexpected errors in the dump: %v", result.Err())
+	}
+	if _, ok := files["gone.yaml"]; ok {
+		t.Errorf("expected no file for the deleted namespace, got\n%s", files["gone.yaml"])
+	}
+	for _, path := range []string{"web.yaml", "other.yaml"} {
+		if _, ok := files[path]; !ok {
+			t.Errorf("expected the file %v", path)
+		}
+	}
+
+	var summary Summary
+	err := json.Unmarshal(files[summaryFile], &summary)
+	if err != nil {
+		t.Fatalf("unexpected error decoding the summary: %v", err)
+	}
+	if !reflect.DeepEqual(summary.Deleted, []string{"gone"}) {
+		t.Errorf("expected the namespace gone in the deleted namespaces, got %v", summary.Deleted)
+	}
+	for _, ns := range summary.Namespaces {
+		if ns.Name == "gone" && len(ns.NotFound) > 0 {
+			t.Errorf("expected no types without objects for the deleted namespace, got %v", ns.NotFound)
+		}
+	}
+}
+
+func TestDumpClusterAutoscalersAndQuotas(t *testing.T) {
+	s := newFakeAPIServer()
+	defer s.Close()
+	s.add(t, "namespaces", &api.Namespace{ObjectMeta: api.ObjectMeta{Name: "web"}})
+	s.add(t, "horizontalpodautoscalers", &autoscaling.HorizontalPodAutoscaler{
+		ObjectMeta: api.ObjectMeta{Name: "nginx", Namespace: "web"},
+		Spec: autoscaling.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscaling.CrossVersionObjectReference{Kind: "Deployment", Name: "nginx"},
+			MaxReplicas:    5,
+		},
+	})
+	s.add(t, "resourcequotas", &api.ResourceQuota{
+		ObjectMeta: api.ObjectMeta{Name: "compute", Namespace: "web"},
+		Spec:       api.ResourceQuotaSpec{Hard: api.ResourceList{api.ResourcePods: resource.MustParse("10")}},
+	})
+
+	files := dumpTestCluster(t, s, func(o *Options) {
+		o.IncludeTypes = []string{"horizontalpodautoscalers", "resourcequotas"}
+	})
+
+	web := string(files["web.yaml"])
+	for _, expected := range []string{
+		"apiVersion: autoscaling/v1\nkind: HorizontalPodAutoscaler\n", "maxReplicas: 5",
+		"apiVersion: v1\nkind: ResourceQuota\n", "pods: \"10\"",
+	} {
+		if !strings.Contains(web, expected) {
+			t.Errorf("expected %q in the dump, got\n%v", expected, web)
+		}
+	}
+	if strings.Contains(web, "kind: ConfigMap") {
+		t.Errorf("expected no configmaps in the dump, got\n%v", web)
+	}
+}
+
+func TestDumpClusterSelector(t *testing.T) {
+	s := newFakeAPIServer()
+	defer s.Close()
+	s.add(t, "namespaces", &api.Namespace{ObjectMeta: api.ObjectMeta{Name: "web"}})
+	for name, labels := range map[string]map[string]string{
+		"nginx":   {"app": "nginx", "tier": "frontend"},
+		"backend": {"app": "nginx", "tier": "backend"},
+		"redis":   {"app": "redis"},
+		"plain":   nil,
+	} {
+		s.add(t, "configmaps", &api.ConfigMap{ObjectMeta: api.ObjectMeta{Name: name, Namespace: "web", Labels: labels}})
+	}
+	// a type that is not served by the apiserver
+	s.handle = func(w http.ResponseWriter, r *http.Request) bool {
+		if req, _ := parseFakeRequest(r.URL.Path); req.objectType == "secrets" {
+			writeFakeStatus(w, http.StatusNotFound, "NotFound", "the server could not find the requested resource")
+			return true
+		}
+		return false
+	}
+
+	tests := []struct {
+		selector string
+		expected []string
+	}{
+		{selector: "", expected: []string{"backend", "nginx", "plain", "redis"}},
+		{selector: "app=nginx", expected: []string{"backend", "nginx"}},
+		{selector: "app=nginx,tier=frontend", expected: []string{"nginx"}},
+		{selector: "app", expected: []string{"backend", "nginx", "redis"}},
+		{selector: "app!=nginx", expected: []string{"plain", "redis"}},
+	}
+
+	names := regexp.MustCompile(`(?m)^  name: (\S+)\n  namespace: web$`)
+	for _, test := range tests {
+		result, files := runTestDump(t, s, func(opts *Options) {
+			opts.IncludeTypes = []string{"configmaps", "secrets"}
+			opts.Selector = test.selector
+		})
+
+		dumped := []string{}
+		for _, match := range names.FindAllStringSubmatch(string(files["web.yaml"]), -1) {
+			dumped = append(dumped, match[1])
+		}
+		if !reflect.DeepEqual(dumped, test.expected) {
+			t.Errorf("expected the configmaps %v with --selector=%q, got %v", test.expected, test.selector, dumped)
+		}
+
+		messages := strings.Join(result.messagesFor("web"), "\n")
+		if strings.Contains(messages, "matching the selector") != (test.selector != "") {
+			t.Errorf("expected the selector in the message of the missing type only with --selector=%q, got %q", test.selector, messages)
+		}
+	}
+
+	opts := newTestOptions(stdoutOutput)
+	opts.Selector = "app in (nginx"
+	if _, err := DumpCluster(s.client(t), opts); err == nil || !strings.Contains(err.Error(), "invalid selector") {
+		t.Errorf("expected an invalid selector error, got %v", err)
+	}
+}
+
+func TestDumpClusterRBAC(t *testing.T) {
+	s := newFakeAPIServer()
+	defer s.Close()
+	s.add(t, "namespaces", &api.Namespace{ObjectMeta: api.ObjectMeta{Name: "web"}})
+	s.add(t, "roles", &rbac.Role{
+		ObjectMeta: api.ObjectMeta{Name: "reader", Namespace: "web"},
+		Rules:      []rbac.PolicyRule{{Verbs: []string{"get", "list"}, APIGroups: []string{""}, Resources: []string{"configmaps"}}},
+	})
+	// a binding of the namespace can reference a role or a cluster role
+	s.add(t, "rolebindings", &rbac.RoleBinding{
+		ObjectMeta: api.ObjectMeta{Name: "reader", Namespace: "web"},
+		Subjects:   []rbac.Subject{{Kind: "ServiceAccount", Name: "default", Namespace: "web"}},
+		RoleRef:    rbac.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "Role", Name: "reader"},
+	})
+	s.add(t, "rolebindings", &rbac.RoleBinding{
+		ObjectMeta: api.ObjectMeta{Name: "admin", Namespace: "web"},
+		Subjects:   []rbac.Subject{{Kind: "User", Name: "jane"}},
+		RoleRef:    rbac.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "ClusterRole", Name: "admin"},
+	})
+	s.add(t, "clusterroles", &rbac.ClusterRole{
+		ObjectMeta: api.ObjectMeta{Name: "admin"},
+		Rules:      []rbac.PolicyRule{{Verbs: []string{"*"}, APIGroups: []string{"*"}, Resources: []string{"*"}}},
+	})
+	s.add(t, "clusterrolebindings", &rbac.ClusterRoleBinding{
+		ObjectMeta: api.ObjectMeta{Name: "cluster-admin"},
+		Subjects:   []rbac.Subject{{Kind: "Group", Name: "system:masters"}},
+		RoleRef:    rbac.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "ClusterRole", Name: "admin"},
+	})
+
+	files := dumpTestCluster(t, s, nil)
+
+	namespace := string(files["web.yaml"])
+	for _, expected := range []string{
+		"# roles\n---\napiVersion: rbac.authorization.k8s.io/v1alpha1\nkind: Role\n",
+		"# rolebindings\n---\napiVersion: rbac.authorization.k8s.io/v1alpha1\nkind: RoleBinding\n",
+		"roleRef:\n  apiGroup: rbac.authorization.k8s.io\n  kind: ClusterRole\n  name: admin\n",
+		"roleRef:\n  apiGroup: rbac.authorization.k8s.io\n  kind: Role\n  name: reader\n",
+	} {
+		if !strings.Contains(namespace, expected) {
+			t.Errorf("expected %q in web.yaml, got\n%v", expected, namespace)
+		}
+	}
+	if strings.Contains(namespace, "\nkind: ClusterRole") {
+		t.Errorf("expected the cluster-scoped objects only in _cluster.yaml, got\n%v", namespace)
+	}
+
+	cluster := string(files["_cluster.yaml"])
+	for _, expected := range []string{
+		"apiVersion: rbac.authorization.k8s.io/v1alpha1\nkind: ClusterRole\n",
+		"apiVersion: rbac.authorization.k8s.io/v1alpha1\nkind: ClusterRoleBinding\n",
+		"  name: system:masters\n",
+	} {
+		if !strings.Contains(cluster, expected) {
+			t.Errorf("expected %q in _cluster.yaml, got\n%v", expected, cluster)
+		}
+	}
+
+	// the cluster-scoped types are listed once, without a namespace
+	for _, path := range []string{
+		"GET /apis/rbac.authorization.k8s.io/v1alpha1/clusterroles",
+		"GET /apis/rbac.authorization.k8s.io/v1alpha1/clusterrolebindings",
+		"GET /apis/rbac.authorization.k8s.io/v1alpha1/namespaces/web/roles",
+		"GET /apis/rbac.authorization.k8s.io/v1alpha1/namespaces/web/rolebindings",
+	} {
+		count := 0
+		for _, r := range s.received("GET") {
+			if r == path {
+				count++
+			}
+		}
+		if count != 1 {
+			t.Errorf("expected the request %v once, got %v", path, count)
+		}
+	}
+
+	files = dumpTestCluster(t, s, func(o *Options) {
+		o.SkipTypes = append(o.SkipTypes, "clusterroles", "clusterrolebindings", "roles", "rolebindings")
+	})
+	if dumped := string(files["web.yaml"]) + string(files["_cluster.yaml"]); strings.Contains(dumped, "rbac.authorization.k8s.io/v1alpha1\nkind") {
+		t.Errorf("expected no RBAC objects with --skip-types, got\n%v", dumped)
+	}
+}
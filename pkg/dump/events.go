@@ -0,0 +1,21 @@
+package dump
+
+import (
+	"time"
+
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	api "k8s.io/kubernetes/pkg/api/v1"
+)
+
+// filterEvents removes the events that did not occur after the
+// time (the last occurrence of each event is used)
+func filterEvents(events *api.EventList, after time.Time) {
+	since := unversioned.NewTime(after)
+	items := []api.Event{}
+	for _, event := range events.Items {
+		if !event.LastTimestamp.Before(since) {
+			items = append(items, event)
+		}
+	}
+	events.Items = items
+}
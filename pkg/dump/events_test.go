@@ -0,0 +1,70 @@
+package dump
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	api "k8s.io/kubernetes/pkg/api/v1"
+)
+
+func TestDumpClusterIncludeEvents(t *testing.T) {
+	s := newFakeAPIServer()
+	defer s.Close()
+	s.add(t, "namespaces", &api.Namespace{ObjectMeta: api.ObjectMeta{Name: "web"}})
+	s.add(t, "configmaps", newTestConfigMap("web", "settings"))
+	now := time.Now()
+	for name, last := range map[string]time.Time{"nginx.recent": now.Add(-time.Minute), "nginx.old": now.Add(-2 * time.Hour)} {
+		s.add(t, "events", &api.Event{
+			ObjectMeta:     api.ObjectMeta{Name: name, Namespace: "web"},
+			InvolvedObject: api.ObjectReference{Kind: "Pod", Namespace: "web", Name: "nginx"},
+			Reason:         "BackOff",
+			LastTimestamp:  unversioned.NewTime(last),
+		})
+	}
+
+	tests := []struct {
+		includeEvents bool
+		eventsSince   time.Duration
+		expected      []string
+	}{
+		{includeEvents: false},
+		{includeEvents: true, expected: []string{"nginx.old", "nginx.recent"}},
+		{includeEvents: true, eventsSince: time.Hour, expected: []string{"nginx.recent"}},
+		// --events-since is ignored without --include-events
+		{includeEvents: false, eventsSince: time.Hour},
+	}
+
+	for _, test := range tests {
+		files := dumpTestCluster(t, s, func(o *Options) {
+			o.IncludeEvents = test.includeEvents
+			o.EventsSince = test.eventsSince
+		})
+
+		web := string(files["web.yaml"])
+		if !strings.Contains(web, "name: settings") {
+			t.Errorf("expected the configmap in the dump, got\n%v", web)
+		}
+		if strings.Contains(web, "# events\n") != (len(test.expected) > 0) {
+			t.Errorf("expected the events only with --include-events (%v), got\n%v", test.includeEvents, web)
+		}
+		for _, name := range []string{"nginx.old", "nginx.recent"} {
+			expected := false
+			for _, e := range test.expected {
+				expected = expected || e == name
+			}
+			if strings.Contains(web, "  name: "+name+"\n") != expected {
+				t.Errorf("expected the event %v in the dump to be %v with --include-events=%v --events-since=%v, got\n%v",
+					name, expected, test.includeEvents, test.eventsSince, web)
+			}
+		}
+	}
+
+	opts := newTestOptions(stdoutOutput)
+	opts.IncludeEvents = true
+	opts.EventsSince = -time.Hour
+	if _, err := DumpCluster(s.client(t), opts); err == nil || !strings.Contains(err.Error(), "invalid events since") {
+		t.Errorf("expected an invalid --events-since error, got %v", err)
+	}
+}
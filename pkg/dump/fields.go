@@ -0,0 +1,178 @@
+package dump
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"k8s.io/kubernetes/pkg/runtime"
+)
+
+// cleanupFields returns a copy of the object with the redaction rules for the
+// kind and the fields to strip applied (and the empty strings removed with
+// --minimal). The changes are made in the JSON representation of the object.
+// If there is nothing to apply the original object is returned
+func cleanupFields(kind string, obj runtime.Object, opts *dumpOptions) (runtime.Object, error) {
+	rules := rulesFor(kind, opts.redactRules)
+	if len(rules) == 0 && opts.fieldStripper == nil && !opts.minimal {
+		return obj, nil
+	}
+
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	var data interface{}
+	err = json.Unmarshal(raw, &data)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rule := range rules {
+		err = rule.apply(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.fieldStripper != nil {
+		opts.fieldStripper.apply(data)
+	}
+
+	if opts.minimal {
+		removeEmptyStrings(data)
+	}
+
+	raw, err = json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &runtime.Unknown{Raw: raw, ContentType: runtime.ContentTypeJSON}, nil
+}
+
+// fieldStripper removes fields from the decoded objects. The paths are read
+// from the file configured in --strip-fields-file, one per line. Each path is a
+// list of fields separated by dots (a literal dot in a key is escaped as \.),
+// e.g. metadata.annotations.deployment\.kubernetes\.io/revision
+// Lists found in the path are traversed, applying the rest of the path to
+// each element. Empty lines and lines starting with # are ignored
+type fieldStripper struct {
+	sync.Mutex
+
+	paths   [][]string
+	raw     []string
+	matched map[int]bool
+}
+
+// loadFieldStripper reads and validates the paths of the fields to strip
+func loadFieldStripper(file string) (*fieldStripper, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "unexpected error reading fields to strip")
+	}
+	defer f.Close()
+
+	stripper := &fieldStripper{matched: map[int]bool{}}
+
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		path := splitFieldPath(text)
+		for _, field := range path {
+			if field == "" || strings.ContainsAny(field, " \t") {
+				return nil, errors.Errorf("invalid field path %q in line %v of %v", text, line, file)
+			}
+		}
+
+		stripper.paths = append(stripper.paths, path)
+		stripper.raw = append(stripper.raw, text)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "unexpected error reading fields to strip")
+	}
+
+	return stripper, nil
+}
+
+// splitFieldPath splits a path by the dots not escaped with \
+func splitFieldPath(path string) []string {
+	fields := []string{}
+	current := ""
+	for i := 0; i < len(path); i++ {
+		switch {
+		case path[i] == '\\' && i+1 < len(path) && path[i+1] == '.':
+			current += "."
+			i++
+		case path[i] == '.':
+			fields = append(fields, current)
+			current = ""
+		default:
+			current += string(path[i])
+		}
+	}
+	return append(fields, current)
+}
+
+// apply removes the fields from a decoded object
+func (f *fieldStripper) apply(data interface{}) {
+	for i, path := range f.paths {
+		if removeField(data, path) {
+			f.Lock()
+			f.matched[i] = true
+			f.Unlock()
+		}
+	}
+}
+
+// unmatched returns the paths that did not match any field during the run
+func (f *fieldStripper) unmatched() []string {
+	f.Lock()
+	defer f.Unlock()
+
+	paths := []string{}
+	for i, raw := range f.raw {
+		if !f.matched[i] {
+			paths = append(paths, raw)
+		}
+	}
+	return paths
+}
+
+// removeField deletes the field located in the path. Returns true if the field was found
+func removeField(data interface{}, path []string) bool {
+	switch value := data.(type) {
+	case []interface{}:
+		found := false
+		for _, item := range value {
+			if removeField(item, path) {
+				found = true
+			}
+		}
+		return found
+	case map[string]interface{}:
+		child, ok := value[path[0]]
+		if !ok {
+			return false
+		}
+		if len(path) == 1 {
+			delete(value, path[0])
+			return true
+		}
+		return removeField(child, path[1:])
+	}
+
+	return false
+}
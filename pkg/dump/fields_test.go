@@ -0,0 +1,119 @@
+package dump
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	api "k8s.io/kubernetes/pkg/api/v1"
+	extensions "k8s.io/kubernetes/pkg/apis/extensions/v1beta1"
+)
+
+// writeFieldsTestFile writes a file with the paths of the fields to strip
+// and returns its path (the caller must remove it)
+func writeFieldsTestFile(t *testing.T, content string) string {
+	f, err := ioutil.TempFile("", "fields")
+	if err != nil {
+		t.Fatalf("unexpected error creating the fields file: %v", err)
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(content)
+	if err != nil {
+		t.Fatalf("unexpected error writing the fields file: %v", err)
+	}
+	return f.Name()
+}
+
+func TestLoadFieldStripper(t *testing.T) {
+	path := writeFieldsTestFile(t, `
+# scrub policy
+metadata.annotations.deployment\.kubernetes\.io/revision
+
+  spec.template.spec.containers.terminationMessagePath
+`)
+	defer os.Remove(path)
+
+	stripper, err := loadFieldStripper(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := [][]string{
+		{"metadata", "annotations", "deployment.kubernetes.io/revision"},
+		{"spec", "template", "spec", "containers", "terminationMessagePath"},
+	}
+	if !reflect.DeepEqual(stripper.paths, expected) {
+		t.Errorf("expected the paths %v, got %v", expected, stripper.paths)
+	}
+}
+
+func TestLoadFieldStripperInvalid(t *testing.T) {
+	for _, content := range []string{
+		"metadata..annotations\n",
+		"metadata.annotations.\n",
+		".metadata\n",
+		"# comment\nmetadata.my annotation\n",
+	} {
+		path := writeFieldsTestFile(t, content)
+		_, err := loadFieldStripper(path)
+		os.Remove(path)
+
+		if err == nil || !strings.Contains(err.Error(), "invalid field path") {
+			t.Errorf("expected an invalid field path error for %q, got %v", content, err)
+		}
+	}
+
+	_, err := loadFieldStripper("/nonexistent/fields")
+	if err == nil || !strings.Contains(err.Error(), "unexpected error reading fields to strip") {
+		t.Errorf("expected an error reading a missing file, got %v", err)
+	}
+}
+
+func TestDumpClusterStripFieldsFile(t *testing.T) {
+	s := newFakeAPIServer()
+	defer s.Close()
+	s.add(t, "namespaces", &api.Namespace{ObjectMeta: api.ObjectMeta{Name: "web"}})
+	s.add(t, "deployments", &extensions.Deployment{
+		ObjectMeta: api.ObjectMeta{Name: "nginx", Namespace: "web", Annotations: map[string]string{
+			"deployment.kubernetes.io/revision": "3",
+			"team":                              "web",
+		}},
+		Spec: extensions.DeploymentSpec{Template: api.PodTemplateSpec{Spec: api.PodSpec{Containers: []api.Container{
+			{Name: "nginx", Image: "nginx:1.11", TerminationMessagePath: "/dev/termination-log"},
+			{Name: "sidecar", Image: "busybox", TerminationMessagePath: "/dev/termination-log"},
+		}}}},
+	})
+
+	path := writeFieldsTestFile(t, `metadata.annotations.deployment\.kubernetes\.io/revision
+spec.template.spec.containers.terminationMessagePath
+spec.nonexistent
+`)
+	defer os.Remove(path)
+
+	out := &bytes.Buffer{}
+	logger, _ := NewLogger("json", out)
+	files := dumpTestCluster(t, s, func(o *Options) {
+		o.Logger = logger
+		o.IncludeTypes = []string{"deployments"}
+		o.StripFieldsFile = path
+	})
+
+	web := string(files["web.yaml"])
+	if strings.Contains(web, "deployment.kubernetes.io/revision") || strings.Contains(web, "terminationMessagePath") {
+		t.Errorf("expected the fields to be removed (in all the containers), got\n%v", web)
+	}
+	if !strings.Contains(web, "team: web") || !strings.Contains(web, "name: sidecar") {
+		t.Errorf("expected the other fields to be kept, got\n%v", web)
+	}
+
+	// the paths that do not match any object are reported
+	messages := strings.Join(logMessages(t, out), "\n")
+	if !strings.Contains(messages, "the field spec.nonexistent was not found in any object") ||
+		strings.Contains(messages, "the field spec.template") {
+		t.Errorf("expected only the warning of spec.nonexistent, got\n%v", messages)
+	}
+}
@@ -0,0 +1,80 @@
+package dump
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"k8s.io/kubernetes/pkg/api/meta"
+	api "k8s.io/kubernetes/pkg/api/v1"
+)
+
+// writeGitOpsLayout creates the directory <output>/<namespace> containing
+// the Namespace object in namespace.yaml, one file per type with objects
+// (with the extension of the output format)
+// and a kustomization.yaml file listing all the files
+func writeGitOpsLayout(namespace *api.Namespace, data map[string]interface{}, objects marshaledObjects, notFound []string, opts *dumpOptions) error {
+	ns := sanitizePathSegment(namespace.Name)
+	err := os.MkdirAll(fmt.Sprintf("%v/%v", opts.output, ns), opts.dirMode)
+	if err != nil {
+		return errors.Wrap(err, "unexpected error creating namespace directory")
+	}
+
+	namespaceFile := fileName("namespace", opts)
+	err = writeObject(fmt.Sprintf("%v/%v", ns, namespaceFile), "", objects[namespace], opts)
+	if err != nil {
+		return err
+	}
+
+	types := []string{}
+	for objectType := range data {
+		types = append(types, objectType)
+	}
+	sort.Strings(types)
+
+	resources := []string{namespaceFile}
+	for _, objectType := range types {
+		result := data[objectType].(*k8sObject)
+		items, err := meta.ExtractList(result.Runtime)
+		if err != nil {
+			return errors.Wrap(err, "unexpected error extracting items")
+		}
+
+		documents := []string{}
+		for _, item := range items {
+			s := objects[item]
+			if s == "" {
+				continue
+			}
+
+			documents = append(documents, s)
+		}
+
+		if len(documents) == 0 {
+			continue
+		}
+
+		name := fileName(sanitizePathSegment(objectType), opts)
+		err = writeDocuments(fmt.Sprintf("%v/%v", ns, name), documents, opts)
+		if err != nil {
+			return err
+		}
+
+		resources = append(resources, name)
+	}
+
+	kustomization := new(bytes.Buffer)
+	kustomization.WriteString("# errors:\n")
+	for _, msg := range notFound {
+		kustomization.WriteString(fmt.Sprintf("# %v\n", msg))
+	}
+	kustomization.WriteString("\napiVersion: kustomize.config.k8s.io/v1beta1\nkind: Kustomization\nresources:\n")
+	for _, resource := range resources {
+		kustomization.WriteString(fmt.Sprintf("- %v\n", resource))
+	}
+
+	return writeOutput(fmt.Sprintf("%v/kustomization.yaml", ns), kustomization.Bytes(), opts)
+}
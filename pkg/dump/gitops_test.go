@@ -0,0 +1,37 @@
+package dump
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDumpClusterGitOpsLayout(t *testing.T) {
+	s := newTestCluster(t)
+	defer s.Close()
+
+	files := dumpTestCluster(t, s, func(o *Options) { o.GitOpsLayout = true })
+
+	for _, ns := range []string{"web", "other"} {
+		expected := "resources:\n- namespace.yaml\n- configmaps.yaml\n- deployments.yaml\n- services.yaml\n"
+		if kustomization := string(files[ns+"/kustomization.yaml"]); !strings.HasSuffix(kustomization, expected) {
+			t.Errorf("expected the files of the namespace %v in the kustomization, got\n%v", ns, kustomization)
+		}
+
+		if namespace := string(files[ns+"/namespace.yaml"]); !strings.Contains(namespace, "kind: Namespace") || !strings.Contains(namespace, "name: "+ns) {
+			t.Errorf("expected the namespace %v in namespace.yaml, got\n%v", ns, namespace)
+		}
+		if configmaps := string(files[ns+"/configmaps.yaml"]); strings.Count(configmaps, "kind: ConfigMap") != 3 {
+			t.Errorf("expected the 3 configmaps of %v in configmaps.yaml, got\n%v", ns, configmaps)
+		}
+		if services := string(files[ns+"/services.yaml"]); !strings.Contains(services, "kind: Service") || strings.Contains(services, "kind: ConfigMap") {
+			t.Errorf("expected only the services of %v in services.yaml, got\n%v", ns, services)
+		}
+	}
+
+	// there is no file per namespace
+	for _, path := range []string{"web.yaml", "other.yaml"} {
+		if _, ok := files[path]; ok {
+			t.Errorf("expected no file %v with the gitops layout", path)
+		}
+	}
+}
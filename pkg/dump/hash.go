@@ -0,0 +1,44 @@
+package dump
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// hashIndex maps each namespace to the name of the file containing the
+// dump when --output-hash-names is set
+type hashIndex struct {
+	sync.Mutex
+	files map[string]string
+}
+
+func newHashIndex() *hashIndex {
+	return &hashIndex{files: map[string]string{}}
+}
+
+// hashName returns the name of the file for a content (the SHA256 of the content)
+func hashName(content []byte, opts *dumpOptions) string {
+	return fileName(fmt.Sprintf("%x", sha256.Sum256(content)), opts)
+}
+
+// add records the file that contains the dump of a namespace
+func (h *hashIndex) add(ns, file string) {
+	h.Lock()
+	defer h.Unlock()
+	h.files[ns] = file
+}
+
+// write creates the file index.json in the output directory
+func (h *hashIndex) write(opts *dumpOptions) error {
+	h.Lock()
+	defer h.Unlock()
+
+	data, err := json.MarshalIndent(h.files, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeOutput("index.json", append(data, '\n'), opts)
+}
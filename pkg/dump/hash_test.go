@@ -0,0 +1,63 @@
+package dump
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// dumpTestClusterHashNames dumps the cluster with --output-hash-names and
+// returns the files and the decoded index.json
+func dumpTestClusterHashNames(t *testing.T, s *fakeAPIServer) (map[string][]byte, map[string]string) {
+	files := dumpTestCluster(t, s, func(o *Options) { o.OutputHashNames = true })
+
+	index := map[string]string{}
+	err := json.Unmarshal(files["index.json"], &index)
+	if err != nil {
+		t.Fatalf("unexpected error decoding index.json: %v\n%s", err, files["index.json"])
+	}
+	return files, index
+}
+
+func TestDumpClusterOutputHashNames(t *testing.T) {
+	s := newTestCluster(t)
+	defer s.Close()
+
+	files, index := dumpTestClusterHashNames(t, s)
+	if len(index) != 2 || index["web"] == "" || index["other"] == "" {
+		t.Fatalf("expected the files of the namespaces web and other in index.json, got %v", index)
+	}
+	for ns, name := range index {
+		content, ok := files[name]
+		if !ok {
+			t.Errorf("expected the file %v of the namespace %v", name, ns)
+			continue
+		}
+		if expected := fmt.Sprintf("%x.yaml", sha256.Sum256(content)); name != expected {
+			t.Errorf("expected the name %v for the namespace %v, got %v", expected, ns, name)
+		}
+	}
+	for _, path := range []string{"web.yaml", "other.yaml"} {
+		if _, ok := files[path]; ok {
+			t.Errorf("expected no file %v with --output-hash-names", path)
+		}
+	}
+
+	// the same content has the same names
+	second, secondIndex := dumpTestClusterHashNames(t, s)
+	if !reflect.DeepEqual(index, secondIndex) {
+		t.Errorf("expected the same names in each dump, got %v and %v", index, secondIndex)
+	}
+	compareDumps(t, files, second)
+
+	// only the name of the modified namespace changes
+	cm := newTestConfigMap("web", "settings")
+	cm.Data["color"] = "green"
+	s.add(t, "configmaps", cm)
+	_, changed := dumpTestClusterHashNames(t, s)
+	if changed["web"] == index["web"] || changed["other"] != index["other"] {
+		t.Errorf("expected only the name of web to change, got %v and %v", index, changed)
+	}
+}
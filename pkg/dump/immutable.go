@@ -0,0 +1,42 @@
+package dump
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// immutableKinds kinds that can be marked as immutable
+var immutableKinds = []string{"ConfigMap", "Secret"}
+
+// isImmutable returns true if a decoded configmap or secret is immutable
+func isImmutable(obj map[string]interface{}) bool {
+	kind, _ := obj["kind"].(string)
+	immutable, _ := obj["immutable"].(bool)
+	return immutable && containsName(kind, immutableKinds)
+}
+
+// requestBody returns the body of the requests that create or update an
+// object. The Go types of the vendored API do not have the immutable field,
+// so the immutable objects are encoded with the field added unless it is stripped
+func requestBody(item restoreItem, opts RestoreOptions) (interface{}, error) {
+	if !item.immutable || opts.StripImmutable {
+		return item.obj, nil
+	}
+
+	b, err := json.Marshal(item.obj)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unexpected error encoding %v", item)
+	}
+
+	obj := map[string]interface{}{}
+	err = json.Unmarshal(b, &obj)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unexpected error encoding %v", item)
+	}
+
+	obj["kind"] = item.kind
+	obj["apiVersion"] = item.apiVersion
+	obj["immutable"] = true
+	return json.Marshal(obj)
+}
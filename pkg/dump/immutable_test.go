@@ -0,0 +1,61 @@
+package dump
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	api "k8s.io/kubernetes/pkg/api/v1"
+)
+
+// newImmutableConfigMap returns a decoded immutable configmap
+func newImmutableConfigMap() map[string]interface{} {
+	obj := newTestObject("ConfigMap", "v1", "web", "settings")
+	obj["data"] = map[string]interface{}{"color": "green"}
+	obj["immutable"] = true
+	return obj
+}
+
+func TestRestoreImmutable(t *testing.T) {
+	for _, strip := range []bool{false, true} {
+		s := newFakeAPIServer()
+
+		result := Restore(s.client(t), []map[string]interface{}{newImmutableConfigMap()}, RestoreOptions{StripImmutable: strip})
+		if result.Failed() {
+			t.Fatalf("unexpected errors (strip %v): %v", strip, result.Errors)
+		}
+		if expected := []string{"configmaps/web/settings"}; !reflect.DeepEqual(result.Immutable, expected) {
+			t.Errorf("expected the immutable objects %v, got %v", expected, result.Immutable)
+		}
+
+		cm := s.object("configmaps", "web", "settings")
+		if immutable, _ := cm["immutable"].(bool); immutable == strip {
+			t.Errorf("expected immutable %v with strip %v, got %v", !strip, strip, cm)
+		}
+		if cm["data"].(map[string]interface{})["color"] != "green" {
+			t.Errorf("expected the data of the configmap, got %v", cm)
+		}
+		s.Close()
+	}
+}
+
+func TestRestoreOverwriteImmutable(t *testing.T) {
+	s := newFakeAPIServer()
+	defer s.Close()
+	s.add(t, "namespaces", &api.Namespace{ObjectMeta: api.ObjectMeta{Name: "web"}})
+	s.add(t, "configmaps", &api.ConfigMap{
+		ObjectMeta: api.ObjectMeta{Name: "settings", Namespace: "web"},
+		Data:       map[string]string{"color": "blue"},
+	})
+	s.object("configmaps", "web", "settings")["immutable"] = true
+
+	result := Restore(s.client(t), []map[string]interface{}{newImmutableConfigMap()}, RestoreOptions{Overwrite: true, StripImmutable: true})
+
+	if len(result.Errors) != 1 || !strings.Contains(result.Errors[0], "configmaps/web/settings is immutable in the cluster") {
+		t.Fatalf("expected an error for the immutable configmap, got %v", result.Errors)
+	}
+	if len(s.received("PUT")) != 1 {
+		// only the namespace is updated
+		t.Errorf("expected the immutable configmap not to be updated, got %v", s.received("PUT"))
+	}
+}
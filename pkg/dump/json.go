@@ -0,0 +1,121 @@
+package dump
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"k8s.io/kubernetes/pkg/api/meta"
+	api "k8s.io/kubernetes/pkg/api/v1"
+	"k8s.io/kubernetes/pkg/runtime"
+)
+
+// JSONPrinter is an implementation of ResourcePrinter which outputs an object as indented JSON.
+type JSONPrinter struct{}
+
+func (p *JSONPrinter) AfterPrint(w io.Writer, res string) error {
+	return nil
+}
+
+// PrintObj prints the data as indented JSON.
+func (p *JSONPrinter) PrintObj(obj runtime.Object, w io.Writer) error {
+	switch obj := obj.(type) {
+	case *runtime.Unknown:
+		var buf bytes.Buffer
+		err := json.Indent(&buf, obj.Raw, "", "  ")
+		if err != nil {
+			return err
+		}
+		buf.WriteString("\n")
+		_, err = buf.WriteTo(w)
+		return err
+	}
+
+	output, err := json.MarshalIndent(obj, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(output))
+	return err
+}
+
+// TODO: implement HandledResources()
+func (p *JSONPrinter) HandledResources() []string {
+	return []string{}
+}
+
+// printJSON returns the JSON representation of an object including the
+// apiVersion and kind
+func printJSON(kind, apiVersion string, obj runtime.Object) (string, error) {
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		return "", err
+	}
+
+	var data map[string]interface{}
+	err = json.Unmarshal(raw, &data)
+	if err != nil {
+		return "", err
+	}
+
+	data["apiVersion"] = apiVersion
+	data["kind"] = kind
+
+	raw, err = json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+
+	buf := new(bytes.Buffer)
+	err = (&JSONPrinter{}).PrintObj(&runtime.Unknown{Raw: raw, ContentType: runtime.ContentTypeJSON}, buf)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// jsonList is the v1 List used to write multiple objects in a JSON file
+type jsonList struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Items      []json.RawMessage `json:"items"`
+}
+
+// namespaceJSON returns the content of the json file of a namespace: a List
+// with the Namespace object (if it was not moved to the beginning of the standard
+// output) followed by the objects of each type.
+// JSON does not support comments so the errors found during the dump are
+// not included (the objects that could not be converted are recorded in
+// the result)
+func namespaceJSON(namespace *api.Namespace, data map[string]interface{}, objects marshaledObjects, opts *dumpOptions) ([]byte, error) {
+	w := newDocumentWriter("", opts)
+	if s := objects[namespace]; s != "" {
+		w.add(s)
+	}
+
+	types := []string{}
+	for objectType := range data {
+		types = append(types, objectType)
+	}
+	sort.Strings(types)
+
+	for _, objectType := range types {
+		result := data[objectType].(*k8sObject)
+		items, err := meta.ExtractList(result.Runtime)
+		if err != nil {
+			return nil, errors.Wrap(err, "unexpected error extracting items")
+		}
+
+		for _, item := range items {
+			if s := objects[item]; s != "" {
+				w.add(s)
+			}
+		}
+	}
+
+	return w.bytes()
+}
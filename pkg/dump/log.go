@@ -0,0 +1,113 @@
+package dump
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// validLogFormat checks the value of the --log-format flag
+func validLogFormat(format string) error {
+	switch format {
+	case "text", "json":
+		return nil
+	default:
+		return fmt.Errorf("invalid log format %q (valid values are text and json)", format)
+	}
+}
+
+// Logger writes the messages of the dump. With the text format the messages
+// are written by glog, with the json format each message is written to out
+// as a JSON object in a line. The methods can be used on a nil Logger (text format)
+type Logger struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// NewLogger returns a Logger for the format (text or json)
+func NewLogger(format string, out io.Writer) (*Logger, error) {
+	err := validLogFormat(format)
+	if err != nil {
+		return nil, err
+	}
+
+	if format == "text" {
+		return nil, nil
+	}
+	return &Logger{out: out}, nil
+}
+
+// logEntry is a message in the json format
+type logEntry struct {
+	Time      string `json:"time"`
+	Level     string `json:"level"`
+	Message   string `json:"msg"`
+	Namespace string `json:"namespace,omitempty"`
+	Type      string `json:"type,omitempty"`
+}
+
+// Debugf logs a message when the verbosity is 2 or greater.
+// ns and objectType are empty if the message is not about a namespace or type
+func (l *Logger) Debugf(ns, objectType, format string, args ...interface{}) {
+	if !glog.V(2) {
+		return
+	}
+
+	if l == nil {
+		glog.InfoDepth(1, fmt.Sprintf(format, args...))
+		return
+	}
+	l.write("debug", ns, objectType, format, args...)
+}
+
+// Infof logs an informational message
+func (l *Logger) Infof(ns, objectType, format string, args ...interface{}) {
+	if l == nil {
+		glog.InfoDepth(1, fmt.Sprintf(format, args...))
+		return
+	}
+	l.write("info", ns, objectType, format, args...)
+}
+
+// Warningf logs a warning
+func (l *Logger) Warningf(ns, objectType, format string, args ...interface{}) {
+	if l == nil {
+		glog.WarningDepth(1, fmt.Sprintf(format, args...))
+		return
+	}
+	l.write("warning", ns, objectType, format, args...)
+}
+
+// Errorf logs an error
+func (l *Logger) Errorf(ns, objectType, format string, args ...interface{}) {
+	if l == nil {
+		glog.ErrorDepth(1, fmt.Sprintf(format, args...))
+		return
+	}
+	l.write("error", ns, objectType, format, args...)
+}
+
+func (l *Logger) write(level, ns, objectType, format string, args ...interface{}) {
+	entry := logEntry{
+		Time:      time.Now().UTC().Format(time.RFC3339),
+		Level:     level,
+		Message:   strings.TrimSpace(fmt.Sprintf(format, args...)),
+		Namespace: ns,
+		Type:      objectType,
+	}
+
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		glog.Errorf("unexpected error encoding log message: %v", err)
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintf(l.out, "%s\n", raw)
+}
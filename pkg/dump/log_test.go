@@ -0,0 +1,121 @@
+package dump
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewLogger(t *testing.T) {
+	out := new(bytes.Buffer)
+	logger, err := NewLogger("text", out)
+	if err != nil || logger != nil {
+		t.Errorf("expected a nil logger with the text format, got %v %v", logger, err)
+	}
+	// the messages of the text format are written by glog
+	logger.Infof("web", "", "dumping namespace %v", "web")
+	if out.Len() != 0 {
+		t.Errorf("expected no output with the text format, got %q", out.String())
+	}
+
+	if _, err := NewLogger("logfmt", out); err == nil || !strings.Contains(err.Error(), `invalid log format "logfmt"`) {
+		t.Errorf("expected an invalid log format error, got %v", err)
+	}
+}
+
+func TestLoggerJSON(t *testing.T) {
+	out := new(bytes.Buffer)
+	logger, err := NewLogger("json", out)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			logger.Warningf("web", "jobs", "forbidden to list objects of type %v in namespace %v\n", "jobs", "web")
+		}()
+	}
+	wg.Wait()
+	logger.Errorf("", "", "unexpected error: %v", "timeout")
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 11 {
+		t.Fatalf("expected a line per message, got\n%v", out.String())
+	}
+	for _, line := range lines[:10] {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("unexpected error decoding the line %q: %v", line, err)
+		}
+		if _, err := time.Parse(time.RFC3339, entry["time"].(string)); err != nil {
+			t.Errorf("expected the time in RFC 3339 format, got %v", entry["time"])
+		}
+		delete(entry, "time")
+		expected := map[string]interface{}{
+			"level":     "warning",
+			"msg":       "forbidden to list objects of type jobs in namespace web",
+			"namespace": "web",
+			"type":      "jobs",
+		}
+		if !reflect.DeepEqual(entry, expected) {
+			t.Errorf("expected the entry %v, got %v", expected, entry)
+		}
+	}
+	// the empty namespace and type are omitted
+	if last := lines[10]; !strings.HasSuffix(last, `"level":"error","msg":"unexpected error: timeout"}`) {
+		t.Errorf("expected the error without namespace and type, got %v", last)
+	}
+}
+
+func TestDumpClusterLogFormatJSON(t *testing.T) {
+	s := newTestCluster(t)
+	defer s.Close()
+	s.handle = func(w http.ResponseWriter, r *http.Request) bool {
+		req, _ := parseFakeRequest(r.URL.Path)
+		switch {
+		case req.objectType == "jobs":
+			writeFakeStatus(w, http.StatusForbidden, "Forbidden", "jobs is forbidden")
+			return true
+		case req.objectType == "services" && req.namespace == "other":
+			writeFakeStatus(w, http.StatusInternalServerError, "InternalError", "etcd timeout")
+			return true
+		}
+		return false
+	}
+
+	out := new(bytes.Buffer)
+	logger, _ := NewLogger("json", out)
+	result, _ := runTestDump(t, s, func(o *Options) { o.Logger = logger })
+	result.Log()
+
+	messages := logMessages(t, out)
+	for _, expected := range []string{
+		"info web  dumping namespace web",
+		"info web  namespace web dumped in <duration> (5 objects)",
+		"warning web jobs forbidden to list objects of type jobs in namespace web",
+	} {
+		found := false
+		for _, msg := range messages {
+			found = found || msg == expected
+		}
+		if !found {
+			t.Errorf("expected the message %q, got\n%v", expected, strings.Join(messages, "\n"))
+		}
+	}
+
+	found := false
+	for _, msg := range messages {
+		found = found || (strings.HasPrefix(msg, "error other services ") && strings.Contains(msg, "etcd timeout"))
+	}
+	if !found {
+		t.Errorf("expected the error of the services of the namespace other, got\n%v", strings.Join(messages, "\n"))
+	}
+}
@@ -0,0 +1,90 @@
+package dump
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+
+	api "k8s.io/kubernetes/pkg/api/v1"
+	client "k8s.io/kubernetes/pkg/client/clientset_generated/release_1_5"
+)
+
+// collectPodLogs writes the logs of the containers of the pods located in a
+// namespace to <output>/<namespace>/logs/<pod>-<container>.log
+// Completed pods (succeeded, failed or evicted) are skipped unless
+// --logs-include-completed is set. Containers without logs are logged and skipped
+func collectPodLogs(kubeClient *client.Clientset, ns string, opts *dumpOptions) error {
+	pods, err := kubeClient.Core().Pods(ns).List(api.ListOptions{LabelSelector: opts.labelSelector, FieldSelector: opts.fieldSelector})
+	if err != nil {
+		return errors.Wrap(err, "unexpected error obtaining information about the pods")
+	}
+
+	dir := fmt.Sprintf("%v/%v/logs", opts.output, sanitizePathSegment(ns))
+	err = os.MkdirAll(dir, opts.dirMode)
+	if err != nil {
+		return errors.Wrap(err, "unexpected error creating logs directory")
+	}
+
+	for _, pod := range pods.Items {
+		if !opts.logsIncludeCompleted && (pod.Status.Phase == api.PodSucceeded || pod.Status.Phase == api.PodFailed) {
+			continue
+		}
+
+		for _, container := range pod.Spec.Containers {
+			logOpts := &api.PodLogOptions{Container: container.Name}
+			if opts.logTailLines > 0 {
+				tailLines := opts.logTailLines
+				logOpts.TailLines = &tailLines
+			}
+
+			name := fmt.Sprintf("%v/logs/%v", sanitizePathSegment(ns), sanitizePathSegment(pod.Name+"-"+container.Name+".log"))
+			n, sum, err := writePodLog(kubeClient, ns, pod.Name, logOpts, fmt.Sprintf("%v/%v", opts.output, name), opts.fileMode, opts.failIfExists)
+			if err != nil {
+				opts.log.Warningf(ns, "pods", "unable to collect logs of container %v in pod %v/%v: %v", container.Name, ns, pod.Name, err)
+				continue
+			}
+
+			opts.manifest.addSum(name, sum)
+			opts.sizeBudget.add(n)
+		}
+	}
+
+	return nil
+}
+
+// writePodLog streams the log of a container to a file and returns the number
+// of bytes written and the SHA-256 of the content. If the stream fails the
+// partial file is removed
+func writePodLog(kubeClient *client.Clientset, ns, pod string, logOpts *api.PodLogOptions, path string, mode os.FileMode, exclusive bool) (int64, string, error) {
+	stream, err := kubeClient.Core().Pods(ns).GetLogs(pod, logOpts).Stream()
+	if err != nil {
+		return 0, "", err
+	}
+	defer stream.Close()
+
+	f, err := createFile(path, mode, exclusive)
+	if err != nil {
+		return 0, "", err
+	}
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h), stream)
+	if err != nil {
+		// do not leave a partial file
+		f.Close()
+		os.Remove(path)
+		return 0, "", err
+	}
+
+	err = f.Close()
+	if err != nil {
+		os.Remove(path)
+		return 0, "", err
+	}
+
+	return n, hex.EncodeToString(h.Sum(nil)), nil
+}
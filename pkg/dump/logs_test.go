@@ -0,0 +1,77 @@
+package dump
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	api "k8s.io/kubernetes/pkg/api/v1"
+)
+
+func TestCollectPodLogs(t *testing.T) {
+	s := newFakeAPIServer()
+	defer s.Close()
+
+	for _, name := range []string{"broken", "completed", "ok"} {
+		pod := &api.Pod{
+			ObjectMeta: api.ObjectMeta{Name: name, Namespace: "web"},
+			Spec:       api.PodSpec{Containers: []api.Container{{Name: "app"}}},
+			Status:     api.PodStatus{Phase: api.PodRunning},
+		}
+		if name == "completed" {
+			pod.Status.Phase = api.PodSucceeded
+		}
+		s.add(t, "pods", pod)
+	}
+	s.logs["web/ok"] = "line 1\nline 2\n"
+	s.logs["web/completed"] = "done\n"
+	s.handle = func(w http.ResponseWriter, r *http.Request) bool {
+		if !strings.HasSuffix(r.URL.Path, "/pods/broken/log") {
+			return false
+		}
+		// the stream is cut before the declared length
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Length", "1000")
+		w.Write([]byte("partial line"))
+		w.(http.Flusher).Flush()
+		return true
+	}
+
+	dir, err := ioutil.TempDir("", "dump")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	options := newTestOptions(dir)
+	options.CollectLogs = true
+	options.MaxTotalSize = 1 << 20
+	opts := completeTestOptions(t, options)
+
+	err = collectPodLogs(s.client(t), "web", opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "web/logs/ok-app.log"))
+	if err != nil || string(b) != s.logs["web/ok"] {
+		t.Errorf("expected the log of the pod ok, got %q (%v)", b, err)
+	}
+
+	for _, name := range []string{"broken-app.log", "completed-app.log"} {
+		if _, err := os.Stat(filepath.Join(dir, "web/logs", name)); !os.IsNotExist(err) {
+			t.Errorf("expected no file %v, got %v", name, err)
+		}
+	}
+
+	if opts.sizeBudget.written != int64(len(s.logs["web/ok"])) {
+		t.Errorf("expected %v bytes written, got %v", len(s.logs["web/ok"]), opts.sizeBudget.written)
+	}
+
+	if _, ok := opts.manifest.sums["web/logs/broken-app.log"]; ok {
+		t.Errorf("expected the partial log not to be in the manifest")
+	}
+}
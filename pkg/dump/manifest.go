@@ -0,0 +1,123 @@
+package dump
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// manifestFile name of the file with the SHA-256 of the files of the dump
+const manifestFile = "_manifest.sha256"
+
+// manifest collects the SHA-256 of the files written during the dump.
+// The files are added from the goroutines that dump each namespace
+type manifest struct {
+	sync.Mutex
+	sums map[string]string
+}
+
+func newManifest() *manifest {
+	return &manifest{sums: map[string]string{}}
+}
+
+// add records the hash of the content of a file
+func (m *manifest) add(name string, content []byte) {
+	sum := sha256.Sum256(content)
+	m.addSum(name, hex.EncodeToString(sum[:]))
+}
+
+// addSum records the hash of a file
+func (m *manifest) addSum(name, sum string) {
+	if m == nil || name == manifestFile {
+		return
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	m.sums[name] = sum
+}
+
+// write creates the manifest file with one line per file in the format of
+// sha256sum (<hash>  <name>), ordered by name
+func (m *manifest) write(opts *dumpOptions) error {
+	m.Lock()
+	defer m.Unlock()
+
+	names := []string{}
+	for name := range m.sums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buf := new(bytes.Buffer)
+	for _, name := range names {
+		buf.WriteString(fmt.Sprintf("%v  %v\n", m.sums[name], name))
+	}
+
+	return writeOutput(manifestFile, buf.Bytes(), opts)
+}
+
+// VerifyManifest checks the files of a dump directory against its manifest.
+// It returns the number of files checked and the files that are missing or
+// have a different content
+func VerifyManifest(dir string) (int, []string, error) {
+	f, err := os.Open(fmt.Sprintf("%v/%v", dir, manifestFile))
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "unexpected error reading the manifest")
+	}
+	defer f.Close()
+
+	checked := 0
+	problems := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+
+		parts := strings.SplitN(line, "  ", 2)
+		if len(parts) != 2 {
+			return checked, problems, fmt.Errorf("invalid manifest line %q", line)
+		}
+
+		sum, err := fileSum(fmt.Sprintf("%v/%v", dir, parts[1]))
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%v: %v", parts[1], err))
+		} else if sum != parts[0] {
+			problems = append(problems, fmt.Sprintf("%v: the content does not match the manifest", parts[1]))
+		}
+		checked++
+	}
+
+	if err := scanner.Err(); err != nil {
+		return checked, problems, errors.Wrap(err, "unexpected error reading the manifest")
+	}
+
+	return checked, problems, nil
+}
+
+// fileSum returns the SHA-256 of the content of a file
+func fileSum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
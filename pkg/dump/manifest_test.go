@@ -0,0 +1,92 @@
+package dump
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestDumpClusterManifest(t *testing.T) {
+	s := newTestCluster(t)
+	defer s.Close()
+
+	files := dumpTestCluster(t, s, nil)
+	manifest, ok := files[manifestFile]
+	if !ok {
+		t.Fatalf("expected the file %v in the dump", manifestFile)
+	}
+
+	paths := []string{}
+	for path := range files {
+		if path != manifestFile {
+			paths = append(paths, path)
+		}
+	}
+	// the lines are ordered by the name of the file
+	sort.Strings(paths)
+
+	expected := []string{}
+	for _, path := range paths {
+		sum := sha256.Sum256(files[path])
+		expected = append(expected, hex.EncodeToString(sum[:])+"  "+path)
+	}
+
+	if lines := strings.Split(strings.TrimSuffix(string(manifest), "\n"), "\n"); strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected the manifest\n%v\ngot\n%s", strings.Join(expected, "\n"), manifest)
+	}
+}
+
+func TestVerifyManifest(t *testing.T) {
+	s := newTestCluster(t)
+	defer s.Close()
+
+	dir, err := ioutil.TempDir("", "dump")
+	if err != nil {
+		t.Fatalf("unexpected error creating a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	result, err := DumpCluster(s.client(t), newTestOptions(dir))
+	if err != nil || result.Failed() {
+		t.Fatalf("unexpected error dumping the cluster: %v %v", err, result.Err())
+	}
+
+	checked, problems, err := VerifyManifest(dir)
+	if err != nil || len(problems) != 0 || checked != 4 {
+		t.Fatalf("expected the 4 files of the dump to match the manifest, got %v %v %v", checked, problems, err)
+	}
+
+	// a modified and a missing file
+	if err := ioutil.WriteFile(filepath.Join(dir, "web.yaml"), []byte("apiVersion: v1\n"), 0644); err != nil {
+		t.Fatalf("unexpected error writing web.yaml: %v", err)
+	}
+	if err := os.Remove(filepath.Join(dir, "other.yaml")); err != nil {
+		t.Fatalf("unexpected error removing other.yaml: %v", err)
+	}
+
+	checked, problems, err = VerifyManifest(dir)
+	if err != nil || checked != 4 {
+		t.Fatalf("expected the 4 files of the manifest checked, got %v %v", checked, err)
+	}
+	if len(problems) != 2 || !strings.HasPrefix(problems[0], "other.yaml: ") ||
+		problems[1] != "web.yaml: the content does not match the manifest" {
+		t.Errorf("expected the problems of other.yaml and web.yaml, got %q", problems)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, manifestFile), []byte("not a manifest\n"), 0644); err != nil {
+		t.Fatalf("unexpected error writing the manifest: %v", err)
+	}
+	if _, _, err := VerifyManifest(dir); err == nil || !strings.Contains(err.Error(), "invalid manifest line") {
+		t.Errorf("expected an invalid manifest error, got %v", err)
+	}
+
+	os.Remove(filepath.Join(dir, manifestFile))
+	if _, _, err := VerifyManifest(dir); err == nil || !strings.Contains(err.Error(), "unexpected error reading the manifest") {
+		t.Errorf("expected an error without manifest, got %v", err)
+	}
+}
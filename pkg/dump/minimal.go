@@ -0,0 +1,62 @@
+package dump
+
+import (
+	api "k8s.io/kubernetes/pkg/api/v1"
+	"k8s.io/kubernetes/pkg/runtime"
+)
+
+// minimalKeptMaps fields with maps where an empty string is a valid value.
+// The empty strings inside these maps are not removed by removeEmptyStrings
+var minimalKeptMaps = []string{"annotations", "data", "labels", "stringData"}
+
+// minimizeObject clears the fields assigned by the apiserver and the
+// controllers that fail or conflict when the object is applied to a new cluster
+func minimizeObject(obj runtime.Object) {
+	switch obj := obj.(type) {
+	case *api.Service:
+		clearServiceAllocations(obj)
+	case *api.ServiceAccount:
+		removeGeneratedTokens(obj)
+	}
+}
+
+// clearServiceAllocations removes the cluster IP (except for headless
+// services) and the node ports so the apiserver allocates new ones
+func clearServiceAllocations(svc *api.Service) {
+	if svc.Spec.ClusterIP != api.ClusterIPNone {
+		svc.Spec.ClusterIP = ""
+	}
+
+	for i := range svc.Spec.Ports {
+		svc.Spec.Ports[i].NodePort = 0
+	}
+}
+
+// isGeneratedToken returns true if the object is a token secret
+// generated by the token controller for a service account
+func isGeneratedToken(obj runtime.Object) bool {
+	secret, ok := obj.(*api.Secret)
+	return ok && secret.Type == api.SecretTypeServiceAccountToken
+}
+
+// removeEmptyStrings removes the fields with an empty string of a decoded object
+func removeEmptyStrings(data interface{}) {
+	switch v := data.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if s, ok := value.(string); ok && s == "" {
+				delete(v, key)
+				continue
+			}
+
+			if containsName(key, minimalKeptMaps) {
+				continue
+			}
+			removeEmptyStrings(value)
+		}
+	case []interface{}:
+		for _, item := range v {
+			removeEmptyStrings(item)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package dump
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	api "k8s.io/kubernetes/pkg/api/v1"
+	"k8s.io/kubernetes/pkg/util/intstr"
+)
+
+// newTestService returns a service with the cluster IP and the node ports
+// allocated by the apiserver
+func newTestService(name string, serviceType api.ServiceType, clusterIP string) *api.Service {
+	return &api.Service{
+		ObjectMeta: api.ObjectMeta{
+			Name:        name,
+			Namespace:   "web",
+			Annotations: map[string]string{"example.com/empty": ""},
+		},
+		Spec: api.ServiceSpec{
+			Type:      serviceType,
+			ClusterIP: clusterIP,
+			Selector:  map[string]string{"app": "nginx"},
+			Ports: []api.ServicePort{
+				{Name: "http", Protocol: api.ProtocolTCP, Port: 80, TargetPort: intstr.FromInt(8080), NodePort: 30080},
+				{Name: "https", Protocol: api.ProtocolTCP, Port: 443, TargetPort: intstr.FromInt(8443), NodePort: 30443},
+			},
+			SessionAffinity: api.ServiceAffinityNone,
+		},
+	}
+}
+
+func TestMarshalObjectMinimalService(t *testing.T) {
+	options := newTestOptions("")
+	options.Minimal = true
+	opts := completeTestOptions(t, options)
+
+	s, err := marshalObject("Service", "v1", newTestService("nginx", api.ServiceTypeNodePort, "10.0.0.10"), opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var svc api.Service
+	decodeTestObject(t, s, &svc)
+	if svc.Spec.ClusterIP != "" || strings.Contains(s, "clusterIP") {
+		t.Errorf("expected the cluster IP to be removed, got\n%v", s)
+	}
+	for _, port := range svc.Spec.Ports {
+		if port.NodePort != 0 {
+			t.Errorf("expected the node port of %v to be removed, got %v", port.Name, port.NodePort)
+		}
+	}
+
+	// the fields that are not allocated are kept
+	expected := newTestService("nginx", api.ServiceTypeNodePort, "").Spec
+	for i := range expected.Ports {
+		expected.Ports[i].NodePort = 0
+	}
+	if !reflect.DeepEqual(svc.Spec, expected) {
+		t.Errorf("expected the spec %+v, got %+v", expected, svc.Spec)
+	}
+	if value, ok := svc.Annotations["example.com/empty"]; !ok || value != "" {
+		t.Errorf("expected the empty annotation to be kept, got %v", svc.Annotations)
+	}
+}
+
+func TestMarshalObjectMinimalHeadlessService(t *testing.T) {
+	options := newTestOptions("")
+	options.Minimal = true
+	opts := completeTestOptions(t, options)
+
+	s, err := marshalObject("Service", "v1", newTestService("nginx", api.ServiceTypeClusterIP, api.ClusterIPNone), opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var svc api.Service
+	decodeTestObject(t, s, &svc)
+	if svc.Spec.ClusterIP != api.ClusterIPNone {
+		t.Errorf("expected the headless service to keep the cluster IP None, got\n%v", s)
+	}
+}
+
+func TestMarshalObjectService(t *testing.T) {
+	// without --minimal the allocations are kept
+	opts := completeTestOptions(t, newTestOptions(""))
+
+	original := newTestService("nginx", api.ServiceTypeNodePort, "10.0.0.10")
+	s, err := marshalObject("Service", "v1", newTestService("nginx", api.ServiceTypeNodePort, "10.0.0.10"), opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var svc api.Service
+	decodeTestObject(t, s, &svc)
+	if !reflect.DeepEqual(svc.Spec, original.Spec) {
+		t.Errorf("expected the spec %+v, got %+v", original.Spec, svc.Spec)
+	}
+}
@@ -0,0 +1,73 @@
+package dump
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	api "k8s.io/kubernetes/pkg/api/v1"
+)
+
+// DefaultSystemNamespacePrefixes prefixes of the namespaces created by
+// Kubernetes and the most common distributions
+var DefaultSystemNamespacePrefixes = []string{"kube-", "openshift-", "cattle-"}
+
+// namespaceFilter returns true if the namespace should be skipped
+type namespaceFilter func(ns *api.Namespace) bool
+
+// systemNamespaceFilter skips namespaces with a name that starts with one of the prefixes
+func systemNamespaceFilter(prefixes []string) namespaceFilter {
+	return func(ns *api.Namespace) bool {
+		for _, prefix := range prefixes {
+			if prefix != "" && strings.HasPrefix(ns.Name, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// compileNamespacePatterns returns a regular expression matching any of the
+// patterns or nil if there is no pattern (the empty patterns are ignored)
+func compileNamespacePatterns(flag string, patterns []string) (*regexp.Regexp, error) {
+	valid := []string{}
+	for _, pattern := range patterns {
+		if pattern != "" {
+			valid = append(valid, pattern)
+		}
+	}
+
+	if len(valid) == 0 {
+		return nil, nil
+	}
+
+	re, err := regexp.Compile(strings.Join(valid, "|"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %v: %v", flag, err)
+	}
+	return re, nil
+}
+
+// includeNamespaceFilter skips the namespaces with a name that does not match the expression
+func includeNamespaceFilter(re *regexp.Regexp) namespaceFilter {
+	return func(ns *api.Namespace) bool {
+		return !re.MatchString(ns.Name)
+	}
+}
+
+// excludeNamespaceFilter skips the namespaces with a name that matches the expression
+func excludeNamespaceFilter(re *regexp.Regexp) namespaceFilter {
+	return func(ns *api.Namespace) bool {
+		return re.MatchString(ns.Name)
+	}
+}
+
+// skipNamespace returns true if any of the filters skips the namespace
+func skipNamespace(ns *api.Namespace, filters []namespaceFilter) bool {
+	for _, filter := range filters {
+		if filter(ns) {
+			return true
+		}
+	}
+	return false
+}
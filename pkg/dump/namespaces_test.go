@@ -0,0 +1,154 @@
+package dump
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"testing"
+
+	api "k8s.io/kubernetes/pkg/api/v1"
+)
+
+// newNamespacesTestCluster returns a fake apiserver with a configmap in each namespace
+func newNamespacesTestCluster(t *testing.T, names ...string) *fakeAPIServer {
+	s := newFakeAPIServer()
+	for _, name := range names {
+		s.add(t, "namespaces", &api.Namespace{ObjectMeta: api.ObjectMeta{Name: name}})
+		s.add(t, "configmaps", newTestConfigMap(name, "settings"))
+	}
+	return s
+}
+
+// dumpedNamespaces returns the names of the namespaces with a file in the dump, sorted
+func dumpedNamespaces(files map[string][]byte) []string {
+	names := []string{}
+	for path := range files {
+		if strings.HasPrefix(path, "_") || !strings.HasSuffix(path, ".yaml") {
+			continue
+		}
+		names = append(names, strings.TrimSuffix(path, ".yaml"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestDumpClusterOnlyUserNamespaces(t *testing.T) {
+	s := newNamespacesTestCluster(t, "cattle-system", "default", "kube-public", "kube-system", "openshift-infra", "web")
+	defer s.Close()
+
+	tests := []struct {
+		prefixes []string
+		expected string
+	}{
+		{prefixes: DefaultSystemNamespacePrefixes, expected: "default,web"},
+		{prefixes: []string{"kube-"}, expected: "cattle-system,default,openshift-infra,web"},
+		// the empty prefixes are ignored
+		{prefixes: []string{""}, expected: "cattle-system,default,kube-public,kube-system,openshift-infra,web"},
+	}
+
+	for _, test := range tests {
+		files := dumpTestCluster(t, s, func(o *Options) {
+			o.OnlyUserNamespaces = true
+			o.SystemNamespacePrefixes = test.prefixes
+		})
+		if names := strings.Join(dumpedNamespaces(files), ","); names != test.expected {
+			t.Errorf("expected the namespaces %v with the prefixes %v, got %v", test.expected, test.prefixes, names)
+		}
+	}
+
+	// without --only-user-namespaces the prefixes are not used
+	files := dumpTestCluster(t, s, nil)
+	if names := dumpedNamespaces(files); len(names) != 6 {
+		t.Errorf("expected all the namespaces without --only-user-namespaces, got %v", names)
+	}
+}
+
+func TestDumpClusterIncludeExcludeNamespaces(t *testing.T) {
+	s := newNamespacesTestCluster(t, "default", "kube-public", "kube-system", "web", "web-staging")
+	defer s.Close()
+
+	tests := []struct {
+		include  []string
+		exclude  []string
+		expected string
+	}{
+		{expected: "default,kube-public,kube-system,web,web-staging"},
+		{include: []string{"^web"}, expected: "web,web-staging"},
+		{exclude: []string{"^kube-"}, expected: "default,web,web-staging"},
+		// the include patterns are applied first, the exclude patterns remove the overlap
+		{include: []string{"^web", "^kube-system$"}, exclude: []string{"-staging$", "^kube-"}, expected: "web"},
+		{include: []string{"^web$"}, exclude: []string{"^web$"}, expected: ""},
+		// the empty patterns are ignored
+		{include: []string{""}, exclude: []string{""}, expected: "default,kube-public,kube-system,web,web-staging"},
+		{include: []string{"", "^default$"}, exclude: []string{""}, expected: "default"},
+	}
+
+	for _, test := range tests {
+		files := dumpTestCluster(t, s, func(o *Options) {
+			o.IncludeNamespaces = test.include
+			o.ExcludeNamespaces = test.exclude
+		})
+		if names := strings.Join(dumpedNamespaces(files), ","); names != test.expected {
+			t.Errorf("expected the namespaces %q with --include-namespaces=%q --exclude-namespaces=%q, got %q",
+				test.expected, test.include, test.exclude, names)
+		}
+	}
+
+	// --namespace bypasses the filters
+	files := dumpTestCluster(t, s, func(o *Options) {
+		o.Namespace = "kube-system"
+		o.IncludeNamespaces = []string{"^web"}
+		o.ExcludeNamespaces = []string{"^kube-"}
+	})
+	if names := strings.Join(dumpedNamespaces(files), ","); names != "kube-system" {
+		t.Errorf("expected only the namespace kube-system with --namespace, got %q", names)
+	}
+
+	for _, configure := range []func(*Options){
+		func(o *Options) { o.IncludeNamespaces = []string{"web("} },
+		func(o *Options) { o.ExcludeNamespaces = []string{"[kube"} },
+	} {
+		opts := newTestOptions(stdoutOutput)
+		configure(&opts)
+		if _, err := DumpCluster(s.client(t), opts); err == nil || !strings.Contains(err.Error(), "namespaces: error parsing regexp") {
+			t.Errorf("expected an invalid regular expression error, got %v", err)
+		}
+	}
+}
+
+func TestDumpClusterNamespaces(t *testing.T) {
+	s := newNamespacesTestCluster(t, "db", "default", "kube-system", "web")
+	defer s.Close()
+
+	out := new(bytes.Buffer)
+	logger, _ := NewLogger("json", out)
+	files := dumpTestCluster(t, s, func(o *Options) {
+		// --namespace is added to the list, without duplicates
+		o.Namespace = "web"
+		o.Namespaces = []string{"db", "missing", "web", "kube-system"}
+		o.Concurrency = 2
+		o.Logger = logger
+	})
+
+	if names := strings.Join(dumpedNamespaces(files), ","); names != "db,kube-system,web" {
+		t.Errorf("expected the requested namespaces that exist, got %v", names)
+	}
+	for _, ns := range []string{"db", "kube-system", "web"} {
+		if !strings.Contains(string(files[ns+".yaml"]), "  name: settings\n  namespace: "+ns+"\n") {
+			t.Errorf("expected the configmap of the namespace %v, got\n%s", ns, files[ns+".yaml"])
+		}
+	}
+
+	messages := strings.Join(logMessages(t, out), "\n")
+	if !strings.Contains(messages, "warning missing  namespace missing does not exist, skipping") {
+		t.Errorf("expected a warning about the missing namespace, got\n%v", messages)
+	}
+
+	// the requested namespaces are read one by one instead of listing all of them
+	for _, r := range s.received("GET") {
+		if r == "GET /api/v1/namespaces" {
+			t.Errorf("expected no list of the namespaces with --namespaces, got %v", s.received("GET"))
+			break
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package dump
+
+import (
+	"github.com/pkg/errors"
+
+	api "k8s.io/kubernetes/pkg/api/v1"
+	client "k8s.io/kubernetes/pkg/client/clientset_generated/release_1_5"
+)
+
+// nodesFile name (without extension) of the file with the nodes. It starts
+// with _, like the other files of the dump that are not a namespace, so it
+// does not collide with the file of a namespace named nodes
+const nodesFile = "_nodes"
+
+// dumpNodes extracts the nodes of the cluster (labels, taints, capacity and
+// kubelet version) and creates the file _nodes.yaml (or _nodes.json) with the content
+func dumpNodes(kubeClient *client.Clientset, opts *dumpOptions) error {
+	opts.log.Infof("", "nodes", "\tdumping nodes")
+
+	nodes, err := kubeClient.Core().Nodes().List(api.ListOptions{})
+	if err != nil {
+		return errors.Wrap(err, "unexpected error obtaining information about the nodes")
+	}
+
+	w := newDocumentWriter("# nodes\n", opts)
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		if opts.stripStatus {
+			stripNodeStatus(node)
+		}
+
+		s, err := marshalObject("Node", "v1", node, opts)
+		if err != nil {
+			return errors.Wrapf(err, "unexpected error encoding node %v", node.Name)
+		}
+		if s == "" {
+			continue
+		}
+
+		w.add(s)
+	}
+
+	content, err := w.bytes()
+	if err != nil {
+		return err
+	}
+
+	return writeOutput(fileName(nodesFile, opts), content, opts)
+}
+
+// stripNodeStatus removes the information of the node status that changes
+// constantly, keeping capacity, addresses and the system information
+func stripNodeStatus(node *api.Node) {
+	node.Status.Phase = ""
+	node.Status.Allocatable = nil
+	node.Status.Conditions = nil
+	node.Status.DaemonEndpoints = api.NodeDaemonEndpoints{}
+	node.Status.Images = nil
+	node.Status.VolumesInUse = nil
+	node.Status.VolumesAttached = nil
+}
@@ -0,0 +1,60 @@
+package dump
+
+import (
+	"strings"
+	"testing"
+
+	api "k8s.io/kubernetes/pkg/api/v1"
+)
+
+func TestDumpNodesNamespaceNamedNodes(t *testing.T) {
+	s := newFakeAPIServer()
+	defer s.Close()
+	s.add(t, "namespaces", &api.Namespace{ObjectMeta: api.ObjectMeta{Name: "nodes"}})
+	s.add(t, "configmaps", newTestConfigMap("nodes", "settings"))
+	s.add(t, "nodes", &api.Node{
+		ObjectMeta: api.ObjectMeta{Name: "node-1", Labels: map[string]string{"zone": "a"}},
+		Status: api.NodeStatus{
+			NodeInfo:   api.NodeSystemInfo{KubeletVersion: "v1.5.2"},
+			Conditions: []api.NodeCondition{{Type: api.NodeReady, Status: api.ConditionTrue}},
+		},
+	})
+
+	files := dumpTestCluster(t, s, func(o *Options) {
+		o.DumpNodeInfo = true
+		o.StripStatus = true
+	})
+
+	nodes := string(files["_nodes.yaml"])
+	if !strings.Contains(nodes, "name: node-1") || !strings.Contains(nodes, "kubeletVersion: v1.5.2") {
+		t.Errorf("expected the node in _nodes.yaml, got\n%v", nodes)
+	}
+	if strings.Contains(nodes, "conditions") {
+		t.Errorf("expected the conditions to be removed with --strip-status, got\n%v", nodes)
+	}
+
+	namespace := string(files["nodes.yaml"])
+	if !strings.Contains(namespace, "kind: Namespace") || !strings.Contains(namespace, "name: settings") {
+		t.Errorf("expected the namespace nodes in nodes.yaml, got\n%v", namespace)
+	}
+}
+
+func TestDumpNodesSkipNames(t *testing.T) {
+	s := newFakeAPIServer()
+	defer s.Close()
+	s.add(t, "namespaces", &api.Namespace{ObjectMeta: api.ObjectMeta{Name: "default"}})
+	s.add(t, "services", &api.Service{ObjectMeta: api.ObjectMeta{Name: "kubernetes", Namespace: "default"}})
+	s.add(t, "services", &api.Service{ObjectMeta: api.ObjectMeta{Name: "nginx", Namespace: "default"}})
+	s.add(t, "nodes", &api.Node{ObjectMeta: api.ObjectMeta{Name: "kubernetes-master"}})
+
+	// the default --skip-names only filters the namespaced objects
+	files := dumpTestCluster(t, s, func(o *Options) { o.DumpNodeInfo = true })
+
+	if nodes := string(files["_nodes.yaml"]); !strings.Contains(nodes, "name: kubernetes-master") {
+		t.Errorf("expected the node kubernetes-master in _nodes.yaml, got\n%v", nodes)
+	}
+	namespace := string(files["default.yaml"])
+	if !strings.Contains(namespace, "name: nginx") || strings.Contains(namespace, "name: kubernetes\n") {
+		t.Errorf("expected only the service nginx in default.yaml, got\n%v", namespace)
+	}
+}
@@ -0,0 +1,140 @@
+package dump
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"k8s.io/kubernetes/pkg/api/meta"
+	api "k8s.io/kubernetes/pkg/api/v1"
+)
+
+// fileNameReplacer replaces the characters that are not safe in file names
+var fileNameReplacer = strings.NewReplacer("/", "_", "\\", "_", ":", "_")
+
+// sanitizePathSegment returns a name that can be used as a single component
+// of a path: the path separators are replaced with _ and the names "", "."
+// and ".." (that would point outside of the directory) are prefixed with _
+func sanitizePathSegment(name string) string {
+	name = fileNameReplacer.Replace(name)
+	if name == "" || name == "." || name == ".." {
+		name = "_" + name
+	}
+	return name
+}
+
+// objectFileNames returns the file names (with an extension) of the objects
+// of a list. The names changed by sanitizePathSegment that collide with other
+// names of the list (e.g. system:foo and system_foo) get a suffix with the
+// hash of the original name, so each object is written to its own file
+func objectFileNames(names []string, extension string) []string {
+	count := map[string]int{}
+	for _, name := range names {
+		count[sanitizePathSegment(name)]++
+	}
+
+	files := []string{}
+	for _, name := range names {
+		file := sanitizePathSegment(name)
+		if count[file] > 1 && file != name {
+			sum := sha256.Sum256([]byte(name))
+			file = fmt.Sprintf("%v-%x", file, sum[:4])
+		}
+		files = append(files, fmt.Sprintf("%v.%v", file, extension))
+	}
+	return files
+}
+
+// writeObjectLayout creates the directory <output>/<namespace> containing
+// the Namespace object (with the errors found during the dump) in
+// namespace.yaml and one file per object in <kind>/<name>.yaml, or
+// <type>/<name>.yaml with the tree layout (with the extension of the output format).
+// The subdirectory avoids collisions between objects with the same name
+func writeObjectLayout(namespace *api.Namespace, data map[string]interface{}, objects marshaledObjects, notFound []string, opts *dumpOptions) error {
+	ns := sanitizePathSegment(namespace.Name)
+	err := os.MkdirAll(fmt.Sprintf("%v/%v", opts.output, ns), opts.dirMode)
+	if err != nil {
+		return errors.Wrap(err, "unexpected error creating namespace directory")
+	}
+
+	header := new(bytes.Buffer)
+	header.WriteString("# errors:\n")
+	for _, msg := range notFound {
+		header.WriteString(fmt.Sprintf("# %v\n", msg))
+	}
+	header.WriteString("\n")
+
+	err = writeObject(fmt.Sprintf("%v/%v", ns, fileName("namespace", opts)), header.String(), objects[namespace], opts)
+	if err != nil {
+		return err
+	}
+
+	types := []string{}
+	for objectType := range data {
+		types = append(types, objectType)
+	}
+	sort.Strings(types)
+
+	for _, objectType := range types {
+		result := data[objectType].(*k8sObject)
+		subdir := strings.ToLower(result.Kind)
+		if opts.treeLayout {
+			subdir = objectType
+		}
+
+		err := writeObjectFiles(fmt.Sprintf("%v/%v", ns, sanitizePathSegment(subdir)), result, objects, opts)
+		if err != nil {
+			return errors.Wrapf(err, "unexpected error writing the objects of type %v", objectType)
+		}
+	}
+
+	return nil
+}
+
+// writeObjectFiles writes each object of a list to <dir>/<name>.yaml (with the
+// extension of the output format). The directory is only created if there
+// is at least one object to write
+func writeObjectFiles(dir string, result *k8sObject, objects marshaledObjects, opts *dumpOptions) error {
+	items, err := meta.ExtractList(result.Runtime)
+	if err != nil {
+		return errors.Wrap(err, "unexpected error extracting items")
+	}
+
+	names := []string{}
+	for _, item := range items {
+		objectMeta, err := objectMetaFor(item)
+		if err != nil {
+			return errors.Wrap(err, "unexpected error reading object metadata")
+		}
+		names = append(names, objectMeta.Name)
+	}
+	files := objectFileNames(names, opts.outputFormat)
+
+	created := false
+	for i, item := range items {
+		s := objects[item]
+		if s == "" {
+			continue
+		}
+
+		if !created {
+			err = os.MkdirAll(fmt.Sprintf("%v/%v", opts.output, dir), opts.dirMode)
+			if err != nil {
+				return errors.Wrap(err, "unexpected error creating directory")
+			}
+			created = true
+		}
+
+		err = writeObject(fmt.Sprintf("%v/%v", dir, files[i]), "", s, opts)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,271 @@
+package dump
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	api "k8s.io/kubernetes/pkg/api/v1"
+	extensions "k8s.io/kubernetes/pkg/apis/extensions/v1beta1"
+	rbac "k8s.io/kubernetes/pkg/apis/rbac/v1alpha1"
+)
+
+// newTestCluster starts a fake apiserver with two namespaces and objects of
+// several types in each one (the caller must close it)
+func newTestCluster(t *testing.T) *fakeAPIServer {
+	s := newFakeAPIServer()
+	replicas := int32(2)
+	for _, ns := range []string{"web", "other"} {
+		s.add(t, "namespaces", &api.Namespace{ObjectMeta: api.ObjectMeta{Name: ns}})
+		for _, name := range []string{"settings", "nginx", "features"} {
+			s.add(t, "configmaps", newTestConfigMap(ns, name))
+		}
+		s.add(t, "services", &api.Service{
+			ObjectMeta: api.ObjectMeta{Name: "nginx", Namespace: ns, Labels: map[string]string{"app": "nginx"}},
+			Spec: api.ServiceSpec{
+				Selector: map[string]string{"app": "nginx"},
+				Ports:    []api.ServicePort{{Name: "http", Port: 80}},
+			},
+		})
+		s.add(t, "deployments", &extensions.Deployment{
+			ObjectMeta: api.ObjectMeta{Name: "nginx", Namespace: ns},
+			Spec: extensions.DeploymentSpec{
+				Replicas: &replicas,
+				Template: api.PodTemplateSpec{
+					ObjectMeta: api.ObjectMeta{Labels: map[string]string{"app": "nginx"}},
+					Spec:       api.PodSpec{Containers: []api.Container{{Name: "nginx", Image: "nginx:1.11"}}},
+				},
+			},
+		})
+	}
+	return s
+}
+
+// readDumpFiles returns the content of the files of a dump by relative path
+func readDumpFiles(t *testing.T, dir string) map[string][]byte {
+	files := map[string][]byte{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		b, err := ioutil.ReadFile(path)
+		files[filepath.ToSlash(rel)] = b
+		return err
+	})
+	if err != nil {
+		t.Fatalf("unexpected error reading %v: %v", dir, err)
+	}
+	return files
+}
+
+// dumpTestCluster dumps a fake apiserver to a new directory with the options
+// returned by configure and returns the files of the dump (see readDumpFiles)
+func dumpTestCluster(t *testing.T, s *fakeAPIServer, configure func(*Options)) map[string][]byte {
+	result, files := runTestDump(t, s, configure)
+	if result.Failed() {
+		t.Fatalf("unexpected errors in the dump: %v", result.Err())
+	}
+	return files
+}
+
+// runTestDump dumps the cluster of the fake apiserver to a temporary
+// directory and returns the result (that can contain errors) and the files
+func runTestDump(t *testing.T, s *fakeAPIServer, configure func(*Options)) (*DumpResult, map[string][]byte) {
+	dir, err := ioutil.TempDir("", "dump")
+	if err != nil {
+		t.Fatalf("unexpected error creating a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := newTestOptions(dir)
+	if configure != nil {
+		configure(&opts)
+	}
+	result, err := DumpCluster(s.client(t), opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return result, readDumpFiles(t, dir)
+}
+
+// compareDumps checks that two dumps contain the same files byte-for-byte
+func compareDumps(t *testing.T, first, second map[string][]byte) {
+	paths := []string{}
+	for path := range first {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		b, ok := second[path]
+		if !ok {
+			t.Errorf("the file %v is missing in the second dump", path)
+			continue
+		}
+		if !bytes.Equal(first[path], b) {
+			t.Errorf("the file %v is different in each dump:\n%s\n---\n%s", path, first[path], b)
+		}
+	}
+	for path := range second {
+		if _, ok := first[path]; !ok {
+			t.Errorf("the file %v is missing in the first dump", path)
+		}
+	}
+}
+
+func TestWriteObjectLayoutDeterministic(t *testing.T) {
+	s := newTestCluster(t)
+	defer s.Close()
+
+	layouts := map[string]func(*Options){
+		"per-object": func(o *Options) { o.PerObjectFiles = true },
+		"tree":       func(o *Options) { o.OutputLayout = "tree" },
+	}
+	for layout, configure := range layouts {
+		first := dumpTestCluster(t, s, configure)
+		if len(first) < 10 {
+			t.Fatalf("expected one file per object with the %v layout, got %v files", layout, len(first))
+		}
+		compareDumps(t, first, dumpTestCluster(t, s, configure))
+	}
+}
+
+func TestWriteObjectLayoutTree(t *testing.T) {
+	s := newTestCluster(t)
+	defer s.Close()
+	for _, name := range []string{"system:foo", "system_foo"} {
+		s.add(t, "clusterroles", &rbac.ClusterRole{ObjectMeta: api.ObjectMeta{Name: name}})
+	}
+
+	files := dumpTestCluster(t, s, func(o *Options) { o.OutputLayout = "tree" })
+	paths := []string{}
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	expected := []string{
+		"_cluster/clusterroles/system_foo-4347f5fa.yaml",
+		"_cluster/clusterroles/system_foo.yaml",
+		"_manifest.sha256",
+		"_summary.json",
+	}
+	for _, ns := range []string{"other", "web"} {
+		expected = append(expected,
+			ns+"/configmaps/features.yaml",
+			ns+"/configmaps/nginx.yaml",
+			ns+"/configmaps/settings.yaml",
+			ns+"/deployments/nginx.yaml",
+			ns+"/namespace.yaml",
+			ns+"/services/nginx.yaml",
+		)
+	}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected the files\n%v\ngot\n%v", strings.Join(expected, "\n"), strings.Join(paths, "\n"))
+	}
+
+	// each object of the collision is in its own file
+	for path, name := range map[string]string{
+		"_cluster/clusterroles/system_foo-4347f5fa.yaml": "system:foo",
+		"_cluster/clusterroles/system_foo.yaml":          "system_foo",
+	} {
+		if !strings.Contains(string(files[path]), "name: "+name+"\n") {
+			t.Errorf("expected the clusterrole %v in %v, got\n%s", name, path, files[path])
+		}
+	}
+}
+
+func TestObjectFileNames(t *testing.T) {
+	names := []string{"nginx", "system:foo", "system_foo", "a/b", "a:b", "..", ""}
+	expected := []string{"nginx.yaml", "system_foo-4347f5fa.yaml", "system_foo.yaml",
+		"a_b-c14cddc0.yaml", "a_b-6783a31e.yaml", "_...yaml", "_.yaml"}
+
+	files := objectFileNames(names, "yaml")
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("expected the file names %q, got %q", expected, files)
+	}
+}
+
+func TestSanitizePathSegment(t *testing.T) {
+	dir := filepath.FromSlash("/backups/dump")
+	for name, expected := range map[string]string{
+		"nginx":          "nginx",
+		"":               "_",
+		".":              "_.",
+		"..":             "_..",
+		"../../etc":      ".._.._etc",
+		"/etc/passwd":    "_etc_passwd",
+		"a\\..\\..\\b":   "a_.._.._b",
+		"system:coredns": "system_coredns",
+	} {
+		segment := sanitizePathSegment(name)
+		if segment != expected {
+			t.Errorf("expected %q for %q, got %q", expected, name, segment)
+		}
+
+		path := filepath.Join(dir, segment)
+		if filepath.Dir(path) != dir {
+			t.Errorf("expected the path of %q inside %v, got %v", name, dir, path)
+		}
+	}
+}
+
+func TestWriteObjectLayoutAdversarialNames(t *testing.T) {
+	s := newFakeAPIServer()
+	defer s.Close()
+	s.add(t, "namespaces", &api.Namespace{ObjectMeta: api.ObjectMeta{Name: "web"}})
+	names := []string{"../../escape", "..", ".", "/etc/passwd", "a\\..\\..\\b"}
+	for _, name := range names {
+		s.add(t, "configmaps", newTestConfigMap("web", name))
+	}
+
+	root, err := ioutil.TempDir("", "dump")
+	if err != nil {
+		t.Fatalf("unexpected error creating a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(root)
+	dir := filepath.Join(root, "out")
+
+	for _, layout := range []string{"tree", "per-object"} {
+		os.RemoveAll(dir)
+		opts := newTestOptions(dir)
+		if layout == "tree" {
+			opts.OutputLayout = "tree"
+		} else {
+			opts.PerObjectFiles = true
+		}
+		result, err := DumpCluster(s.client(t), opts)
+		if err != nil || result.Failed() {
+			t.Fatalf("unexpected error with the %v layout: %v %v", layout, err, result.Err())
+		}
+
+		written := 0
+		err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			if !strings.HasPrefix(path, dir+string(filepath.Separator)) {
+				t.Errorf("the file %v is outside of the output directory %v", path, dir)
+			}
+			if strings.Contains(path, "configmap") {
+				written++
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error reading %v: %v", root, err)
+		}
+		if written != len(names) {
+			t.Errorf("expected %v configmaps written with the %v layout, got %v", len(names), layout, written)
+		}
+	}
+}
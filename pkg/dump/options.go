@@ -0,0 +1,582 @@
+package dump
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	k8s_errors "k8s.io/kubernetes/pkg/api/errors"
+	client "k8s.io/kubernetes/pkg/client/clientset_generated/release_1_5"
+	"k8s.io/kubernetes/pkg/fields"
+	"k8s.io/kubernetes/pkg/labels"
+)
+
+// Options contains the settings of a dump. NewOptions returns the default values
+type Options struct {
+	// Logger writes the messages of the dump (nil uses glog)
+	Logger *Logger
+	// Output directory where the dump files should be created (- writes the dump to the standard output)
+	Output string
+	// Namespace if not empty only this namespace is dumped (it is added to Namespaces)
+	Namespace string
+	// Namespaces if not empty only these namespaces are dumped (the filters of the namespaces are not applied)
+	Namespaces []string
+	// SkipNames regular expressions of the names of the namespaced objects that are not dumped
+	SkipNames []string
+	// ExcludeAnnotation objects with this annotation (key=value, or only the key to match any value) are not dumped
+	ExcludeAnnotation string
+	// SkipTypes types to skip in the dump (the plural, singular or short names, e.g. secrets, secret or svc)
+	SkipTypes []string
+	// IncludeTypes if not empty only these types are dumped (SkipTypes is applied on top)
+	IncludeTypes []string
+	// IncludePods dumps the pods
+	IncludePods bool
+	// RedactPaths fields to redact in the format <Kind>:<JSONPath>
+	RedactPaths []string
+	// RedactSecrets replaces the values of the data of the secrets
+	RedactSecrets bool
+	// MaxObjectSize size in bytes after which a warning is logged (0 disables the check)
+	MaxObjectSize int
+	// OnlyUserNamespaces skips the namespaces starting with one of the SystemNamespacePrefixes
+	OnlyUserNamespaces bool
+	// SystemNamespacePrefixes prefixes of the names of the system namespaces
+	SystemNamespacePrefixes []string
+	// DumpNodeInfo dumps the nodes of the cluster
+	DumpNodeInfo bool
+	// StripStatus removes volatile status information from the nodes
+	StripStatus bool
+	// MaxItemsPerType number of items in a type after which the type is skipped (0 means unlimited)
+	MaxItemsPerType int
+	// LineEndings line endings used in the dump files (lf or crlf)
+	LineEndings string
+	// BOM writes a UTF-8 byte order mark at the beginning of the dump files
+	BOM bool
+	// KeepStatusFor kinds that should keep the status section
+	KeepStatusFor []string
+	// IncludeSystemSecretsMetadata lists the secrets located in skipped namespaces
+	IncludeSystemSecretsMetadata bool
+	// GitOpsLayout creates a directory per namespace with one file per type
+	GitOpsLayout bool
+	// PerObjectFiles creates a directory per namespace with one file per object
+	PerObjectFiles bool
+	// OutputLayout layout of the files: flat (one file per namespace) or tree (one file per object in <namespace>/<type>/<name>)
+	OutputLayout string
+	// OutputHashNames names the namespace files using the SHA256 of the content
+	OutputHashNames bool
+	// StripContainerNames patterns of container names to remove from the pod templates
+	StripContainerNames []string
+	// Preflight checks the permissions of the current identity before the dump
+	Preflight bool
+	// PartialWrites writes the namespace file even if some of the types cannot be queried
+	PartialWrites bool
+	// SortBy order of the objects of each type (name or created)
+	SortBy string
+	// DocumentSeparator separator between the yaml documents
+	DocumentSeparator string
+	// LeadingSeparator writes the separator before the first document
+	LeadingSeparator bool
+	// AnnotateResourceVersion writes the resourceVersion in a comment
+	AnnotateResourceVersion bool
+	// CollectLogs writes the logs of the containers of each namespace
+	CollectLogs bool
+	// LogTailLines number of lines of the logs to collect (0 collects the whole log)
+	LogTailLines int64
+	// LogsIncludeCompleted collects the logs of completed pods
+	LogsIncludeCompleted bool
+	// TransformExec command used to transform each object
+	TransformExec string
+	// TransformTimeout maximum time for each invocation of TransformExec
+	TransformTimeout time.Duration
+	// SkipDefaultTokens removes the references to generated tokens from the service accounts
+	SkipDefaultTokens bool
+	// PVReclaimPolicy replaces the reclaim policy of the persistent volumes
+	PVReclaimPolicy string
+	// PVClearCloudSource removes the cloud provider sources from the persistent volumes
+	PVClearCloudSource bool
+	// StripFieldsFile file with the paths of the fields to remove from the objects
+	StripFieldsFile string
+	// ReplaceImagePullSecrets name of the secret that replaces the image pull secrets
+	ReplaceImagePullSecrets string
+	// ClearImagePullSecrets removes the image pull secrets
+	ClearImagePullSecrets bool
+	// ListOutputPlan prints the paths of the files instead of dumping the namespaces
+	ListOutputPlan bool
+	// FileMode mode of the files written (0 uses 0644)
+	FileMode os.FileMode
+	// Secure writes the files with the mode 0600 and the directories with 0700 (FileMode is ignored)
+	Secure bool
+	// ListOnly lists the objects and prints the number of objects of each type by namespace instead of writing the files
+	ListOnly bool
+	// Progress writes the number of namespaces completed and the elapsed time to stderr during the dump
+	Progress bool
+	// WithReferences adds the services, endpoints and TLS secrets of the ingresses and the configmaps, secrets and
+	// persistent volume claims used by the deployments, even if the types are skipped or the objects do not match the selectors
+	WithReferences bool
+	// FailIfExists fails the dump before writing any file if a file of the dump already exists in the output
+	// directory (or the archive exists). By default the files are replaced
+	FailIfExists bool
+	// MaxTotalSize bytes written after which no more namespaces are dumped (0 means unlimited)
+	MaxTotalSize int64
+	// OutputFormat format of the dump files (yaml or json)
+	OutputFormat string
+	// Concurrency number of namespaces dumped at the same time
+	Concurrency int
+	// TypeConcurrency number of types of a namespace listed at the same time.
+	// The list requests in flight are limited by Concurrency
+	TypeConcurrency int
+	// Selector label selector of the objects to dump (e.g. app=nginx,tier=frontend)
+	Selector string
+	// Minimal clears the fields assigned by the apiserver so the objects can be applied to a new cluster
+	// (cluster IPs and node ports of the services, generated tokens and empty strings)
+	Minimal bool
+	// DiscoverCRDs dumps the namespaced custom resources found using the API discovery
+	DiscoverCRDs bool
+	// DecodeValues adds a comment with the decoded values of the data of the secrets
+	// (only in yaml and without RedactSecrets)
+	DecodeValues bool
+	// IncludeEvents dumps the events
+	IncludeEvents bool
+	// EventsSince if greater than 0 only the events that occurred in this period are dumped
+	EventsSince time.Duration
+	// KeepStatus keeps the status section of all the kinds (KeepStatusFor is ignored)
+	KeepStatus bool
+	// SkipOwned skips the objects managed by a controller (e.g. the replica sets of a deployment)
+	SkipOwned bool
+	// FieldSelector field selector of the objects to dump (e.g. spec.type=LoadBalancer).
+	// The types that do not support the fields are recorded as errors
+	FieldSelector string
+	// IncludeNamespaces if not empty only the namespaces matching one of these regular expressions are dumped
+	IncludeNamespaces []string
+	// ExcludeNamespaces regular expressions of the namespaces that are not dumped (applied after IncludeNamespaces)
+	ExcludeNamespaces []string
+	// Archive path of a tar.gz archive where the files are written instead of the output directory
+	Archive string
+	// CompressLevel gzip compression level of the archive (0-9)
+	CompressLevel int
+	// TemplateFile file with the template of the namespace files used instead of the built-in one
+	TemplateFile string
+	// MaxRetries number of times a list call is retried after a transient error (0 disables the retries)
+	MaxRetries int
+	// RetryInterval wait before the first retry, doubled after each attempt
+	RetryInterval time.Duration
+	// RequestTimeout maximum time for each list or get request (0 means no limit).
+	// It is enforced by the transport of the client returned by WrapTransport
+	RequestTimeout time.Duration
+	// Interrupt stops the dump when it is closed: the namespaces in progress
+	// are completed and the namespaces not started are recorded in the summary
+	Interrupt <-chan struct{}
+}
+
+// NewOptions returns the default options
+func NewOptions() Options {
+	return Options{
+		SkipNames:               []string{"kubernetes"},
+		SkipTypes:               []string{"serviceaccounts"},
+		IncludePods:             true,
+		RedactSecrets:           true,
+		MaxObjectSize:           1572864,
+		SystemNamespacePrefixes: DefaultSystemNamespacePrefixes,
+		LineEndings:             "lf",
+		PartialWrites:           true,
+		SortBy:                  "name",
+		DocumentSeparator:       "---",
+		LogTailLines:            1000,
+		TransformTimeout:        10 * time.Second,
+		SkipDefaultTokens:       true,
+		OutputFormat:            "yaml",
+		OutputLayout:            "flat",
+		Concurrency:             10,
+		TypeConcurrency:         1,
+		FileMode:                0644,
+		CompressLevel:           6,
+		MaxRetries:              3,
+		RetryInterval:           500 * time.Millisecond,
+		RequestTimeout:          30 * time.Second,
+	}
+}
+
+// Validate checks the options and the output directory before starting a dump.
+// The type names that do not match a dumped type are logged
+func (o Options) Validate() error {
+	dopts, err := o.complete()
+	if err != nil {
+		return err
+	}
+
+	err = validOutput(dopts)
+	if err != nil {
+		return err
+	}
+
+	warnUnknownTypes("skip-types", o.SkipTypes)
+	warnUnknownTypes("include-types", o.IncludeTypes)
+	return nil
+}
+
+// complete validates the options and returns the settings used during the dump
+func (o Options) complete() (*dumpOptions, error) {
+	paths := append([]string{}, o.RedactPaths...)
+	if o.RedactSecrets {
+		paths = append(paths, secretDataRedactPath)
+	}
+
+	redactRules, err := parseRedactRules(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validLineEndings(o.LineEndings)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validContainerPatterns(o.StripContainerNames)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validSortBy(o.SortBy)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validDocumentSeparator(o.DocumentSeparator)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validReclaimPolicy(o.PVReclaimPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.EventsSince < 0 {
+		return nil, fmt.Errorf("invalid events since %v (must be 0 or greater)", o.EventsSince)
+	}
+
+	if o.Concurrency < 1 {
+		return nil, fmt.Errorf("invalid concurrency %v (must be at least 1)", o.Concurrency)
+	}
+
+	if o.TypeConcurrency < 1 {
+		return nil, fmt.Errorf("invalid type concurrency %v (must be at least 1)", o.TypeConcurrency)
+	}
+
+	if o.MaxRetries < 0 {
+		return nil, fmt.Errorf("invalid max retries %v (must be 0 or greater)", o.MaxRetries)
+	}
+
+	if o.RequestTimeout < 0 {
+		return nil, fmt.Errorf("invalid request timeout %v (must be 0 or greater)", o.RequestTimeout)
+	}
+
+	if o.MaxRetries > 0 && o.RetryInterval <= 0 {
+		return nil, fmt.Errorf("invalid retry interval %v (must be greater than 0)", o.RetryInterval)
+	}
+
+	err = validOutputFormat(o.OutputFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.OutputFormat == "json" && o.AnnotateResourceVersion {
+		return nil, fmt.Errorf("--annotate-resource-version cannot be used with the json output format")
+	}
+
+	if o.FileMode&^os.ModePerm != 0 {
+		return nil, fmt.Errorf("invalid file mode %#o (only the permission bits can be set)", o.FileMode)
+	}
+
+	if o.ListOnly && o.ListOutputPlan {
+		return nil, fmt.Errorf("--list-only cannot be used with --list-output-plan")
+	}
+
+	if o.OutputFormat == "json" && o.DecodeValues {
+		return nil, fmt.Errorf("--decode-values cannot be used with the json output format")
+	}
+
+	if o.DecodeValues && o.RedactSecrets {
+		// every value of the secrets is redacted, there is nothing to decode
+		return nil, fmt.Errorf("--decode-values requires --redact-secrets=false")
+	}
+
+	err = validOutputLayout(o.OutputLayout)
+	if err != nil {
+		return nil, err
+	}
+
+	treeLayout := o.OutputLayout == "tree"
+	if countTrue(o.GitOpsLayout, o.PerObjectFiles, o.OutputHashNames, treeLayout) > 1 {
+		return nil, fmt.Errorf("only one of --gitops-layout, --per-object-files, --output-hash-names and --output-layout=tree can be used")
+	}
+
+	if o.ReplaceImagePullSecrets != "" && o.ClearImagePullSecrets {
+		return nil, fmt.Errorf("--replace-image-pull-secrets and --clear-image-pull-secrets cannot be used together")
+	}
+
+	if o.Output == stdoutOutput && (o.GitOpsLayout || o.PerObjectFiles || o.OutputHashNames || treeLayout || o.CollectLogs) {
+		return nil, fmt.Errorf("--gitops-layout, --per-object-files, --output-hash-names, --output-layout=tree and --collect-logs " +
+			"cannot be used when the dump is written to the standard output")
+	}
+
+	selector, err := labels.Parse(o.Selector)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid selector")
+	}
+
+	if o.TemplateFile != "" && (o.OutputFormat == "json" || o.GitOpsLayout || o.PerObjectFiles || treeLayout) {
+		return nil, fmt.Errorf("--template-file cannot be used with the json output format, --gitops-layout, --per-object-files " +
+			"or --output-layout=tree")
+	}
+
+	templateText := template
+	if o.TemplateFile != "" {
+		data, err := ioutil.ReadFile(o.TemplateFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "unexpected error reading the template file")
+		}
+		templateText = string(data)
+	}
+
+	err = validArchive(o.Archive)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validCompressLevel(o.CompressLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.Archive != "" && o.Output != "" {
+		return nil, fmt.Errorf("--output and --archive cannot be used together")
+	}
+
+	if o.Archive != "" && (o.GitOpsLayout || o.PerObjectFiles || treeLayout || o.CollectLogs) {
+		return nil, fmt.Errorf("--gitops-layout, --per-object-files, --output-layout=tree and --collect-logs " +
+			"cannot be used with --archive")
+	}
+
+	fieldSelector, err := fields.ParseSelector(o.FieldSelector)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid field selector")
+	}
+
+	var stripper *fieldStripper
+	if o.StripFieldsFile != "" {
+		stripper, err = loadFieldStripper(o.StripFieldsFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	opts := &dumpOptions{
+		output:                       o.Output,
+		skipTypes:                    normalizeTypes(o.SkipTypes),
+		includeTypes:                 normalizeTypes(o.IncludeTypes),
+		redactRules:                  redactRules,
+		maxObjectSize:                o.MaxObjectSize,
+		dumpNodeInfo:                 o.DumpNodeInfo,
+		stripStatus:                  o.StripStatus,
+		maxItemsPerType:              o.MaxItemsPerType,
+		lineEndings:                  o.LineEndings,
+		bom:                          o.BOM,
+		keepStatusFor:                o.KeepStatusFor,
+		includeSystemSecretsMetadata: o.IncludeSystemSecretsMetadata,
+		gitopsLayout:                 o.GitOpsLayout,
+		stripContainerNames:          o.StripContainerNames,
+		preflight:                    o.Preflight,
+		partialWrites:                o.PartialWrites,
+		sortBy:                       o.SortBy,
+		documentSeparator:            o.DocumentSeparator,
+		leadingSeparator:             o.LeadingSeparator,
+		annotateResourceVersion:      o.AnnotateResourceVersion,
+		collectLogs:                  o.CollectLogs,
+		logTailLines:                 o.LogTailLines,
+		logsIncludeCompleted:         o.LogsIncludeCompleted,
+		transformExec:                o.TransformExec,
+		transformTimeout:             o.TransformTimeout,
+		skipDefaultTokens:            o.SkipDefaultTokens,
+		pvReclaimPolicy:              o.PVReclaimPolicy,
+		pvClearCloudSource:           o.PVClearCloudSource,
+		fieldStripper:                stripper,
+		replaceImagePullSecrets:      o.ReplaceImagePullSecrets,
+		clearImagePullSecrets:        o.ClearImagePullSecrets,
+		listOutputPlan:               o.ListOutputPlan,
+		listOnly:                     o.ListOnly,
+		progress:                     o.Progress,
+		withReferences:               o.WithReferences,
+		failIfExists:                 o.FailIfExists,
+		fileMode:                     o.FileMode,
+		dirMode:                      0755,
+		secure:                       o.Secure,
+		sizeBudget:                   newSizeBudget(o.MaxTotalSize),
+		perObjectFiles:               o.PerObjectFiles,
+		treeLayout:                   treeLayout,
+		archivePath:                  o.Archive,
+		compressLevel:                o.CompressLevel,
+		outputFormat:                 o.OutputFormat,
+		log:                          o.Logger,
+		concurrency:                  o.Concurrency,
+		typeConcurrency:              o.TypeConcurrency,
+		listSlots:                    make(chan struct{}, o.Concurrency),
+		labelSelector:                selector.String(),
+		fieldSelector:                fieldSelector.String(),
+		skipOwned:                    o.SkipOwned,
+		keepStatus:                   o.KeepStatus,
+		eventsSince:                  o.EventsSince,
+		decodeValues:                 o.DecodeValues,
+		discoverCustomResources:      o.DiscoverCRDs,
+		minimal:                      o.Minimal,
+		maxRetries:                   o.MaxRetries,
+		retryInterval:                o.RetryInterval,
+		requestTimeout:               o.RequestTimeout,
+		interrupt:                    o.Interrupt,
+	}
+
+	opts.template, err = parseTemplate(templateText)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid template")
+	}
+
+	if o.OutputHashNames {
+		opts.hashIndex = newHashIndex()
+	}
+
+	if o.Output == stdoutOutput {
+		opts.stdout = newStdoutBuffer()
+	} else {
+		opts.manifest = newManifest()
+	}
+
+	if !o.IncludePods {
+		opts.skipTypes = append(opts.skipTypes, "pods")
+	}
+
+	if !o.IncludeEvents {
+		opts.skipTypes = append(opts.skipTypes, "events")
+	}
+
+	if len(o.SkipNames) > 0 {
+		opts.skipNames, err = regexp.Compile(strings.Join(o.SkipNames, "|"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid skip names: %v", err)
+		}
+	}
+
+	if o.ExcludeAnnotation != "" {
+		opts.excludeAnnotation, err = parseAnnotationFilter(o.ExcludeAnnotation)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	include, err := compileNamespacePatterns("include namespaces", o.IncludeNamespaces)
+	if err != nil {
+		return nil, err
+	}
+	if include != nil {
+		opts.namespaceFilters = append(opts.namespaceFilters, includeNamespaceFilter(include))
+	}
+
+	exclude, err := compileNamespacePatterns("exclude namespaces", o.ExcludeNamespaces)
+	if err != nil {
+		return nil, err
+	}
+	if exclude != nil {
+		opts.namespaceFilters = append(opts.namespaceFilters, excludeNamespaceFilter(exclude))
+	}
+
+	if o.OnlyUserNamespaces {
+		opts.namespaceFilters = append(opts.namespaceFilters, systemNamespaceFilter(o.SystemNamespacePrefixes))
+	}
+
+	if opts.fileMode == 0 {
+		opts.fileMode = 0644
+	}
+
+	if o.Secure {
+		opts.fileMode, opts.dirMode = 0600, 0700
+		if !o.RedactSecrets {
+			o.Logger.Warningf("", "secrets", "the values of the secrets are not redacted, the files of the dump contain credentials")
+		}
+	}
+
+	return opts, nil
+}
+
+// requestedNamespaces returns Namespace and Namespaces without duplicates
+func (o Options) requestedNamespaces() []string {
+	names := []string{}
+	for _, name := range append([]string{o.Namespace}, o.Namespaces...) {
+		if name != "" && !containsName(name, names) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// DumpCluster dumps the namespaces of the cluster (or only the namespaces of
+// opts.Namespace and opts.Namespaces) to the output directory, creating it if needed. An error is returned if the
+// options are not valid or the output directory cannot be used,
+// the problems found during the dump are recorded in the result
+func DumpCluster(kubeClient *client.Clientset, opts Options) (*DumpResult, error) {
+	dopts, err := opts.complete()
+	if err != nil {
+		return nil, err
+	}
+
+	err = prepareOutput(dopts)
+	if err != nil {
+		return nil, err
+	}
+
+	result := dumpCluster(kubeClient, opts.requestedNamespaces(), dopts)
+	if dopts.archive != nil {
+		err = dopts.archive.close()
+		if err != nil {
+			result.AddError("", "", err)
+		}
+	}
+
+	return result, nil
+}
+
+// DumpNamespace returns the content of the file of a namespace in the output
+// format (the layout options are ignored) without writing it
+func DumpNamespace(kubeClient *client.Clientset, ns string, opts Options) ([]byte, error) {
+	dopts, err := opts.complete()
+	if err != nil {
+		return nil, err
+	}
+
+	namespace, err := kubeClient.Namespaces().Get(ns)
+	if k8s_errors.IsNotFound(err) {
+		return nil, fmt.Errorf("namespace %v not found", ns)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "unexpected error obtaining information about the namespace %v", ns)
+	}
+
+	dr := &DumpResult{selector: describeSelectors(dopts), log: dopts.log}
+	data, err := queryNamespace(kubeClient, ns, dopts, dr)
+	if err != nil {
+		return nil, err
+	}
+
+	if data == nil {
+		return nil, fmt.Errorf("namespace %v not found", ns)
+	}
+
+	objects, err := marshalNamespace(namespace, data, dopts, dr)
+	if err != nil {
+		return nil, err
+	}
+
+	return renderNamespace(namespace, data, objects, dr.messagesFor(ns), dopts)
+}
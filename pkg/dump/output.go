@@ -0,0 +1,668 @@
+package dump
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// UTF8BOM byte order mark written at the beginning of the files when --bom is set
+var UTF8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// validLineEndings checks the value of the --line-endings flag
+func validLineEndings(lineEndings string) error {
+	switch lineEndings {
+	case "lf", "crlf":
+		return nil
+	default:
+		return fmt.Errorf("invalid line endings %q (valid values are lf and crlf)", lineEndings)
+	}
+}
+
+// validDocumentSeparator checks the value of the --document-separator flag.
+// The separator must be a valid yaml document marker
+func validDocumentSeparator(separator string) error {
+	if !strings.HasPrefix(separator, "---") || strings.ContainsAny(separator, "\r\n") {
+		return fmt.Errorf("invalid document separator %q (must be a single line starting with ---)", separator)
+	}
+	return nil
+}
+
+// validOutputFormat checks the value of the --output-format flag
+func validOutputFormat(format string) error {
+	switch format {
+	case "yaml", "json":
+		return nil
+	default:
+		return fmt.Errorf("invalid output format %q (valid values are yaml and json)", format)
+	}
+}
+
+// checkRelativePath returns an error if the name of a file of the dump is not a
+// path inside the output directory (absolute or with . or .. components)
+func checkRelativePath(name string) error {
+	if strings.HasPrefix(name, "/") {
+		return fmt.Errorf("invalid file name %v (must be relative to the output directory)", name)
+	}
+
+	for _, segment := range strings.Split(name, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return fmt.Errorf("invalid file name %v (must be relative to the output directory)", name)
+		}
+	}
+	return nil
+}
+
+// fileName returns the name of a file with the extension of the output format
+func fileName(name string, opts *dumpOptions) string {
+	return fmt.Sprintf("%v.%v", name, opts.outputFormat)
+}
+
+// documentWriter builds the content of a file containing multiple objects.
+// In yaml the objects are written as documents (after the header comment),
+// in json they are the items of a List
+type documentWriter struct {
+	opts  *dumpOptions
+	buf   *bytes.Buffer
+	items []json.RawMessage
+	count int
+}
+
+func newDocumentWriter(header string, opts *dumpOptions) *documentWriter {
+	buf := new(bytes.Buffer)
+	if header != "" && opts.outputFormat == "yaml" {
+		buf.WriteString(header)
+	}
+	return &documentWriter{opts: opts, buf: buf, items: []json.RawMessage{}}
+}
+
+// add appends an object returned by marshalObject
+func (d *documentWriter) add(doc string) {
+	if d.opts.outputFormat == "json" {
+		d.items = append(d.items, json.RawMessage(doc))
+	} else {
+		appendDocument(d.buf, doc, d.count == 0, d.opts)
+	}
+	d.count++
+}
+
+// bytes returns the content of the file
+func (d *documentWriter) bytes() ([]byte, error) {
+	if d.opts.outputFormat != "json" {
+		return d.buf.Bytes(), nil
+	}
+
+	data, err := json.MarshalIndent(jsonList{APIVersion: "v1", Kind: "List", Items: d.items}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// writeDocuments writes a file in the output directory containing the objects
+func writeDocuments(name string, documents []string, opts *dumpOptions) error {
+	w := newDocumentWriter("", opts)
+	for _, doc := range documents {
+		w.add(doc)
+	}
+
+	content, err := w.bytes()
+	if err != nil {
+		return err
+	}
+
+	return writeOutput(name, content, opts)
+}
+
+// writeObject writes a file in the output directory containing a single object.
+// The header comment is only written in yaml
+func writeObject(name, header, doc string, opts *dumpOptions) error {
+	if opts.outputFormat == "json" {
+		return writeOutput(name, []byte(doc), opts)
+	}
+
+	buf := bytes.NewBufferString(header)
+	appendDocument(buf, doc, true, opts)
+	return writeOutput(name, buf.Bytes(), opts)
+}
+
+// appendDocument adds a yaml document to a multi-document buffer. The separator
+// is written between documents (and before the first one if --leading-separator is set)
+// so there is no separator after the last document
+func appendDocument(buf *bytes.Buffer, doc string, first bool, opts *dumpOptions) {
+	if !first || opts.leadingSeparator {
+		buf.WriteString(fmt.Sprintf("%v\n", opts.documentSeparator))
+	}
+	buf.WriteString(doc)
+}
+
+// encodeOutput applies the line endings and byte order mark
+// configured in the options to the rendered content
+func encodeOutput(content []byte, opts *dumpOptions) []byte {
+	if opts.lineEndings == "crlf" {
+		content = bytes.Replace(content, []byte("\r\n"), []byte("\n"), -1)
+		content = bytes.Replace(content, []byte("\n"), []byte("\r\n"), -1)
+	}
+
+	if opts.bom {
+		content = append(append([]byte{}, UTF8BOM...), content...)
+	}
+
+	return content
+}
+
+// sizeBudget tracks the bytes written in the output directory
+// when --max-total-size is set. The methods can be used on a nil budget
+type sizeBudget struct {
+	sync.Mutex
+	max     int64
+	written int64
+}
+
+func newSizeBudget(max int64) *sizeBudget {
+	if max <= 0 {
+		return nil
+	}
+	return &sizeBudget{max: max}
+}
+
+// add records the size of a file written in the output directory
+func (b *sizeBudget) add(n int64) {
+	if b == nil {
+		return
+	}
+
+	b.Lock()
+	defer b.Unlock()
+	b.written += n
+}
+
+// exceeded returns true once the bytes written are over the budget
+func (b *sizeBudget) exceeded() bool {
+	if b == nil {
+		return false
+	}
+
+	b.Lock()
+	defer b.Unlock()
+	return b.written > b.max
+}
+
+// validOutputLayout checks the value of the --output-layout flag
+func validOutputLayout(layout string) error {
+	switch layout {
+	case "flat", "tree":
+		return nil
+	default:
+		return fmt.Errorf("invalid output layout %v (valid values are flat and tree)", layout)
+	}
+}
+
+// validOutput checks the output is set and, if it exists, is a directory
+func validOutput(opts *dumpOptions) error {
+	if opts.listOnly {
+		return nil
+	}
+
+	if opts.output == "" && opts.archivePath == "" {
+		return fmt.Errorf("the output directory is required (use --output or --archive)")
+	}
+
+	if opts.output == stdoutOutput || opts.archivePath != "" || opts.listOutputPlan {
+		return nil
+	}
+
+	info, err := os.Stat(opts.output)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return errors.Wrapf(err, "unexpected error checking the output directory %v", opts.output)
+	}
+
+	if !info.IsDir() {
+		return fmt.Errorf("the output %v exists and is not a directory", opts.output)
+	}
+
+	return nil
+}
+
+// prepareOutput checks the output directory before querying the apiserver,
+// creating it if it does not exist (or creates the archive)
+func prepareOutput(opts *dumpOptions) error {
+	err := validOutput(opts)
+	if err != nil {
+		return err
+	}
+
+	if opts.listOutputPlan || opts.listOnly || opts.output == stdoutOutput {
+		return nil
+	}
+
+	if opts.archivePath != "" {
+		if _, err := os.Stat(opts.archivePath); err == nil && opts.failIfExists {
+			return fmt.Errorf("the archive %v already exists", opts.archivePath)
+		}
+
+		opts.archive, err = newArchiveWriter(opts.archivePath, opts.fileMode, opts.compressLevel, opts.failIfExists)
+		return err
+	}
+
+	err = os.MkdirAll(opts.output, opts.dirMode)
+	if err != nil {
+		return errors.Wrapf(err, "unexpected error creating the output directory %v", opts.output)
+	}
+
+	if opts.secure {
+		// the directory could exist with a less restrictive mode
+		err = os.Chmod(opts.output, opts.dirMode)
+		if err != nil {
+			return errors.Wrapf(err, "unexpected error changing the mode of the output directory %v", opts.output)
+		}
+	}
+
+	return nil
+}
+
+// existingOutputFiles returns the files of the plan of the dump that already
+// exist in the output directory. The paths with a pattern (e.g. <name>) are
+// reported when their directory contains files (the hash names are checked
+// using the index)
+func existingOutputFiles(paths []string, opts *dumpOptions) []string {
+	existing := []string{}
+	seen := map[string]bool{}
+	for _, path := range paths {
+		if i := strings.Index(path, "<"); i >= 0 {
+			dir := path[:strings.LastIndex(path[:i], "/")]
+			if dir == opts.output || seen[dir] {
+				continue
+			}
+			seen[dir] = true
+
+			files, err := ioutil.ReadDir(dir)
+			if err == nil && len(files) > 0 {
+				existing = append(existing, dir)
+			}
+			continue
+		}
+
+		if _, err := os.Stat(path); err == nil {
+			existing = append(existing, path)
+		}
+	}
+	return existing
+}
+
+// stdoutOutput value of --output that writes the dump to the standard output
+const stdoutOutput = "-"
+
+// stdoutFile is the file of a namespace waiting in the heap of the
+// standard output (content is nil if the namespace was not written)
+type stdoutFile struct {
+	namespace string
+	content   []byte
+}
+
+// stdoutHeap is a min-heap of files keyed by the name of the namespace
+type stdoutHeap []stdoutFile
+
+func (h stdoutHeap) Len() int            { return len(h) }
+func (h stdoutHeap) Less(i, j int) bool  { return h[i].namespace < h[j].namespace }
+func (h stdoutHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *stdoutHeap) Push(x interface{}) { *h = append(*h, x.(stdoutFile)) }
+func (h *stdoutHeap) Pop() interface{} {
+	old := *h
+	file := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return file
+}
+
+// stdoutBuffer collects the files rendered when the dump is written to the
+// standard output, so the namespaces dumped concurrently do not interleave.
+// The files of the namespaces are appended to the stream ordered by name as
+// they are completed: a namespace waits in the heap only until the namespaces
+// with a lower name (the next expected) are done.
+// The Namespace objects are kept apart to write them before the files
+type stdoutBuffer struct {
+	sync.Mutex
+	files      map[string][]byte
+	namespaces map[string]string
+	// rendered files of the namespaces that are being dumped
+	rendered map[string][]byte
+
+	// expected names of the namespaces of the dump, sorted
+	expected []string
+	// next index in expected of the next namespace of the stream
+	next    int
+	pending stdoutHeap
+	stream  [][]byte
+}
+
+func newStdoutBuffer() *stdoutBuffer {
+	return &stdoutBuffer{files: map[string][]byte{}, namespaces: map[string]string{}, rendered: map[string][]byte{}}
+}
+
+// expect sets the namespaces that will be dumped
+func (b *stdoutBuffer) expect(namespaces []string) {
+	b.Lock()
+	defer b.Unlock()
+	b.expected = append([]string{}, namespaces...)
+	sort.Strings(b.expected)
+}
+
+// addNamespaceFile records the content of the file of a namespace, it is
+// added to the stream when the dump of the namespace is done
+func (b *stdoutBuffer) addNamespaceFile(ns string, content []byte) {
+	b.Lock()
+	defer b.Unlock()
+	b.rendered[ns] = content
+}
+
+// done records that the dump of a namespace finished (with or without a
+// file) and appends to the stream the files of the namespaces that are
+// next in order
+func (b *stdoutBuffer) done(ns string) {
+	b.Lock()
+	defer b.Unlock()
+
+	heap.Push(&b.pending, stdoutFile{ns, b.rendered[ns]})
+	delete(b.rendered, ns)
+	for b.pending.Len() > 0 && b.next < len(b.expected) && b.pending[0].namespace == b.expected[b.next] {
+		file := heap.Pop(&b.pending).(stdoutFile)
+		if file.content != nil {
+			b.stream = append(b.stream, file.content)
+		}
+		b.next++
+	}
+}
+
+// addNamespace records the Namespace object of a namespace (the file of
+// the namespace does not contain it)
+func (b *stdoutBuffer) addNamespace(name, doc string) {
+	b.Lock()
+	defer b.Unlock()
+	b.namespaces[name] = doc
+}
+
+// add records the content of a file
+func (b *stdoutBuffer) add(name string, content []byte) {
+	b.Lock()
+	defer b.Unlock()
+	b.files[name] = content
+}
+
+// header returns the comment written at the beginning of the standard output
+// (in yaml) with the number of objects of each namespace of the stream
+// and of the cluster-scoped types
+func (b *stdoutBuffer) header(dr *DumpResult) string {
+	names := sortedKeys(b.namespaces)
+	counts := []int{}
+	total := 0
+	for _, ns := range names {
+		count := dr.objectsIn(ns)
+		counts = append(counts, count)
+		total += count
+	}
+
+	clusterScoped := dr.objectsIn("")
+	total += clusterScoped
+
+	header := new(bytes.Buffer)
+	header.WriteString(fmt.Sprintf("# %v namespaces and %v objects\n", len(names), total))
+	if clusterScoped > 0 {
+		header.WriteString(fmt.Sprintf("#   <cluster>: %v objects\n", clusterScoped))
+	}
+	for i, ns := range names {
+		header.WriteString(fmt.Sprintf("#   %v: %v objects\n", ns, counts[i]))
+	}
+	header.WriteString("\n")
+	return header.String()
+}
+
+// flush writes the Namespace objects (a List in json) followed by the files
+// ordered by name (the files of the namespaces after the other files), so a single kubectl apply creates the namespaces first.
+// In yaml the stream starts with the header and the files are separated
+// with the document separator
+func (b *stdoutBuffer) flush(w io.Writer, dr *DumpResult, opts *dumpOptions) error {
+	b.Lock()
+	defer b.Unlock()
+
+	contents := [][]byte{}
+	if len(b.namespaces) > 0 {
+		namespaces := newDocumentWriter("# namespaces\n", opts)
+		for _, name := range sortedKeys(b.namespaces) {
+			namespaces.add(b.namespaces[name])
+		}
+
+		content, err := namespaces.bytes()
+		if err != nil {
+			return err
+		}
+		contents = append(contents, content)
+	}
+
+	names := []string{}
+	for name := range b.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		contents = append(contents, b.files[name])
+	}
+	contents = append(contents, b.stream...)
+
+	buf := new(bytes.Buffer)
+	if opts.outputFormat == "yaml" {
+		buf.WriteString(b.header(dr))
+	}
+	for i, content := range contents {
+		if i > 0 && opts.outputFormat == "yaml" {
+			buf.WriteString(fmt.Sprintf("\n%v\n", opts.documentSeparator))
+		}
+		buf.Write(content)
+	}
+
+	_, err := w.Write(encodeOutput(buf.Bytes(), opts))
+	return err
+}
+
+// writeOutput writes the rendered content to a file in the output directory
+// (or to the standard output buffer when --output is -, or to the archive)
+func writeOutput(name string, content []byte, opts *dumpOptions) error {
+	err := checkRelativePath(name)
+	if err != nil {
+		return err
+	}
+
+	if opts.stdout != nil {
+		opts.stdout.add(name, content)
+		opts.sizeBudget.add(int64(len(content)))
+		return nil
+	}
+
+	content = encodeOutput(content, opts)
+	opts.manifest.add(name, content)
+	if opts.archive != nil {
+		err = opts.archive.add(name, content)
+		if err != nil {
+			return err
+		}
+
+		opts.sizeBudget.add(int64(len(content)))
+		return nil
+	}
+
+	path := fmt.Sprintf("%v/%v", opts.output, name)
+	file, err := createFile(path, opts.fileMode, opts.failIfExists)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(content)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	err = file.Close()
+	if err != nil {
+		return err
+	}
+
+	opts.sizeBudget.add(int64(len(content)))
+	return nil
+}
+
+// streamOutput writes a file in the output directory as the content is
+// rendered by render, applying the line endings and byte order mark of the
+// options. The file has the same content written by writeOutput
+func streamOutput(name string, render func(w io.Writer) error, opts *dumpOptions) error {
+	err := checkRelativePath(name)
+	if err != nil {
+		return err
+	}
+
+	path := fmt.Sprintf("%v/%v", opts.output, name)
+	file, err := createFile(path, opts.fileMode, opts.failIfExists)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	counter := &countingWriter{}
+	buf := bufio.NewWriter(io.MultiWriter(file, hash, counter))
+
+	if opts.bom {
+		buf.Write(UTF8BOM)
+	}
+
+	var w io.Writer = buf
+	var crlf *crlfWriter
+	if opts.lineEndings == "crlf" {
+		crlf = &crlfWriter{w: buf}
+		w = crlf
+	}
+
+	err = render(w)
+	if err != nil {
+		// do not leave a partial file
+		file.Close()
+		os.Remove(path)
+		return err
+	}
+
+	if crlf != nil {
+		err = crlf.flush()
+		if err != nil {
+			return err
+		}
+	}
+
+	err = buf.Flush()
+	if err != nil {
+		return err
+	}
+
+	err = file.Close()
+	if err != nil {
+		return err
+	}
+
+	opts.manifest.addSum(name, hex.EncodeToString(hash.Sum(nil)))
+	opts.sizeBudget.add(counter.n)
+	return nil
+}
+
+// countingWriter counts the bytes written
+type countingWriter struct {
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+// crlfWriter converts the line breaks of the content to CRLF, like
+// encodeOutput. A carriage return at the end of a write is kept until
+// the next write (or flush) to check if it is part of a CRLF
+type crlfWriter struct {
+	w         io.Writer
+	pendingCR bool
+}
+
+func (c *crlfWriter) Write(p []byte) (int, error) {
+	out := make([]byte, 0, len(p)+len(p)/16+1)
+	for _, b := range p {
+		if c.pendingCR {
+			c.pendingCR = false
+			if b != '\n' {
+				out = append(out, '\r')
+			}
+		}
+
+		switch b {
+		case '\r':
+			c.pendingCR = true
+		case '\n':
+			out = append(out, '\r', '\n')
+		default:
+			out = append(out, b)
+		}
+	}
+
+	_, err := c.w.Write(out)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// flush writes the pending carriage return
+func (c *crlfWriter) flush() error {
+	if !c.pendingCR {
+		return nil
+	}
+
+	c.pendingCR = false
+	_, err := c.w.Write([]byte{'\r'})
+	return err
+}
+
+// createFile creates (or truncates) a file with the mode. The mode is set
+// even if the file already exists. With exclusive an existing file is an error
+func createFile(path string, mode os.FileMode, exclusive bool) (*os.File, error) {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if exclusive {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	}
+
+	file, err := os.OpenFile(path, flags, mode)
+	if os.IsExist(err) {
+		return nil, fmt.Errorf("the file %v already exists", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = file.Chmod(mode)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
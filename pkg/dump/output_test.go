@@ -0,0 +1,607 @@
+package dump
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	api "k8s.io/kubernetes/pkg/api/v1"
+)
+
+func TestStreamOutputMatchesWriteOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dump")
+	if err != nil {
+		t.Fatalf("unexpected error creating a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// line breaks with a carriage return split between the writes
+	content := []byte("apiVersion: v1\r\nkind: ConfigMap\ndata:\n  key: \"a\rb\"\n\r")
+	for _, lineEndings := range []string{"lf", "crlf"} {
+		for _, bom := range []bool{false, true} {
+			options := newTestOptions(dir)
+			options.LineEndings = lineEndings
+			options.BOM = bom
+			opts := completeTestOptions(t, options)
+
+			err := writeOutput("buffered.yaml", content, opts)
+			if err != nil {
+				t.Fatalf("unexpected error writing the buffered file: %v", err)
+			}
+			err = streamOutput("streamed.yaml", func(w io.Writer) error {
+				for i := range content {
+					_, err := w.Write(content[i : i+1])
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			}, opts)
+			if err != nil {
+				t.Fatalf("unexpected error writing the streamed file: %v", err)
+			}
+
+			buffered, _ := ioutil.ReadFile(dir + "/buffered.yaml")
+			streamed, _ := ioutil.ReadFile(dir + "/streamed.yaml")
+			name := fmt.Sprintf("line endings %v and bom %v", lineEndings, bom)
+			if !bytes.Equal(buffered, streamed) {
+				t.Errorf("expected the same content with %v, got %q and %q", name, buffered, streamed)
+			}
+			if opts.manifest.sums["buffered.yaml"] != opts.manifest.sums["streamed.yaml"] {
+				t.Errorf("expected the same hash with %v in the manifest, got %v", name, opts.manifest.sums)
+			}
+		}
+	}
+}
+
+func TestStreamedNamespaceMatchesRenderNamespace(t *testing.T) {
+	s := newTestCluster(t)
+	defer s.Close()
+
+	for _, lineEndings := range []string{"lf", "crlf"} {
+		files := dumpTestCluster(t, s, func(o *Options) { o.LineEndings = lineEndings })
+
+		options := newTestOptions("")
+		options.LineEndings = lineEndings
+		out, err := DumpNamespace(s.client(t), "web", options)
+		if err != nil {
+			t.Fatalf("unexpected error rendering the namespace: %v", err)
+		}
+
+		if expected := encodeOutput(out, completeTestOptions(t, options)); !bytes.Equal(files["web.yaml"], expected) {
+			t.Errorf("expected the streamed file with line endings %v to be the rendered namespace, got\n%s\n---\n%s", lineEndings, files["web.yaml"], expected)
+		}
+	}
+}
+
+func TestDumpClusterFailIfExists(t *testing.T) {
+	s := newTestCluster(t)
+	defer s.Close()
+
+	// a clean run writes the dump
+	files := dumpTestCluster(t, s, func(o *Options) { o.FailIfExists = true })
+	for _, path := range []string{"_cluster.yaml", "other.yaml", "web.yaml"} {
+		if _, ok := files[path]; !ok {
+			t.Errorf("expected the file %v in a clean run", path)
+		}
+	}
+
+	for _, failIfExists := range []bool{true, false} {
+		dir, err := ioutil.TempDir("", "dump")
+		if err != nil {
+			t.Fatalf("unexpected error creating a temporary directory: %v", err)
+		}
+		defer os.RemoveAll(dir)
+
+		previous := []byte("# the dump of yesterday\n")
+		err = ioutil.WriteFile(filepath.Join(dir, "web.yaml"), previous, 0644)
+		if err != nil {
+			t.Fatalf("unexpected error writing the previous file: %v", err)
+		}
+
+		opts := newTestOptions(dir)
+		opts.FailIfExists = failIfExists
+		result, err := DumpCluster(s.client(t), opts)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		b, _ := ioutil.ReadFile(filepath.Join(dir, "web.yaml"))
+		_, statErr := os.Stat(filepath.Join(dir, "other.yaml"))
+		if !failIfExists {
+			// the files of the previous dump are overwritten
+			if result.Failed() || bytes.Equal(b, previous) || statErr != nil {
+				t.Errorf("expected the dump to overwrite the previous file, got %v (%v)", result.Err(), statErr)
+			}
+			continue
+		}
+
+		if len(result.errors) != 1 || !strings.Contains(result.errors[0].message, "web.yaml") {
+			t.Errorf("expected an error with the existing file, got %v", result.errors)
+		}
+		if !bytes.Equal(b, previous) {
+			t.Errorf("expected the previous file to be kept, got %q", b)
+		}
+		// nothing is written when a file exists
+		entries, _ := ioutil.ReadDir(dir)
+		if len(entries) != 1 {
+			names := []string{}
+			for _, entry := range entries {
+				names = append(names, entry.Name())
+			}
+			t.Errorf("expected only the previous file in the output directory, got %v", names)
+		}
+	}
+}
+
+// dumpTestClusterStdout returns the content written to the standard
+// output by a dump with --output=-
+func dumpTestClusterStdout(t *testing.T, s *fakeAPIServer, configure func(*Options)) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("unexpected error creating a pipe: %v", err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	output := make(chan []byte)
+	go func() {
+		b, _ := ioutil.ReadAll(r)
+		output <- b
+	}()
+
+	opts := newTestOptions(stdoutOutput)
+	if configure != nil {
+		configure(&opts)
+	}
+	result, err := DumpCluster(s.client(t), opts)
+	w.Close()
+	content := <-output
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Failed() {
+		t.Fatalf("unexpected errors in the dump: %v", result.Err())
+	}
+	return string(content)
+}
+
+func TestDumpClusterStdoutNamespacesFirst(t *testing.T) {
+	s := newTestCluster(t)
+	defer s.Close()
+
+	out := dumpTestClusterStdout(t, s, nil)
+	if count := strings.Count(out, "kind: Namespace\n"); count != 2 {
+		t.Errorf("expected each Namespace object once in the output, got %v\n%v", count, out)
+	}
+	if last, first := strings.LastIndex(out, "kind: Namespace\n"), strings.Index(out, "kind: ConfigMap\n"); last > first {
+		t.Errorf("expected the Namespace objects before the other objects, got\n%v", out)
+	}
+	if other, web := strings.Index(out, "name: other\n"), strings.Index(out, "name: web\n"); other < 0 || other > web {
+		t.Errorf("expected the Namespace objects ordered by name, got\n%v", out)
+	}
+
+	out = dumpTestClusterStdout(t, s, func(o *Options) { o.OutputFormat = "json" })
+	decoder := json.NewDecoder(strings.NewReader(out))
+	var namespaces struct {
+		Items []struct {
+			Kind     string `json:"kind"`
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+		} `json:"items"`
+	}
+	err := decoder.Decode(&namespaces)
+	if err != nil {
+		t.Fatalf("unexpected error decoding the output: %v", err)
+	}
+	if len(namespaces.Items) != 2 || namespaces.Items[0].Metadata.Name != "other" || namespaces.Items[1].Kind != "Namespace" {
+		t.Errorf("expected the first List to contain the Namespace objects, got %+v", namespaces)
+	}
+	if strings.Count(out, `"kind": "Namespace"`) != 2 {
+		t.Errorf("expected each Namespace object once in the output, got\n%v", out)
+	}
+}
+
+func TestDumpClusterStdoutHeader(t *testing.T) {
+	s := newTestCluster(t)
+	defer s.Close()
+
+	out := dumpTestClusterStdout(t, s, nil)
+	expected := "# 2 namespaces and 10 objects\n" +
+		"#   other: 5 objects\n" +
+		"#   web: 5 objects\n" +
+		"\n# namespaces\n"
+	if !strings.HasPrefix(out, expected) {
+		t.Errorf("expected the output to start with\n%v\ngot\n%v", expected, out)
+	}
+
+	// the objects of each namespace in the stream
+	for _, ns := range []string{"other", "web"} {
+		if count := strings.Count(out, "\n  namespace: "+ns+"\n"); count != 5 {
+			t.Errorf("expected 5 objects of the namespace %v in the output, got %v", ns, count)
+		}
+	}
+	if count := strings.Count(out, "\nkind: ") - strings.Count(out, "\nkind: Namespace\n"); count != 10 {
+		t.Errorf("expected 10 objects in the output, got %v", count)
+	}
+}
+
+func TestStdoutBufferOrderedStream(t *testing.T) {
+	b := newStdoutBuffer()
+	b.expect([]string{"c", "a", "b"})
+
+	b.addNamespaceFile("c", []byte("c"))
+	b.done("c")
+	if len(b.stream) != 0 || b.pending.Len() != 1 {
+		t.Errorf("expected c to wait for a and b, got the stream %q and %v pending", b.stream, b.pending.Len())
+	}
+
+	b.addNamespaceFile("a", []byte("a"))
+	b.done("a")
+	if len(b.stream) != 1 || b.pending.Len() != 1 {
+		t.Errorf("expected a in the stream and c to wait for b, got the stream %q and %v pending", b.stream, b.pending.Len())
+	}
+
+	// b is not written (e.g. it was deleted during the dump)
+	b.done("b")
+	if stream := fmt.Sprintf("%s", b.stream); stream != "[a c]" || b.pending.Len() != 0 {
+		t.Errorf("expected the stream [a c] without pending files, got %v and %v pending", stream, b.pending.Len())
+	}
+}
+
+func TestStdoutBufferOrderedStreamConcurrent(t *testing.T) {
+	names := []string{}
+	for i := 0; i < 50; i++ {
+		names = append(names, fmt.Sprintf("ns-%02d", i))
+	}
+
+	b := newStdoutBuffer()
+	b.expect(names)
+
+	var wg sync.WaitGroup
+	for i := range names {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			time.Sleep(time.Duration((i*7)%10) * time.Millisecond)
+			if i%5 != 0 {
+				b.addNamespaceFile(names[i], []byte(names[i]))
+			}
+			b.done(names[i])
+		}(i)
+	}
+	wg.Wait()
+
+	expected := []string{}
+	for i, name := range names {
+		if i%5 != 0 {
+			expected = append(expected, name)
+		}
+	}
+	if stream := fmt.Sprintf("%s", b.stream); stream != fmt.Sprintf("%v", expected) {
+		t.Errorf("expected the stream %v, got %v", expected, stream)
+	}
+	if b.pending.Len() != 0 {
+		t.Errorf("expected no pending files, got %v", b.pending.Len())
+	}
+}
+
+func TestDumpClusterStdoutOrderedConcurrent(t *testing.T) {
+	s := newFakeAPIServer()
+	defer s.Close()
+	names := []string{}
+	for i := 0; i < 20; i++ {
+		ns := fmt.Sprintf("ns-%02d", 19-i)
+		names = append([]string{ns}, names...)
+		s.add(t, "namespaces", &api.Namespace{ObjectMeta: api.ObjectMeta{Name: ns}})
+		s.add(t, "configmaps", newTestConfigMap(ns, "settings"))
+	}
+
+	out := dumpTestClusterStdout(t, s, func(o *Options) {
+		o.Concurrency = 8
+		o.IncludeTypes = []string{"configmaps"}
+	})
+
+	// the configmaps follow the order of the namespaces
+	last := -1
+	for _, ns := range names {
+		i := strings.Index(out, "  namespace: "+ns+"\n")
+		if i < last {
+			t.Fatalf("expected the namespace %v after the previous namespaces in the output, got\n%v", ns, out)
+		}
+		last = i
+	}
+}
+
+func TestDumpClusterOutputDirectory(t *testing.T) {
+	s := newTestCluster(t)
+	defer s.Close()
+
+	dir, err := ioutil.TempDir("", "dump")
+	if err != nil {
+		t.Fatalf("unexpected error creating a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// an existing directory and a missing directory (it is created)
+	for _, output := range []string{dir, filepath.Join(dir, "backups", "cluster")} {
+		result, err := DumpCluster(s.client(t), newTestOptions(output))
+		if err != nil {
+			t.Fatalf("unexpected error dumping to %v: %v", output, err)
+		}
+		if result.Failed() {
+			t.Errorf("unexpected errors dumping to %v: %v", output, result.Err())
+		}
+
+		files := readDumpFiles(t, output)
+		for _, path := range []string{"_cluster.yaml", "other.yaml", "web.yaml"} {
+			if _, ok := files[path]; !ok {
+				t.Errorf("expected the file %v in %v", path, output)
+			}
+		}
+	}
+
+	// a file is not a valid output, nothing is requested to the apiserver
+	path := filepath.Join(dir, "web.yaml")
+	requests := len(s.received("GET"))
+	opts := newTestOptions(path)
+	err = opts.Validate()
+	if err == nil || !strings.Contains(err.Error(), "exists and is not a directory") {
+		t.Errorf("expected the validation to fail with a file as output, got %v", err)
+	}
+	_, err = DumpCluster(s.client(t), opts)
+	if err == nil || !strings.Contains(err.Error(), "exists and is not a directory") {
+		t.Errorf("expected the dump to fail with a file as output, got %v", err)
+	}
+	if received := s.received("GET"); len(received) != requests {
+		t.Errorf("expected no requests with an invalid output, got %v", received[requests:])
+	}
+}
+
+func TestDumpClusterDocumentSeparator(t *testing.T) {
+	s := newTestCluster(t)
+	defer s.Close()
+	s.add(t, "nodes", &api.Node{ObjectMeta: api.ObjectMeta{Name: "node-1"}})
+	s.add(t, "nodes", &api.Node{ObjectMeta: api.ObjectMeta{Name: "node-2"}})
+
+	for _, leading := range []bool{false, true} {
+		files := dumpTestCluster(t, s, func(o *Options) {
+			o.DocumentSeparator = "--- # next"
+			o.LeadingSeparator = leading
+			o.DumpNodeInfo = true
+		})
+
+		// the namespace and its 5 objects, and the 2 nodes
+		for path, documents := range map[string]int{"web.yaml": 6, "_nodes.yaml": 2} {
+			content := string(files[path])
+			separators := strings.Count(content, "\n--- # next\n")
+			if strings.HasPrefix(content, "--- # next\n") {
+				separators++
+			}
+			expected := documents - 1
+			if leading {
+				expected = documents
+			}
+			if separators != expected || strings.Contains(content, "\n---\n") {
+				t.Errorf("expected %v separators in %v with --leading-separator=%v, got %v\n%v", expected, path, leading, separators, content)
+			}
+		}
+	}
+}
+
+func TestValidDocumentSeparator(t *testing.T) {
+	for _, separator := range []string{"# next", "---\n# next", ""} {
+		opts := newTestOptions("")
+		opts.DocumentSeparator = separator
+		_, err := opts.complete()
+		if err == nil || !strings.Contains(err.Error(), "invalid document separator") {
+			t.Errorf("expected an error with the separator %q, got %v", separator, err)
+		}
+	}
+}
+
+func TestDumpClusterMaxTotalSize(t *testing.T) {
+	s := newFakeAPIServer()
+	defer s.Close()
+	for _, ns := range []string{"a", "b", "c"} {
+		s.add(t, "namespaces", &api.Namespace{ObjectMeta: api.ObjectMeta{Name: ns}})
+		s.add(t, "configmaps", newTestConfigMap(ns, "settings"))
+	}
+
+	// the budget is exceeded by the first namespace
+	result, files := runTestDump(t, s, func(o *Options) {
+		o.Concurrency = 1
+		o.IncludeTypes = []string{"configmaps"}
+		o.MaxTotalSize = 10
+	})
+	if result.Failed() {
+		t.Errorf("unexpected errors in the dump: %v", result.Err())
+	}
+
+	if a := string(files["a.yaml"]); !strings.Contains(a, "name: settings") {
+		t.Errorf("expected the namespace a to be dumped, got\n%v", a)
+	}
+	for _, path := range []string{"b.yaml", "c.yaml"} {
+		if _, ok := files[path]; ok {
+			t.Errorf("expected no file %v once the budget is exceeded", path)
+		}
+	}
+
+	var summary Summary
+	err := json.Unmarshal(files[summaryFile], &summary)
+	if err != nil {
+		t.Fatalf("unexpected error decoding the summary: %v", err)
+	}
+	if strings.Join(summary.OverBudget, ",") != "b,c" || len(summary.Namespaces) != 1 || summary.Namespaces[0].Name != "a" {
+		t.Errorf("expected the namespaces b and c over the budget, got %+v", summary)
+	}
+
+	// without a limit all the namespaces are dumped
+	_, files = runTestDump(t, s, func(o *Options) { o.IncludeTypes = []string{"configmaps"} })
+	for _, path := range []string{"a.yaml", "b.yaml", "c.yaml"} {
+		if _, ok := files[path]; !ok {
+			t.Errorf("expected the file %v without --max-total-size", path)
+		}
+	}
+}
+
+func TestDumpClusterStdoutNoFiles(t *testing.T) {
+	s := newTestCluster(t)
+	defer s.Close()
+
+	dir, err := ioutil.TempDir("", "dump")
+	if err != nil {
+		t.Fatalf("unexpected error creating a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("unexpected error getting the working directory: %v", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("unexpected error changing the working directory: %v", err)
+	}
+	defer os.Chdir(wd)
+
+	out := dumpTestClusterStdout(t, s, nil)
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("expected no files written with --output=-, got %v", len(files))
+	}
+	if count := strings.Count(out, "\nkind: ConfigMap\n"); count != 6 {
+		t.Errorf("expected the 6 configmaps in the output, got %v\n%v", count, out)
+	}
+	if !strings.Contains(out, "\n---\n") {
+		t.Errorf("expected the documents separated by ---, got\n%v", out)
+	}
+}
+
+func TestDumpClusterStdoutIncompatibleOptions(t *testing.T) {
+	s := newTestCluster(t)
+	defer s.Close()
+
+	for _, configure := range []func(*Options){
+		func(o *Options) { o.GitOpsLayout = true },
+		func(o *Options) { o.PerObjectFiles = true },
+		func(o *Options) { o.OutputHashNames = true },
+		func(o *Options) { o.CollectLogs = true },
+	} {
+		opts := newTestOptions(stdoutOutput)
+		configure(&opts)
+		_, err := DumpCluster(s.client(t), opts)
+		if err == nil || !strings.Contains(err.Error(), "cannot be used when the dump is written to the standard output") {
+			t.Errorf("expected an error with --output=-, got %v", err)
+		}
+	}
+}
+
+func TestDumpClusterFileMode(t *testing.T) {
+	s := newTestCluster(t)
+	defer s.Close()
+
+	tests := []struct {
+		name      string
+		configure func(*Options)
+		fileMode  os.FileMode
+		dirMode   os.FileMode
+	}{
+		{"default", func(o *Options) {}, 0644, 0755},
+		{"--file-mode=0640", func(o *Options) { o.FileMode = 0640 }, 0640, 0755},
+		{"--file-mode=0", func(o *Options) { o.FileMode = 0 }, 0644, 0755},
+		{"--secure", func(o *Options) { o.Secure = true; o.FileMode = 0666 }, 0600, 0700},
+	}
+
+	for _, test := range tests {
+		for _, layout := range []string{"flat", "tree"} {
+			parent, err := ioutil.TempDir("", "dump")
+			if err != nil {
+				t.Fatalf("unexpected error creating a temporary directory: %v", err)
+			}
+			defer os.RemoveAll(parent)
+			dir := filepath.Join(parent, "output")
+
+			opts := newTestOptions(dir)
+			opts.OutputLayout = layout
+			test.configure(&opts)
+			result, err := DumpCluster(s.client(t), opts)
+			if err != nil || result.Failed() {
+				t.Fatalf("%v: unexpected error: %v %v", test.name, err, result.Err())
+			}
+
+			files := 0
+			filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				expected := test.fileMode
+				if info.IsDir() {
+					expected = test.dirMode
+				} else {
+					files++
+				}
+				if mode := info.Mode().Perm(); mode != expected {
+					t.Errorf("%v with the %v layout: expected the mode %#o of %v, got %#o", test.name, layout, expected, path, mode)
+				}
+				return nil
+			})
+			if files == 0 {
+				t.Errorf("%v with the %v layout: expected the files of the dump in %v", test.name, layout, dir)
+			}
+		}
+	}
+}
+
+func TestDumpClusterSecureExistingOutput(t *testing.T) {
+	s := newTestCluster(t)
+	defer s.Close()
+
+	dir, err := ioutil.TempDir("", "dump")
+	if err != nil {
+		t.Fatalf("unexpected error creating a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	os.Chmod(dir, 0755)
+	// a file of a previous dump
+	if err := ioutil.WriteFile(filepath.Join(dir, "web.yaml"), []byte("apiVersion: v1\n"), 0644); err != nil {
+		t.Fatalf("unexpected error writing web.yaml: %v", err)
+	}
+
+	out := new(bytes.Buffer)
+	logger, _ := NewLogger("json", out)
+	opts := newTestOptions(dir)
+	opts.Secure = true
+	opts.RedactSecrets = false
+	opts.Logger = logger
+	if _, err := DumpCluster(s.client(t), opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for path, expected := range map[string]os.FileMode{dir: 0700, filepath.Join(dir, "web.yaml"): 0600} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("unexpected error reading %v: %v", path, err)
+		}
+		if mode := info.Mode().Perm(); mode != expected {
+			t.Errorf("expected the mode %#o of %v with --secure, got %#o", expected, path, mode)
+		}
+	}
+
+	if messages := strings.Join(logMessages(t, out), "\n"); !strings.Contains(messages, "warning  secrets the values of the secrets are not redacted") {
+		t.Errorf("expected a warning with --secure and --redact-secrets=false, got\n%v", messages)
+	}
+
+	opts = newTestOptions(dir)
+	opts.FileMode = os.ModeSetuid | 0644
+	if _, err := DumpCluster(s.client(t), opts); err == nil || !strings.Contains(err.Error(), "invalid file mode") {
+		t.Errorf("expected an invalid file mode error, got %v", err)
+	}
+}
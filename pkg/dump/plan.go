@@ -0,0 +1,101 @@
+package dump
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// outputPlan returns the paths of the files that a dump of the namespaces
+// would create with the layout configured in the options.
+// Names that depend on the content of the cluster (like the hash of the
+// namespace files or the logs of the pods) are shown as a pattern between <>
+func outputPlan(names, skipped []string, opts *dumpOptions) []string {
+	paths := []string{}
+	add := func(name string) {
+		if opts.archivePath != "" {
+			paths = append(paths, fmt.Sprintf("%v:%v", opts.archivePath, name))
+			return
+		}
+		paths = append(paths, fmt.Sprintf("%v/%v", opts.output, name))
+	}
+
+	if opts.dumpNodeInfo {
+		add(fileName(nodesFile, opts))
+	}
+
+	clusterScoped := false
+	types := []string{}
+	kinds := []string{}
+	mapping := typesMapping(opts)
+	for _, objectType := range sortedTypes(mapping) {
+		if skipType(objectType, opts) {
+			continue
+		}
+
+		if isClusterScoped(objectType) {
+			clusterScoped = true
+		} else {
+			types = append(types, objectType)
+			kinds = append(kinds, strings.ToLower(mapping[objectType].Kind))
+		}
+	}
+
+	if opts.treeLayout {
+		for _, objectType := range clusterScopedTypes {
+			if !skipType(objectType, opts) {
+				add(fmt.Sprintf("%v/%v/%v", clusterFile, sanitizePathSegment(objectType), fileName("<name>", opts)))
+			}
+		}
+	} else if clusterScoped {
+		add(fileName(clusterFile, opts))
+	}
+
+	sortedNames := append([]string{}, names...)
+	sort.Strings(sortedNames)
+
+	for _, name := range sortedNames {
+		ns := sanitizePathSegment(name)
+		switch {
+		case opts.gitopsLayout:
+			add(fmt.Sprintf("%v/%v", ns, fileName("namespace", opts)))
+			for _, objectType := range types {
+				add(fmt.Sprintf("%v/%v", ns, fileName(sanitizePathSegment(objectType), opts)))
+			}
+			add(fmt.Sprintf("%v/kustomization.yaml", ns))
+		case opts.perObjectFiles:
+			add(fmt.Sprintf("%v/%v", ns, fileName("namespace", opts)))
+			for _, kind := range kinds {
+				add(fmt.Sprintf("%v/%v/%v", ns, sanitizePathSegment(kind), fileName("<name>", opts)))
+			}
+		case opts.treeLayout:
+			add(fmt.Sprintf("%v/%v", ns, fileName("namespace", opts)))
+			for _, objectType := range types {
+				add(fmt.Sprintf("%v/%v/%v", ns, sanitizePathSegment(objectType), fileName("<name>", opts)))
+			}
+		case opts.hashIndex != nil:
+			add(fileName(fmt.Sprintf("<sha256 of the dump of %v>", name), opts))
+		default:
+			add(fileName(ns, opts))
+		}
+
+		if opts.collectLogs {
+			add(fmt.Sprintf("%v/logs/<pod>-<container>.log", ns))
+		}
+	}
+
+	if opts.hashIndex != nil {
+		add("index.json")
+	}
+
+	if opts.includeSystemSecretsMetadata && len(skipped) > 0 {
+		add(fileName(auditSecretsFile, opts))
+	}
+
+	if opts.output != stdoutOutput {
+		add(summaryFile)
+		add(manifestFile)
+	}
+
+	return paths
+}
@@ -0,0 +1,72 @@
+package dump
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDumpClusterListOutputPlan(t *testing.T) {
+	s := newTestCluster(t)
+	defer s.Close()
+
+	dir, err := ioutil.TempDir("", "dump")
+	if err != nil {
+		t.Fatalf("unexpected error creating a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	output := filepath.Join(dir, "backup")
+
+	tests := []struct {
+		name      string
+		configure func(*Options)
+		expected  []string
+	}{
+		{"flat", func(o *Options) {}, []string{"_cluster.yaml", "other.yaml", "web.yaml", "_summary.json", "_manifest.sha256"}},
+		{"gitops", func(o *Options) {
+			o.IncludeTypes = []string{"configmaps", "services"}
+			o.GitOpsLayout = true
+		}, []string{
+			"other/namespace.yaml", "other/configmaps.yaml", "other/services.yaml", "other/kustomization.yaml",
+			"web/namespace.yaml", "web/configmaps.yaml", "web/services.yaml", "web/kustomization.yaml",
+			"_summary.json", "_manifest.sha256",
+		}},
+		{"json with nodes and hash names", func(o *Options) {
+			o.OutputFormat = "json"
+			o.OutputHashNames = true
+			o.DumpNodeInfo = true
+			o.IncludeTypes = []string{"configmaps"}
+		}, []string{
+			"_nodes.json", "<sha256 of the dump of other>.json", "<sha256 of the dump of web>.json", "index.json",
+			"_summary.json", "_manifest.sha256",
+		}},
+	}
+
+	for _, test := range tests {
+		plan := dumpTestClusterStdout(t, s, func(o *Options) {
+			o.Output = output
+			o.ListOutputPlan = true
+			test.configure(o)
+		})
+
+		expected := ""
+		for _, path := range test.expected {
+			expected += output + "/" + path + "\n"
+		}
+		if plan != expected {
+			t.Errorf("%v: expected the plan\n%v\ngot\n%v", test.name, expected, plan)
+		}
+	}
+
+	// only the namespaces are listed and nothing is written
+	for _, request := range s.received("GET") {
+		if strings.Contains(request, "/namespaces/") {
+			t.Errorf("expected only the list of namespaces, got the request %v", request)
+		}
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Errorf("expected the output directory not to be created, got %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+package dump
+
+import (
+	"encoding/json"
+	"path"
+
+	"github.com/pkg/errors"
+
+	api "k8s.io/kubernetes/pkg/api/v1"
+	apps "k8s.io/kubernetes/pkg/apis/apps/v1beta1"
+	batch "k8s.io/kubernetes/pkg/apis/batch/v1"
+	batchv2alpha1 "k8s.io/kubernetes/pkg/apis/batch/v2alpha1"
+	extensions "k8s.io/kubernetes/pkg/apis/extensions/v1beta1"
+	"k8s.io/kubernetes/pkg/runtime"
+)
+
+// initContainersAnnotations annotations used to define init containers
+// (the field InitContainers is not serialized in this API version)
+var initContainersAnnotations = []string{
+	api.PodInitContainersBetaAnnotationKey,
+	api.PodInitContainersAnnotationKey,
+}
+
+// podSpecFor returns the metadata and the spec of the pods created by an
+// object (or of the pod itself). Returns nil if the object does not contain
+// a pod spec
+func podSpecFor(obj runtime.Object) (*api.ObjectMeta, *api.PodSpec) {
+	switch o := obj.(type) {
+	case *api.Pod:
+		return &o.ObjectMeta, &o.Spec
+	case *api.PodTemplate:
+		return &o.Template.ObjectMeta, &o.Template.Spec
+	case *api.ReplicationController:
+		if o.Spec.Template == nil {
+			return nil, nil
+		}
+		return &o.Spec.Template.ObjectMeta, &o.Spec.Template.Spec
+	case *extensions.DaemonSet:
+		return &o.Spec.Template.ObjectMeta, &o.Spec.Template.Spec
+	case *extensions.Deployment:
+		return &o.Spec.Template.ObjectMeta, &o.Spec.Template.Spec
+	case *extensions.ReplicaSet:
+		return &o.Spec.Template.ObjectMeta, &o.Spec.Template.Spec
+	case *apps.StatefulSet:
+		return &o.Spec.Template.ObjectMeta, &o.Spec.Template.Spec
+	case *batch.Job:
+		return &o.Spec.Template.ObjectMeta, &o.Spec.Template.Spec
+	case *batchv2alpha1.Job:
+		return &o.Spec.Template.ObjectMeta, &o.Spec.Template.Spec
+	}
+
+	return nil, nil
+}
+
+// validContainerPatterns checks the patterns used in --strip-container-name
+func validContainerPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		_, err := path.Match(pattern, "")
+		if err != nil {
+			return errors.Wrapf(err, "invalid container name pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+// stripContainers removes the containers and init containers with a name
+// matching one of the patterns from the pod spec of an object
+func stripContainers(obj runtime.Object, patterns []string) error {
+	if len(patterns) == 0 {
+		return nil
+	}
+
+	meta, spec := podSpecFor(obj)
+	if spec == nil {
+		return nil
+	}
+
+	spec.Containers = filterContainers(spec.Containers, patterns)
+	spec.InitContainers = filterContainers(spec.InitContainers, patterns)
+
+	for _, annotation := range initContainersAnnotations {
+		value, ok := meta.Annotations[annotation]
+		if !ok {
+			continue
+		}
+
+		var containers []api.Container
+		err := json.Unmarshal([]byte(value), &containers)
+		if err != nil {
+			return errors.Wrapf(err, "unexpected error decoding annotation %v", annotation)
+		}
+
+		raw, err := json.Marshal(filterContainers(containers, patterns))
+		if err != nil {
+			return err
+		}
+		meta.Annotations[annotation] = string(raw)
+	}
+
+	return nil
+}
+
+// filterContainers returns the containers with a name that does not match any of the patterns
+func filterContainers(containers []api.Container, patterns []string) []api.Container {
+	if containers == nil {
+		return nil
+	}
+
+	filtered := []api.Container{}
+	for _, container := range containers {
+		if !matchesAny(container.Name, patterns) {
+			filtered = append(filtered, container)
+		}
+	}
+	return filtered
+}
+
+// matchesAny returns true if the name matches one of the patterns
+func matchesAny(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// replaceImagePullSecrets replaces the image pull secrets used in the pod spec
+// of an object (or in a service account) with the secret name. If the name is
+// empty the image pull secrets are removed
+func replaceImagePullSecrets(obj runtime.Object, name string) {
+	var secrets []api.LocalObjectReference
+	if name != "" {
+		secrets = []api.LocalObjectReference{{Name: name}}
+	}
+
+	if sa, ok := obj.(*api.ServiceAccount); ok {
+		sa.ImagePullSecrets = secrets
+		return
+	}
+
+	_, spec := podSpecFor(obj)
+	if spec != nil {
+		spec.ImagePullSecrets = secrets
+	}
+}
@@ -0,0 +1,99 @@
+package dump
+
+import (
+	"strings"
+	"testing"
+
+	api "k8s.io/kubernetes/pkg/api/v1"
+	extensions "k8s.io/kubernetes/pkg/apis/extensions/v1beta1"
+)
+
+// newPodSpecTestCluster returns a fake apiserver with a deployment and a
+// pod with the containers injected by a service mesh
+func newPodSpecTestCluster(t *testing.T) *fakeAPIServer {
+	s := newFakeAPIServer()
+	s.add(t, "namespaces", &api.Namespace{ObjectMeta: api.ObjectMeta{Name: "web"}})
+
+	spec := api.PodSpec{
+		Containers:       []api.Container{{Name: "nginx", Image: "nginx:1.11"}, {Name: "istio-proxy", Image: "istio/proxy:0.1"}},
+		ImagePullSecrets: []api.LocalObjectReference{{Name: "registry-old"}},
+	}
+	annotations := map[string]string{
+		api.PodInitContainersBetaAnnotationKey: `[{"name":"istio-init","image":"istio/init:0.1"},{"name":"setup","image":"busybox"}]`,
+	}
+	s.add(t, "deployments", &extensions.Deployment{
+		ObjectMeta: api.ObjectMeta{Name: "nginx", Namespace: "web"},
+		Spec: extensions.DeploymentSpec{Template: api.PodTemplateSpec{
+			ObjectMeta: api.ObjectMeta{Annotations: annotations},
+			Spec:       spec,
+		}},
+	})
+	s.add(t, "pods", &api.Pod{ObjectMeta: api.ObjectMeta{Name: "debug", Namespace: "web", Annotations: annotations}, Spec: spec})
+	return s
+}
+
+func TestDumpClusterStripContainerName(t *testing.T) {
+	s := newPodSpecTestCluster(t)
+	defer s.Close()
+
+	files := dumpTestCluster(t, s, func(o *Options) {
+		o.IncludeTypes = []string{"deployments", "pods"}
+		o.StripContainerNames = []string{"istio-*"}
+	})
+
+	web := string(files["web.yaml"])
+	if strings.Count(web, "name: nginx\n") < 2 || strings.Contains(web, "istio-proxy") {
+		t.Errorf("expected only the container nginx in the deployment and the pod, got\n%v", web)
+	}
+	// the init containers of the annotation
+	if strings.Count(web, `"name":"setup"`) != 2 || strings.Contains(web, "istio-init") {
+		t.Errorf("expected only the init container setup in the annotations, got\n%v", web)
+	}
+}
+
+func TestValidContainerPatterns(t *testing.T) {
+	opts := newTestOptions("")
+	opts.StripContainerNames = []string{"istio-[proxy"}
+	_, err := opts.complete()
+	if err == nil || !strings.Contains(err.Error(), `invalid container name pattern "istio-[proxy"`) {
+		t.Errorf("expected an error with an invalid pattern, got %v", err)
+	}
+}
+
+func TestDumpClusterImagePullSecrets(t *testing.T) {
+	s := newPodSpecTestCluster(t)
+	defer s.Close()
+	s.add(t, "serviceaccounts", &api.ServiceAccount{
+		ObjectMeta:       api.ObjectMeta{Name: "builder", Namespace: "web"},
+		ImagePullSecrets: []api.LocalObjectReference{{Name: "registry-old"}, {Name: "registry-mirror"}},
+	})
+
+	for _, replacement := range []string{"registry-new", ""} {
+		files := dumpTestCluster(t, s, func(o *Options) {
+			o.SkipTypes = nil
+			o.IncludeTypes = []string{"deployments", "pods", "serviceaccounts"}
+			o.ReplaceImagePullSecrets = replacement
+			o.ClearImagePullSecrets = replacement == ""
+		})
+
+		web := string(files["web.yaml"])
+		if strings.Contains(web, "registry-old") || strings.Contains(web, "registry-mirror") {
+			t.Errorf("expected the image pull secrets to be replaced with %q, got\n%v", replacement, web)
+		}
+		// the deployment, the pod and the service account
+		if replacement != "" && strings.Count(web, "- name: "+replacement+"\n") != 3 {
+			t.Errorf("expected the secret %v in each object, got\n%v", replacement, web)
+		}
+		if replacement == "" && strings.Contains(web, "imagePullSecrets") {
+			t.Errorf("expected the image pull secrets to be removed, got\n%v", web)
+		}
+	}
+
+	opts := newTestOptions("")
+	opts.ReplaceImagePullSecrets = "registry-new"
+	opts.ClearImagePullSecrets = true
+	_, err := opts.complete()
+	if err == nil || !strings.Contains(err.Error(), "cannot be used together") {
+		t.Errorf("expected an error with --replace-image-pull-secrets and --clear-image-pull-secrets, got %v", err)
+	}
+}
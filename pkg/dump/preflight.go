@@ -0,0 +1,60 @@
+package dump
+
+import (
+	"strings"
+
+	authorization "k8s.io/kubernetes/pkg/apis/authorization/v1beta1"
+	client "k8s.io/kubernetes/pkg/client/clientset_generated/release_1_5"
+)
+
+// runPreflight uses SelfSubjectAccessReview to check which of the types
+// can be listed in each namespace by the current identity and logs a report
+// with the allowed and denied types. Errors are reported but do not stop the dump
+func runPreflight(kubeClient *client.Clientset, namespaces []string, opts *dumpOptions) {
+	types := []string{}
+	for _, objectType := range sortedTypes(newMappingFactoring()) {
+		if isClusterScoped(objectType) || skipType(objectType, opts) {
+			continue
+		}
+		types = append(types, objectType)
+	}
+
+	opts.log.Infof("", "", "Running preflight checks...")
+	for _, ns := range namespaces {
+		allowed := []string{}
+		denied := []string{}
+
+		for _, objectType := range types {
+			rc, _, err := clientFor(kubeClient, objectType, opts)
+			if err != nil {
+				opts.log.Warningf(ns, objectType, "unexpected error checking access to type %v in namespace %v: %v", objectType, ns, err)
+				continue
+			}
+
+			sar := &authorization.SelfSubjectAccessReview{
+				Spec: authorization.SelfSubjectAccessReviewSpec{
+					ResourceAttributes: &authorization.ResourceAttributes{
+						Namespace: ns,
+						Verb:      "list",
+						Group:     rc.APIVersion().Group,
+						Resource:  objectType,
+					},
+				},
+			}
+
+			result, err := kubeClient.Authorization().SelfSubjectAccessReviews().Create(sar)
+			if err != nil {
+				opts.log.Warningf(ns, objectType, "unexpected error checking access to type %v in namespace %v: %v", objectType, ns, err)
+				continue
+			}
+
+			if result.Status.Allowed {
+				allowed = append(allowed, objectType)
+			} else {
+				denied = append(denied, objectType)
+			}
+		}
+
+		opts.log.Infof(ns, "", "\tnamespace %v: allowed [%v] denied [%v]", ns, strings.Join(allowed, ", "), strings.Join(denied, ", "))
+	}
+}
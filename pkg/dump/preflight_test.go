@@ -0,0 +1,53 @@
+package dump
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	authorization "k8s.io/kubernetes/pkg/apis/authorization/v1beta1"
+)
+
+func TestDumpClusterPreflight(t *testing.T) {
+	s := newTestCluster(t)
+	defer s.Close()
+	// the identity cannot list the secrets
+	s.handle = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method != "POST" || !strings.HasSuffix(r.URL.Path, "/selfsubjectaccessreviews") {
+			return false
+		}
+
+		var review authorization.SelfSubjectAccessReview
+		err := json.NewDecoder(r.Body).Decode(&review)
+		if err != nil {
+			writeFakeStatus(w, http.StatusBadRequest, "BadRequest", err.Error())
+			return true
+		}
+		review.Status.Allowed = review.Spec.ResourceAttributes.Resource != "secrets"
+		writeFakeJSON(w, http.StatusCreated, review)
+		return true
+	}
+
+	out := &bytes.Buffer{}
+	logger, _ := NewLogger("json", out)
+	dumpTestCluster(t, s, func(o *Options) {
+		o.Logger = logger
+		o.IncludeTypes = []string{"configmaps", "deployments", "secrets"}
+		o.Preflight = true
+	})
+
+	messages := strings.Join(logMessages(t, out), "\n")
+	for _, ns := range []string{"web", "other"} {
+		expected := "namespace " + ns + ": allowed [configmaps, deployments] denied [secrets]"
+		if !strings.Contains(messages, expected) {
+			t.Errorf("expected the report %q, got\n%v", expected, messages)
+		}
+	}
+
+	// a review is requested for each type and namespace
+	if reviews := s.received("POST"); len(reviews) != 6 {
+		t.Errorf("expected 6 access reviews, got %v", reviews)
+	}
+}
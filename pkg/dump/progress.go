@@ -0,0 +1,76 @@
+package dump
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// progressInterval time between the progress lines written while no
+// namespace is completed
+const progressInterval = 10 * time.Second
+
+// progress writes the number of namespaces completed and the time since
+// the dump started. A nil progress does not write anything
+type progress struct {
+	w       io.Writer
+	total   int
+	started time.Time
+
+	mu   sync.Mutex
+	done int
+	stop chan struct{}
+}
+
+// newProgress starts writing the progress of the dump of total namespaces
+// every progressInterval until close is called
+func newProgress(w io.Writer, total int, started time.Time) *progress {
+	p := &progress{w: w, total: total, started: started, stop: make(chan struct{})}
+
+	go func() {
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.mu.Lock()
+				p.write()
+				p.mu.Unlock()
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+
+	return p
+}
+
+// namespaceDone records a completed namespace
+func (p *progress) namespaceDone() {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	p.write()
+}
+
+// close stops the periodic progress lines
+func (p *progress) close() {
+	if p == nil {
+		return
+	}
+	close(p.stop)
+}
+
+func (p *progress) write() {
+	fmt.Fprintf(p.w, "%v/%v namespaces (%v)\n", p.done, p.total, truncateDuration(time.Since(p.started), time.Second))
+}
+
+// truncateDuration removes the part of the duration smaller than m
+func truncateDuration(d, m time.Duration) time.Duration {
+	return d - d%m
+}
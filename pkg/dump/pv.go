@@ -0,0 +1,43 @@
+package dump
+
+import (
+	"fmt"
+
+	api "k8s.io/kubernetes/pkg/api/v1"
+)
+
+// validReclaimPolicy checks the value of the --pv-reclaim-policy flag
+func validReclaimPolicy(policy string) error {
+	switch api.PersistentVolumeReclaimPolicy(policy) {
+	case "", api.PersistentVolumeReclaimRetain, api.PersistentVolumeReclaimDelete, api.PersistentVolumeReclaimRecycle:
+		return nil
+	default:
+		return fmt.Errorf("invalid reclaim policy %q (valid values are Retain, Delete and Recycle)", policy)
+	}
+}
+
+// rewritePersistentVolume changes the reclaim policy of a persistent volume
+// and removes the sources specific to a cloud provider, so the dump can be
+// applied in a different cluster. The claimRef keeps only the namespace and
+// name of the claim: the uid and resourceVersion of the original claim
+// would prevent the binding with the restored one
+func rewritePersistentVolume(pv *api.PersistentVolume, reclaimPolicy string, clearCloudSource bool) {
+	if pv.Spec.ClaimRef != nil {
+		pv.Spec.ClaimRef.UID = ""
+		pv.Spec.ClaimRef.ResourceVersion = ""
+	}
+
+	if reclaimPolicy != "" {
+		pv.Spec.PersistentVolumeReclaimPolicy = api.PersistentVolumeReclaimPolicy(reclaimPolicy)
+	}
+
+	if clearCloudSource {
+		pv.Spec.GCEPersistentDisk = nil
+		pv.Spec.AWSElasticBlockStore = nil
+		pv.Spec.Cinder = nil
+		pv.Spec.AzureFile = nil
+		pv.Spec.AzureDisk = nil
+		pv.Spec.VsphereVolume = nil
+		pv.Spec.PhotonPersistentDisk = nil
+	}
+}
@@ -0,0 +1,66 @@
+package dump
+
+import (
+	"strings"
+	"testing"
+
+	api "k8s.io/kubernetes/pkg/api/v1"
+)
+
+func TestDumpClusterRewritePersistentVolumes(t *testing.T) {
+	s := newFakeAPIServer()
+	defer s.Close()
+	s.add(t, "namespaces", &api.Namespace{ObjectMeta: api.ObjectMeta{Name: "web"}})
+	s.add(t, "persistentvolumes", &api.PersistentVolume{
+		ObjectMeta: api.ObjectMeta{Name: "data"},
+		Spec: api.PersistentVolumeSpec{
+			PersistentVolumeSource: api.PersistentVolumeSource{
+				GCEPersistentDisk: &api.GCEPersistentDiskVolumeSource{PDName: "disk-1", FSType: "ext4"},
+			},
+			PersistentVolumeReclaimPolicy: api.PersistentVolumeReclaimRetain,
+			ClaimRef: &api.ObjectReference{
+				Kind: "PersistentVolumeClaim", Namespace: "web", Name: "data",
+				UID: "3c1b2a4d-claim-uid", ResourceVersion: "4711",
+			},
+		},
+	})
+
+	for _, rewrite := range []bool{false, true} {
+		files := dumpTestCluster(t, s, func(o *Options) {
+			o.IncludeTypes = []string{"persistentvolumes"}
+			if rewrite {
+				o.PVReclaimPolicy = "Delete"
+				o.PVClearCloudSource = true
+			}
+		})
+
+		cluster := string(files["_cluster.yaml"])
+		policy := "persistentVolumeReclaimPolicy: Retain"
+		if rewrite {
+			policy = "persistentVolumeReclaimPolicy: Delete"
+		}
+		if !strings.Contains(cluster, policy) {
+			t.Errorf("expected %v with the rewrite %v, got\n%v", policy, rewrite, cluster)
+		}
+		if strings.Contains(cluster, "pdName: disk-1") == rewrite {
+			t.Errorf("expected the cloud source only without --pv-clear-cloud-source (%v), got\n%v", rewrite, cluster)
+		}
+
+		// the volume is bound to the restored claim
+		if !strings.Contains(cluster, "claimRef:") || !strings.Contains(cluster, "    name: data\n    namespace: web\n") {
+			t.Errorf("expected the namespace and name of the claim, got\n%v", cluster)
+		}
+		if strings.Contains(cluster, "3c1b2a4d-claim-uid") || strings.Contains(cluster, "4711") {
+			t.Errorf("expected the uid and resourceVersion of the claim to be removed, got\n%v", cluster)
+		}
+	}
+}
+
+func TestValidReclaimPolicy(t *testing.T) {
+	opts := newTestOptions("")
+	opts.PVReclaimPolicy = "Keep"
+	_, err := opts.complete()
+	if err == nil || !strings.Contains(err.Error(), `invalid reclaim policy "Keep"`) {
+		t.Errorf("expected an error with an invalid reclaim policy, got %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+package dump
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/kubernetes/pkg/util/jsonpath"
+)
+
+const redactedValue = "<redacted>"
+
+// secretDataRedactPath redacts the values of the secrets when --redact-secrets is set
+const secretDataRedactPath = "Secret:.data.*"
+
+// redactRule replaces the values matched by a JSONPath expression
+// in objects of a particular kind.
+// The expression is split in the path to the parent element (a map or a list)
+// and the last segment, which is a field name or the wildcard *
+type redactRule struct {
+	kind   string
+	parent string
+	last   string
+}
+
+// parseRedactRules validates the values of the --redact-path flag.
+// The expected format is <Kind>:<JSONPath>, e.g. Secret:.data.*
+func parseRedactRules(specs []string) ([]redactRule, error) {
+	rules := []redactRule{}
+	for _, spec := range specs {
+		parts := strings.SplitN(spec, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid redact path %q (expected <Kind>:<JSONPath>)", spec)
+		}
+
+		path := strings.TrimSuffix(strings.TrimPrefix(parts[1], "{"), "}")
+		if _, err := jsonpath.Parse(spec, fmt.Sprintf("{%v}", path)); err != nil {
+			return nil, errors.Wrapf(err, "invalid redact path %q", spec)
+		}
+
+		idx := strings.LastIndex(path, ".")
+		if idx == -1 {
+			return nil, fmt.Errorf("invalid redact path %q (the expression must start with .)", spec)
+		}
+
+		last := path[idx+1:]
+		if last == "" || strings.ContainsAny(last, "[]()?@") {
+			return nil, fmt.Errorf("invalid redact path %q (the last segment must be a field name or *)", spec)
+		}
+
+		rules = append(rules, redactRule{
+			kind:   parts[0],
+			parent: path[:idx],
+			last:   last,
+		})
+	}
+
+	return rules, nil
+}
+
+// rulesFor returns the rules that apply to a kind
+func rulesFor(kind string, rules []redactRule) []redactRule {
+	matching := []redactRule{}
+	for _, rule := range rules {
+		if rule.kind == kind {
+			matching = append(matching, rule)
+		}
+	}
+	return matching
+}
+
+// apply replaces the matched values in the decoded JSON representation
+// of an object.
+// A new JSONPath is created in each invocation because it keeps internal
+// state and is not safe to use from multiple goroutines
+func (r redactRule) apply(data interface{}) error {
+	parents := []reflect.Value{reflect.ValueOf(data)}
+
+	if r.parent != "" {
+		j := jsonpath.New(r.kind).AllowMissingKeys(true)
+		err := j.Parse(fmt.Sprintf("{%v}", r.parent))
+		if err != nil {
+			return err
+		}
+
+		results, err := j.FindResults(data)
+		if err != nil {
+			return err
+		}
+
+		parents = []reflect.Value{}
+		for _, result := range results {
+			parents = append(parents, result...)
+		}
+	}
+
+	redacted := reflect.ValueOf(redactedValue)
+	for _, parent := range parents {
+		if parent.Kind() == reflect.Interface {
+			parent = parent.Elem()
+		}
+
+		switch parent.Kind() {
+		case reflect.Map:
+			if r.last == "*" {
+				for _, key := range parent.MapKeys() {
+					parent.SetMapIndex(key, redacted)
+				}
+				continue
+			}
+
+			key := reflect.ValueOf(r.last)
+			if parent.MapIndex(key).IsValid() {
+				parent.SetMapIndex(key, redacted)
+			}
+		case reflect.Slice:
+			if r.last != "*" {
+				continue
+			}
+			for i := 0; i < parent.Len(); i++ {
+				parent.Index(i).Set(redacted)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,199 @@
+package dump
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	api "k8s.io/kubernetes/pkg/api/v1"
+)
+
+func TestParseRedactRules(t *testing.T) {
+	tests := []struct {
+		spec     string
+		expected redactRule
+		err      string
+	}{
+		{spec: "Secret:.data.*", expected: redactRule{kind: "Secret", parent: ".data", last: "*"}},
+		{spec: "ConfigMap:{.data.password}", expected: redactRule{kind: "ConfigMap", parent: ".data", last: "password"}},
+		{spec: "ConfigMap:.token", expected: redactRule{kind: "ConfigMap", parent: "", last: "token"}},
+		{spec: "Deployment:.spec.template.spec.containers[*].env[*].value",
+			expected: redactRule{kind: "Deployment", parent: ".spec.template.spec.containers[*].env[*]", last: "value"}},
+		{spec: ".data.*", err: "expected <Kind>:<JSONPath>"},
+		{spec: "Secret:", err: "expected <Kind>:<JSONPath>"},
+		{spec: "Secret:data", err: "must start with ."},
+		{spec: "Secret:.data.", err: "the last segment must be a field name or *"},
+		{spec: "Secret:.data[0]", err: "the last segment must be a field name or *"},
+		{spec: "Secret:.data[", err: "invalid redact path"},
+	}
+
+	for _, test := range tests {
+		rules, err := parseRedactRules([]string{test.spec})
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("expected the error %q parsing %v, got %v", test.err, test.spec, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("unexpected error parsing %v: %v", test.spec, err)
+			continue
+		}
+		if len(rules) != 1 || rules[0] != test.expected {
+			t.Errorf("expected the rule %+v parsing %v, got %+v", test.expected, test.spec, rules)
+		}
+	}
+}
+
+func TestRedactRuleApply(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     string
+		object   string
+		expected string
+	}{
+		{
+			name:     "all the keys of a map",
+			spec:     "Secret:.data.*",
+			object:   `{"data":{"user":"YWRtaW4=","password":"c2VjcmV0"},"type":"Opaque"}`,
+			expected: `{"data":{"user":"<redacted>","password":"<redacted>"},"type":"Opaque"}`,
+		},
+		{
+			name:     "a single key",
+			spec:     "ConfigMap:.data.password",
+			object:   `{"data":{"user":"admin","password":"secret"}}`,
+			expected: `{"data":{"user":"admin","password":"<redacted>"}}`,
+		},
+		{
+			name:     "a field of the object",
+			spec:     "ConfigMap:.token",
+			object:   `{"token":"abc","data":{"token":"def"}}`,
+			expected: `{"token":"<redacted>","data":{"token":"def"}}`,
+		},
+		{
+			name:     "a field of each element of the lists",
+			spec:     "Pod:.spec.containers[*].env[*].value",
+			object:   `{"spec":{"containers":[{"env":[{"name":"A","value":"1"},{"name":"B"}]},{"env":[{"name":"C","value":"3"}]}]}}`,
+			expected: `{"spec":{"containers":[{"env":[{"name":"A","value":"<redacted>"},{"name":"B"}]},{"env":[{"name":"C","value":"<redacted>"}]}]}}`,
+		},
+		{
+			name:     "all the elements of a list",
+			spec:     "Pod:.spec.containers[*].args.*",
+			object:   `{"spec":{"containers":[{"args":["--user","admin"]}]}}`,
+			expected: `{"spec":{"containers":[{"args":["<redacted>","<redacted>"]}]}}`,
+		},
+		{
+			name:     "a field name in a list",
+			spec:     "Pod:.spec.containers[*].args.user",
+			object:   `{"spec":{"containers":[{"args":["--user","admin"]}]}}`,
+			expected: `{"spec":{"containers":[{"args":["--user","admin"]}]}}`,
+		},
+		{
+			name:     "a missing key",
+			spec:     "ConfigMap:.data.password",
+			object:   `{"data":{"user":"admin"}}`,
+			expected: `{"data":{"user":"admin"}}`,
+		},
+		{
+			name:     "a missing parent",
+			spec:     "ConfigMap:.binaryData.*",
+			object:   `{"data":{"user":"admin"}}`,
+			expected: `{"data":{"user":"admin"}}`,
+		},
+	}
+
+	for _, test := range tests {
+		rules, err := parseRedactRules([]string{test.spec})
+		if err != nil {
+			t.Fatalf("unexpected error parsing %v: %v", test.spec, err)
+		}
+
+		var data, expected interface{}
+		if err := json.Unmarshal([]byte(test.object), &data); err != nil {
+			t.Fatalf("unexpected error decoding the object of %v: %v", test.name, err)
+		}
+		if err := json.Unmarshal([]byte(test.expected), &expected); err != nil {
+			t.Fatalf("unexpected error decoding the expected object of %v: %v", test.name, err)
+		}
+
+		err = rules[0].apply(data)
+		if err != nil {
+			t.Errorf("unexpected error redacting %v: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(data, expected) {
+			t.Errorf("redacting %v: expected %v, got %v", test.name, expected, data)
+		}
+	}
+}
+
+func TestMarshalObjectRedactPaths(t *testing.T) {
+	options := newTestOptions("")
+	options.RedactPaths = []string{"ConfigMap:.data.password"}
+	opts := completeTestOptions(t, options)
+
+	cm := newTestConfigMap("web", "settings")
+	cm.Data["password"] = "secret"
+	s, err := marshalObject("ConfigMap", "v1", cm, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var decoded api.ConfigMap
+	decodeTestObject(t, s, &decoded)
+	expected := map[string]string{"color": "blue", "password": redactedValue}
+	if !reflect.DeepEqual(decoded.Data, expected) {
+		t.Errorf("expected the data %v, got %v", expected, decoded.Data)
+	}
+}
+
+func TestDumpClusterRedactSecrets(t *testing.T) {
+	s := newFakeAPIServer()
+	defer s.Close()
+	s.add(t, "namespaces", &api.Namespace{ObjectMeta: api.ObjectMeta{Name: "web"}})
+	s.add(t, "secrets", &api.Secret{
+		ObjectMeta: api.ObjectMeta{Name: "credentials", Namespace: "web"},
+		Type:       api.SecretTypeOpaque,
+		Data:       map[string][]byte{"user": []byte("admin"), "password": []byte("s3cr3t")},
+	})
+	s.add(t, "secrets", &api.Secret{
+		ObjectMeta: api.ObjectMeta{
+			Name:        "default-token-x7k2p",
+			Namespace:   "web",
+			Annotations: map[string]string{api.ServiceAccountNameKey: "default"},
+		},
+		Type: api.SecretTypeServiceAccountToken,
+		Data: map[string][]byte{"token": []byte("eyJhbGciOiJSUzI1NiJ9"), "ca.crt": []byte("-----BEGIN CERTIFICATE-----")},
+	})
+
+	for _, redact := range []bool{true, false} {
+		files := dumpTestCluster(t, s, func(opts *Options) {
+			opts.IncludeTypes = []string{"secrets"}
+			opts.RedactSecrets = redact
+		})
+
+		dumped := string(files["web.yaml"])
+		for _, expected := range []string{"type: Opaque", "type: kubernetes.io/service-account-token"} {
+			if !strings.Contains(dumped, expected) {
+				t.Errorf("expected the type of the secret (%v) with --redact-secrets=%v, got\n%v", expected, redact, dumped)
+			}
+		}
+		for _, key := range []string{"user", "password", "token", "ca.crt"} {
+			if !strings.Contains(dumped, "  "+key+": ") {
+				t.Errorf("expected the key %v with --redact-secrets=%v, got\n%v", key, redact, dumped)
+			}
+		}
+		for _, value := range []string{"admin", "s3cr3t", "eyJhbGciOiJSUzI1NiJ9", "-----BEGIN CERTIFICATE-----"} {
+			encoded := base64.StdEncoding.EncodeToString([]byte(value))
+			if strings.Contains(dumped, encoded) == redact {
+				t.Errorf("expected the value %v to be dumped only with --redact-secrets=false (%v), got\n%v", value, redact, dumped)
+			}
+		}
+		if strings.Contains(dumped, redactedValue) != redact {
+			t.Errorf("expected the values to be replaced with %v only with --redact-secrets (%v), got\n%v", redactedValue, redact, dumped)
+		}
+	}
+}
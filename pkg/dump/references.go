@@ -0,0 +1,359 @@
+package dump
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/pkg/errors"
+
+	k8s_errors "k8s.io/kubernetes/pkg/api/errors"
+	"k8s.io/kubernetes/pkg/api/meta"
+	client "k8s.io/kubernetes/pkg/client/clientset_generated/release_1_5"
+	"k8s.io/kubernetes/pkg/runtime"
+)
+
+// ObjectReference identifies an object in a dump
+type ObjectReference struct {
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+func (r ObjectReference) String() string {
+	if r.Namespace == "" {
+		return fmt.Sprintf("%v/%v", r.Kind, r.Name)
+	}
+	return fmt.Sprintf("%v/%v/%v", r.Kind, r.Namespace, r.Name)
+}
+
+// podSpecPaths location of the pod spec in the kinds that create pods
+var podSpecPaths = map[string][]string{
+	"Pod":                   {"spec"},
+	"PodTemplate":           {"template", "spec"},
+	"DaemonSet":             {"spec", "template", "spec"},
+	"Deployment":            {"spec", "template", "spec"},
+	"Job":                   {"spec", "template", "spec"},
+	"ReplicaSet":            {"spec", "template", "spec"},
+	"ReplicationController": {"spec", "template", "spec"},
+	"StatefulSet":           {"spec", "template", "spec"},
+}
+
+// ReferenceFor returns the reference to a decoded object
+func ReferenceFor(obj map[string]interface{}) ObjectReference {
+	return ObjectReference{
+		Kind:      nestedString(obj, "kind"),
+		Namespace: nestedString(obj, "metadata", "namespace"),
+		Name:      nestedString(obj, "metadata", "name"),
+	}
+}
+
+// ExtractReferences returns the objects referenced by a decoded object:
+// - owners of the object (ownerReferences)
+// - configmaps, secrets and persistent volume claims used in a pod spec
+// - endpoints of a service
+// - services and secrets used in an ingress
+// - target of a horizontal pod autoscaler
+// - persistent volume bound to a persistent volume claim
+func ExtractReferences(obj map[string]interface{}) []ObjectReference {
+	self := ReferenceFor(obj)
+	refs := []ObjectReference{}
+
+	add := func(kind, namespace, name string) {
+		if name == "" {
+			return
+		}
+		refs = append(refs, ObjectReference{Kind: kind, Namespace: namespace, Name: name})
+	}
+
+	for _, owner := range nestedSlice(obj, "metadata", "ownerReferences") {
+		add(nestedString(owner, "kind"), self.Namespace, nestedString(owner, "name"))
+	}
+
+	if path, ok := podSpecPaths[self.Kind]; ok {
+		spec := nestedField(obj, path...)
+
+		for _, volume := range nestedSlice(spec, "volumes") {
+			add("ConfigMap", self.Namespace, nestedString(volume, "configMap", "name"))
+			add("Secret", self.Namespace, nestedString(volume, "secret", "secretName"))
+			add("PersistentVolumeClaim", self.Namespace, nestedString(volume, "persistentVolumeClaim", "claimName"))
+		}
+
+		containers := append(initContainers(obj, path), nestedSlice(spec, "containers")...)
+		for _, container := range containers {
+			for _, env := range nestedSlice(container, "env") {
+				add("ConfigMap", self.Namespace, nestedString(env, "valueFrom", "configMapKeyRef", "name"))
+				add("Secret", self.Namespace, nestedString(env, "valueFrom", "secretKeyRef", "name"))
+			}
+			for _, envFrom := range nestedSlice(container, "envFrom") {
+				add("ConfigMap", self.Namespace, nestedString(envFrom, "configMapRef", "name"))
+				add("Secret", self.Namespace, nestedString(envFrom, "secretRef", "name"))
+			}
+		}
+
+		for _, pullSecret := range nestedSlice(spec, "imagePullSecrets") {
+			add("Secret", self.Namespace, nestedString(pullSecret, "name"))
+		}
+	}
+
+	switch self.Kind {
+	case "Service":
+		add("Endpoints", self.Namespace, self.Name)
+	case "Ingress":
+		add("Service", self.Namespace, nestedString(obj, "spec", "backend", "serviceName"))
+		for _, rule := range nestedSlice(obj, "spec", "rules") {
+			for _, path := range nestedSlice(rule, "http", "paths") {
+				add("Service", self.Namespace, nestedString(path, "backend", "serviceName"))
+			}
+		}
+		for _, tls := range nestedSlice(obj, "spec", "tls") {
+			add("Secret", self.Namespace, nestedString(tls, "secretName"))
+		}
+	case "HorizontalPodAutoscaler":
+		add(nestedString(obj, "spec", "scaleTargetRef", "kind"), self.Namespace, nestedString(obj, "spec", "scaleTargetRef", "name"))
+	case "PersistentVolumeClaim":
+		add("PersistentVolume", "", nestedString(obj, "spec", "volumeName"))
+	}
+
+	return uniqueReferences(refs)
+}
+
+// initContainers returns the init containers of the pod spec located in path:
+// the field initContainers and the init containers annotations of the pod
+// metadata (the metadata next to the spec). Invalid annotations are ignored
+func initContainers(obj map[string]interface{}, path []string) []interface{} {
+	containers := nestedSlice(nestedField(obj, path...), "initContainers")
+
+	metadata := nestedField(obj, path[:len(path)-1]...)
+	for _, key := range initContainersAnnotations {
+		value := nestedString(metadata, "metadata", "annotations", key)
+		if value == "" {
+			continue
+		}
+
+		var annotated []interface{}
+		if err := json.Unmarshal([]byte(value), &annotated); err == nil {
+			containers = append(containers, annotated...)
+		}
+	}
+
+	return containers
+}
+
+// uniqueReferences removes duplicated references keeping the original order
+func uniqueReferences(refs []ObjectReference) []ObjectReference {
+	seen := map[ObjectReference]bool{}
+	unique := []ObjectReference{}
+	for _, ref := range refs {
+		if seen[ref] {
+			continue
+		}
+		seen[ref] = true
+		unique = append(unique, ref)
+	}
+	return unique
+}
+
+// nestedField returns the value located in the path of fields of a decoded object
+func nestedField(obj interface{}, fields ...string) interface{} {
+	for _, field := range fields {
+		m, ok := obj.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		obj = m[field]
+	}
+	return obj
+}
+
+// nestedString returns the string located in the path of fields of a decoded object
+func nestedString(obj interface{}, fields ...string) string {
+	s, _ := nestedField(obj, fields...).(string)
+	return s
+}
+
+// nestedSlice returns the list located in the path of fields of a decoded object
+func nestedSlice(obj interface{}, fields ...string) []interface{} {
+	s, _ := nestedField(obj, fields...).([]interface{})
+	return s
+}
+
+// referencingTypes types with references followed by --with-references
+var referencingTypes = []string{"deployments", "ingresses"}
+
+// typedReference identifies an object of a dumped type in a namespace
+type typedReference struct {
+	objectType string
+	name       string
+}
+
+// referencesOf returns the objects of the namespace referenced by a dumped
+// object (see ExtractReferences) that belong to the namespaced types of the dump
+func referencesOf(obj runtime.Object, kind, ns string) ([]typedReference, error) {
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return nil, errors.Wrap(err, "unexpected error encoding the object")
+	}
+
+	decoded := map[string]interface{}{}
+	err = json.Unmarshal(b, &decoded)
+	if err != nil {
+		return nil, errors.Wrap(err, "unexpected error decoding the object")
+	}
+	// the items of the lists do not include the kind
+	decoded["kind"] = kind
+
+	refs := []typedReference{}
+	for _, ref := range ExtractReferences(decoded) {
+		objectType, _ := typeForKind(ref.Kind)
+		if objectType == "" || objectType == "namespaces" || isClusterScoped(objectType) || ref.Namespace != ns {
+			continue
+		}
+		refs = append(refs, typedReference{objectType, ref.Name})
+	}
+	return refs, nil
+}
+
+// addReferences adds to the data of a namespace the objects referenced by
+// its ingresses and deployments that were not listed (because the type was
+// skipped or the object does not match the selectors), and the objects
+// referenced by those (like the endpoints of a service). Each object is added once
+func addReferences(kubeClient *client.Clientset, ns string, data map[string]interface{}, opts *dumpOptions, dr *DumpResult) error {
+	dumped := map[typedReference]runtime.Object{}
+	for objectType, v := range data {
+		items, err := meta.ExtractList(v.(*k8sObject).Runtime)
+		if err != nil {
+			return errors.Wrap(err, "unexpected error extracting items")
+		}
+		for _, item := range items {
+			objectMeta, err := objectMetaFor(item)
+			if err != nil {
+				return err
+			}
+			dumped[typedReference{objectType, objectMeta.Name}] = item
+		}
+	}
+
+	refs := []typedReference{}
+	for _, objectType := range referencingTypes {
+		v, ok := data[objectType]
+		if !ok {
+			continue
+		}
+
+		items, err := meta.ExtractList(v.(*k8sObject).Runtime)
+		if err != nil {
+			return errors.Wrap(err, "unexpected error extracting items")
+		}
+		for _, item := range items {
+			if skipObject(item, opts) {
+				continue
+			}
+			itemRefs, err := referencesOf(item, v.(*k8sObject).Kind, ns)
+			if err != nil {
+				return err
+			}
+			refs = append(refs, itemRefs...)
+		}
+	}
+
+	mapping := newMappingFactoring()
+	created := map[string]bool{}
+	added := map[string]bool{}
+	followed := map[typedReference]bool{}
+	for len(refs) > 0 {
+		ref := refs[0]
+		refs = refs[1:]
+		if followed[ref] || opts.unservedTypes[ref.objectType] {
+			continue
+		}
+		followed[ref] = true
+
+		if obj, ok := dumped[ref]; ok {
+			objRefs, err := referencesOf(obj, mapping[ref.objectType].Kind, ns)
+			if err != nil {
+				return err
+			}
+			refs = append(refs, objRefs...)
+			continue
+		}
+
+		if _, ok := data[ref.objectType]; !ok {
+			data[ref.objectType] = mapping[ref.objectType]
+			created[ref.objectType] = true
+		}
+		result := data[ref.objectType].(*k8sObject)
+
+		obj, apiVersion, err := getObject(kubeClient, ns, ref, result.Runtime, opts)
+		switch {
+		case k8s_errors.IsNotFound(err), k8s_errors.IsForbidden(err):
+			opts.log.Warningf(ns, ref.objectType, "skipping the referenced object %v %v in namespace %v: %v", ref.objectType, ref.name, ns, err)
+			continue
+		case err != nil:
+			dr.AddError(ns, ref.objectType, errors.Wrapf(err, "unexpected error obtaining the referenced object %v", ref.name))
+			continue
+		}
+
+		items, err := meta.ExtractList(result.Runtime)
+		if err != nil {
+			return errors.Wrap(err, "unexpected error extracting items")
+		}
+		err = meta.SetList(result.Runtime, append(items, obj))
+		if err != nil {
+			return errors.Wrap(err, "unexpected error adding the referenced object")
+		}
+
+		result.APIVersion = apiVersion
+		added[ref.objectType] = true
+		opts.log.Debugf(ns, ref.objectType, "added the referenced object %v %v in namespace %v", ref.objectType, ref.name, ns)
+
+		objRefs, err := referencesOf(obj, mapping[ref.objectType].Kind, ns)
+		if err != nil {
+			return err
+		}
+		refs = append(refs, objRefs...)
+	}
+
+	for objectType := range added {
+		result := data[objectType].(*k8sObject)
+		err := sortItems(result.Runtime, opts.sortBy)
+		if err != nil {
+			return errors.Wrap(err, "unexpected error sorting items")
+		}
+
+		count, err := countObjects(result.Runtime, opts)
+		if err != nil {
+			return err
+		}
+		dr.addCount(ns, objectType, count)
+	}
+
+	// the types that were not listed and without any referenced object found are not dumped
+	for objectType := range created {
+		if !added[objectType] {
+			delete(data, objectType)
+		}
+	}
+
+	return nil
+}
+
+// getObject returns an object of a namespace and the apiVersion of the object
+func getObject(kubeClient *client.Clientset, ns string, ref typedReference, list runtime.Object, opts *dumpOptions) (runtime.Object, string, error) {
+	rc, apiVersion, err := clientFor(kubeClient, ref.objectType, opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	obj := reflect.New(listItemType(list)).Interface().(runtime.Object)
+	err = withRetries(fmt.Sprintf("getting %v %v in %v", ref.objectType, ref.name, scope(ns)), opts, func() error {
+		return rc.Get().
+			Namespace(ns).
+			Resource(ref.objectType).
+			Name(ref.name).
+			Timeout(opts.requestTimeout).
+			Do().
+			Into(obj)
+	})
+	return obj, apiVersion, err
+}
@@ -0,0 +1,148 @@
+package dump
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	api "k8s.io/kubernetes/pkg/api/v1"
+	extensions "k8s.io/kubernetes/pkg/apis/extensions/v1beta1"
+)
+
+func TestExtractReferences(t *testing.T) {
+	deployment := newTestObject("Deployment", "extensions/v1beta1", "web", "nginx")
+	deployment["spec"] = map[string]interface{}{
+		"template": map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"annotations": map[string]interface{}{
+					api.PodInitContainersBetaAnnotationKey: `[{"name":"init","env":[{"name":"TOKEN","valueFrom":{"secretKeyRef":{"name":"token"}}}]}]`,
+					api.PodInitContainersAnnotationKey:     `not json`,
+				},
+			},
+			"spec": map[string]interface{}{
+				"volumes": []interface{}{
+					map[string]interface{}{"name": "data", "persistentVolumeClaim": map[string]interface{}{"claimName": "data"}},
+				},
+				"containers": []interface{}{
+					map[string]interface{}{
+						"name":    "nginx",
+						"envFrom": []interface{}{map[string]interface{}{"configMapRef": map[string]interface{}{"name": "settings"}}},
+					},
+				},
+			},
+		},
+	}
+
+	expected := []ObjectReference{
+		{Kind: "PersistentVolumeClaim", Namespace: "web", Name: "data"},
+		{Kind: "Secret", Namespace: "web", Name: "token"},
+		{Kind: "ConfigMap", Namespace: "web", Name: "settings"},
+	}
+	if refs := ExtractReferences(deployment); !reflect.DeepEqual(refs, expected) {
+		t.Errorf("expected the references %v, got %v", expected, refs)
+	}
+}
+
+func TestDumpClusterWithReferences(t *testing.T) {
+	s := newFakeAPIServer()
+	defer s.Close()
+	s.add(t, "namespaces", &api.Namespace{ObjectMeta: api.ObjectMeta{Name: "web"}})
+	for _, name := range []string{"settings", "features"} {
+		s.add(t, "configmaps", newTestConfigMap("web", name))
+	}
+	for _, name := range []string{"token", "tls"} {
+		s.add(t, "secrets", &api.Secret{ObjectMeta: api.ObjectMeta{Name: name, Namespace: "web"}})
+	}
+	s.add(t, "persistentvolumeclaims", &api.PersistentVolumeClaim{ObjectMeta: api.ObjectMeta{Name: "data", Namespace: "web"}})
+	s.add(t, "services", &api.Service{ObjectMeta: api.ObjectMeta{Name: "nginx", Namespace: "web"}})
+	s.add(t, "endpoints", &api.Endpoints{ObjectMeta: api.ObjectMeta{Name: "nginx", Namespace: "web"}})
+	s.add(t, "ingresses", &extensions.Ingress{
+		ObjectMeta: api.ObjectMeta{Name: "nginx", Namespace: "web"},
+		Spec: extensions.IngressSpec{
+			Backend: &extensions.IngressBackend{ServiceName: "nginx"},
+			TLS:     []extensions.IngressTLS{{SecretName: "tls"}},
+		},
+	})
+	// the init containers are only serialized in the annotation
+	s.add(t, "deployments", &extensions.Deployment{
+		ObjectMeta: api.ObjectMeta{Name: "nginx", Namespace: "web"},
+		Spec: extensions.DeploymentSpec{
+			Template: api.PodTemplateSpec{
+				ObjectMeta: api.ObjectMeta{Annotations: map[string]string{
+					api.PodInitContainersBetaAnnotationKey: `[{"name":"init","env":[{"name":"TOKEN","valueFrom":{"secretKeyRef":{"name":"token"}}}]}]`,
+				}},
+				Spec: api.PodSpec{
+					Volumes: []api.Volume{
+						{Name: "data", VolumeSource: api.VolumeSource{PersistentVolumeClaim: &api.PersistentVolumeClaimVolumeSource{ClaimName: "data"}}},
+						{Name: "settings", VolumeSource: api.VolumeSource{ConfigMap: &api.ConfigMapVolumeSource{
+							LocalObjectReference: api.LocalObjectReference{Name: "settings"},
+						}}},
+					},
+					Containers: []api.Container{{Name: "nginx", Image: "nginx:1.11"}},
+				},
+			},
+		},
+	})
+
+	files := dumpTestCluster(t, s, func(opts *Options) {
+		opts.IncludeTypes = []string{"deployments", "ingresses"}
+		opts.WithReferences = true
+	})
+
+	dumped := string(files["web.yaml"])
+	for _, objectType := range []string{"configmaps", "endpoints", "persistentvolumeclaims", "secrets", "services"} {
+		if !strings.Contains(dumped, "# "+objectType+"\n") {
+			t.Errorf("expected the referenced %v in the dump, got\n%v", objectType, dumped)
+		}
+	}
+	for _, name := range []string{"settings", "token", "tls", "data"} {
+		if !strings.Contains(dumped, "  name: "+name+"\n") {
+			t.Errorf("expected the referenced object %v in the dump, got\n%v", name, dumped)
+		}
+	}
+	if strings.Contains(dumped, "name: features") {
+		t.Errorf("expected only the referenced configmaps in the dump, got\n%v", dumped)
+	}
+}
+
+func TestDumpClusterSkipOwned(t *testing.T) {
+	s := newFakeAPIServer()
+	defer s.Close()
+	s.add(t, "namespaces", &api.Namespace{ObjectMeta: api.ObjectMeta{Name: "web"}})
+
+	controller := true
+	owner := func(kind, name string, isController bool) []api.OwnerReference {
+		return []api.OwnerReference{{APIVersion: "extensions/v1beta1", Kind: kind, Name: name, Controller: &isController}}
+	}
+	s.add(t, "deployments", &extensions.Deployment{ObjectMeta: api.ObjectMeta{Name: "nginx", Namespace: "web"}})
+	s.add(t, "replicasets", &extensions.ReplicaSet{ObjectMeta: api.ObjectMeta{
+		Name: "nginx-3322722759", Namespace: "web", OwnerReferences: owner("Deployment", "nginx", controller),
+	}})
+	s.add(t, "pods", &api.Pod{ObjectMeta: api.ObjectMeta{
+		Name: "nginx-3322722759-7n4ql", Namespace: "web", OwnerReferences: owner("ReplicaSet", "nginx-3322722759", controller),
+	}})
+	// the pods without a controller are kept
+	s.add(t, "pods", &api.Pod{ObjectMeta: api.ObjectMeta{Name: "debug", Namespace: "web"}})
+	s.add(t, "pods", &api.Pod{ObjectMeta: api.ObjectMeta{
+		Name: "adopted", Namespace: "web", OwnerReferences: owner("ReplicaSet", "nginx-3322722759", !controller),
+	}})
+
+	for _, skipOwned := range []bool{false, true} {
+		files := dumpTestCluster(t, s, func(opts *Options) {
+			opts.IncludeTypes = []string{"deployments", "replicasets", "pods"}
+			opts.SkipOwned = skipOwned
+		})
+
+		dumped := string(files["web.yaml"])
+		for _, name := range []string{"nginx", "debug", "adopted"} {
+			if !strings.Contains(dumped, "\n  name: "+name+"\n") {
+				t.Errorf("expected the object %v with --skip-owned=%v, got\n%v", name, skipOwned, dumped)
+			}
+		}
+		for _, name := range []string{"nginx-3322722759", "nginx-3322722759-7n4ql"} {
+			if strings.Contains(dumped, "\n  name: "+name+"\n") == skipOwned {
+				t.Errorf("expected the object %v to be dumped only without --skip-owned (%v), got\n%v", name, skipOwned, dumped)
+			}
+		}
+	}
+}
@@ -0,0 +1,461 @@
+package dump
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+
+	unversioned_api "k8s.io/kubernetes/pkg/api"
+	k8s_errors "k8s.io/kubernetes/pkg/api/errors"
+	api "k8s.io/kubernetes/pkg/api/v1"
+	client "k8s.io/kubernetes/pkg/client/clientset_generated/release_1_5"
+	"k8s.io/kubernetes/pkg/runtime"
+)
+
+// RestoreOptions contains the settings of a restore
+type RestoreOptions struct {
+	// DryRun decodes the objects and logs what would be created without contacting the apiserver
+	DryRun bool
+	// Overwrite updates the objects that already exist instead of skipping them (only when Strategy is empty)
+	Overwrite bool
+	// Strategy used with the objects that already exist: create-only fails the restore of the
+	// object, apply merges the dump into the object like kubectl apply and replace deletes and
+	// creates the object (the namespaces are applied). Empty skips or updates them (see Overwrite)
+	Strategy string
+	// DryRunServer sends the objects to the apiserver with dryRun=All so they are validated
+	// and admitted without being persisted. Apiservers older than 1.13 do not support it and
+	// the objects are validated by the client (names, labels, annotations and keys of the data)
+	DryRunServer bool
+	// StripImmutable removes the immutable field of the configmaps and secrets so the restored
+	// objects can be updated. By default the field is preserved
+	StripImmutable bool
+}
+
+// RestoreResult collects the outcome of a restore
+type RestoreResult struct {
+	Created int
+	Updated int
+	Skipped int
+	Errors  []string
+	// Immutable objects of the dump that are immutable (configmaps and secrets)
+	Immutable []string
+}
+
+// Failed returns true if any object could not be restored
+func (r *RestoreResult) Failed() bool {
+	return len(r.Errors) > 0
+}
+
+// addError records an object that could not be restored
+func (r *RestoreResult) addError(err error) {
+	glog.Errorf("%v", err)
+	r.Errors = append(r.Errors, err.Error())
+}
+
+// restoreItem is an object of the dump decoded in the Go type of its kind
+type restoreItem struct {
+	objectType string
+	kind       string
+	apiVersion string
+	namespace  string
+	name       string
+	obj        runtime.Object
+	// doc the document of the dump
+	doc map[string]interface{}
+	// immutable the object has the field immutable set to true
+	immutable bool
+}
+
+func (i restoreItem) String() string {
+	if i.namespace == "" {
+		return fmt.Sprintf("%v/%v", i.objectType, i.name)
+	}
+	return fmt.Sprintf("%v/%v/%v", i.objectType, i.namespace, i.name)
+}
+
+// restorePhase returns the order in which a type is restored:
+// namespaces, cluster-scoped types and then the namespaced types
+func restorePhase(objectType string) int {
+	switch {
+	case objectType == "namespaces":
+		return 0
+	case isClusterScoped(objectType):
+		return 1
+	default:
+		return 2
+	}
+}
+
+// byRestoreOrder sorts the items by phase, type, namespace and name
+type byRestoreOrder []restoreItem
+
+func (b byRestoreOrder) Len() int      { return len(b) }
+func (b byRestoreOrder) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byRestoreOrder) Less(i, j int) bool {
+	pi, pj := restorePhase(b[i].objectType), restorePhase(b[j].objectType)
+	if pi != pj {
+		return pi < pj
+	}
+	return b[i].String() < b[j].String()
+}
+
+// Restore creates the objects of a dump (decoded as generic maps, like the
+// documents of the dump files). The namespaces are created first, then the
+// cluster-scoped types and the namespaced types. The objects that already
+// exist are handled with opts.Strategy.
+// Objects with an owner, with redacted values or with a kind that is not
+// dumped (e.g. Node) and the events are skipped. kubeClient is not used in dry-run mode
+func Restore(kubeClient *client.Clientset, objects []map[string]interface{}, opts RestoreOptions) *RestoreResult {
+	result := &RestoreResult{}
+
+	err := validRestoreStrategy(opts.Strategy)
+	if err != nil {
+		result.addError(err)
+		return result
+	}
+
+	items := []restoreItem{}
+	namespaces := map[string]bool{}
+	for _, obj := range objects {
+		item, err := decodeRestoreItem(obj)
+		if err != nil {
+			result.addError(err)
+			continue
+		}
+		if item == nil {
+			result.Skipped++
+			continue
+		}
+
+		if item.objectType == "namespaces" {
+			namespaces[item.name] = true
+		}
+		if item.immutable {
+			result.Immutable = append(result.Immutable, item.String())
+		}
+		items = append(items, *item)
+	}
+
+	// the namespaces of the objects that are not in the dump are created too
+	for _, item := range items {
+		if item.namespace != "" && !namespaces[item.namespace] {
+			namespaces[item.namespace] = true
+			items = append(items, restoreItem{
+				objectType: "namespaces",
+				kind:       "Namespace",
+				apiVersion: "v1",
+				name:       item.namespace,
+				obj:        &api.Namespace{ObjectMeta: api.ObjectMeta{Name: item.namespace}},
+				doc: map[string]interface{}{
+					"kind":       "Namespace",
+					"apiVersion": "v1",
+					"metadata":   map[string]interface{}{"name": item.namespace},
+				},
+			})
+		}
+	}
+
+	sort.Stable(byRestoreOrder(items))
+
+	serverDryRun := false
+	if opts.DryRunServer {
+		serverDryRun, err = supportsDryRun(kubeClient)
+		if err != nil {
+			result.addError(err)
+			return result
+		}
+		if !serverDryRun {
+			glog.Warningf("the apiserver does not support dry-run requests (Kubernetes 1.13 or newer), validating the objects in the client")
+		}
+	}
+
+	// the namespaces that would be created in a dry run do not exist, the
+	// apiserver rejects their objects and they are validated by the client
+	dryRunNamespaces := map[string]bool{}
+	for _, item := range items {
+		switch {
+		case opts.DryRun:
+			glog.Infof("\twould restore %v", item)
+			result.Created++
+		case opts.DryRunServer && serverDryRun && !dryRunNamespaces[item.namespace]:
+			if dryRunObject(kubeClient, item, opts, result) && item.objectType == "namespaces" {
+				dryRunNamespaces[item.name] = true
+			}
+		case opts.DryRunServer:
+			validateObject(item, result)
+		default:
+			restoreObject(kubeClient, item, opts, result)
+		}
+	}
+
+	return result
+}
+
+// decodeRestoreItem converts a decoded document to the Go type of its kind
+// using the mapping of the dumped types. It returns nil if the object
+// should not be restored
+func decodeRestoreItem(obj map[string]interface{}) (*restoreItem, error) {
+	kind, _ := obj["kind"].(string)
+	apiVersion, _ := obj["apiVersion"].(string)
+	metadata, _ := obj["metadata"].(map[string]interface{})
+	name, _ := metadata["name"].(string)
+	namespace, _ := metadata["namespace"].(string)
+
+	if owners, _ := metadata["ownerReferences"].([]interface{}); len(owners) > 0 {
+		glog.V(2).Infof("skipping %v %v/%v (it is managed by its owner)", kind, namespace, name)
+		return nil, nil
+	}
+
+	if containsRedactedValue(obj) {
+		glog.Warningf("skipping %v %v/%v (it contains redacted values)", kind, namespace, name)
+		return nil, nil
+	}
+
+	if kind == "Event" {
+		glog.V(2).Infof("skipping %v %v/%v (the events are not restored)", kind, namespace, name)
+		return nil, nil
+	}
+
+	objectType, itemType := typeForKind(kind)
+	if objectType == "" {
+		glog.Warningf("skipping %v %v/%v (the kind is not restored)", kind, namespace, name)
+		return nil, nil
+	}
+
+	expected := versionsFor(objectType)
+	if !containsName(apiVersion, expected) {
+		return nil, fmt.Errorf("unsupported apiVersion %v of %v %v/%v (expected %v)", apiVersion, kind, namespace, name, strings.Join(expected, " or "))
+	}
+
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unexpected error encoding %v %v/%v", kind, namespace, name)
+	}
+
+	item := reflect.New(itemType).Interface().(runtime.Object)
+	err = json.Unmarshal(raw, item)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unexpected error decoding %v %v/%v", kind, namespace, name)
+	}
+
+	if restorePhase(objectType) < 2 {
+		namespace = ""
+	}
+
+	return &restoreItem{
+		objectType: objectType,
+		kind:       kind,
+		apiVersion: apiVersion,
+		namespace:  namespace,
+		name:       name,
+		obj:        item,
+		doc:        obj,
+		immutable:  isImmutable(obj),
+	}, nil
+}
+
+// typeForKind returns the type and the Go type of the objects of a kind
+// (an empty type if the kind is not dumped)
+func typeForKind(kind string) (string, reflect.Type) {
+	if kind == "Namespace" {
+		return "namespaces", reflect.TypeOf(api.Namespace{})
+	}
+
+	mapping := newMappingFactoring()
+	for _, t := range sortedTypes(mapping) {
+		if mapping[t].Kind == kind {
+			return t, listItemType(mapping[t].Runtime)
+		}
+	}
+	return "", nil
+}
+
+// NormalizeObject returns an object of a dump decoded in its Go type with the
+// defaults of the apiserver applied, so two objects that only differ in the
+// fields with the default values (e.g. replicas: 1 or protocol: TCP) are
+// equal. The objects of the kinds or versions that are not dumped are
+// returned as they are
+func NormalizeObject(obj map[string]interface{}) (map[string]interface{}, error) {
+	kind, _ := obj["kind"].(string)
+	apiVersion, _ := obj["apiVersion"].(string)
+	objectType, itemType := typeForKind(kind)
+	if objectType == "" || !containsName(apiVersion, versionsFor(objectType)) {
+		return obj, nil
+	}
+
+	metadata, _ := obj["metadata"].(map[string]interface{})
+	name, _ := metadata["name"].(string)
+	namespace, _ := metadata["namespace"].(string)
+	ref := fmt.Sprintf("%v %v/%v", kind, namespace, name)
+
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unexpected error encoding %v", ref)
+	}
+
+	item := reflect.New(itemType).Interface().(runtime.Object)
+	err = json.Unmarshal(raw, item)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unexpected error decoding %v", ref)
+	}
+	unversioned_api.Scheme.Default(item)
+
+	raw, err = json.Marshal(item)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unexpected error encoding %v", ref)
+	}
+
+	normalized := map[string]interface{}{}
+	err = json.Unmarshal(raw, &normalized)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unexpected error decoding %v", ref)
+	}
+	return normalized, nil
+}
+
+// listItemType returns the type of the items of a list
+func listItemType(list runtime.Object) reflect.Type {
+	items, _ := reflect.TypeOf(list).Elem().FieldByName("Items")
+	return items.Type.Elem()
+}
+
+// containsRedactedValue returns true if any value of a decoded object was redacted
+func containsRedactedValue(value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		return v == redactedValue
+	case map[string]interface{}:
+		for _, item := range v {
+			if containsRedactedValue(item) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if containsRedactedValue(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// restoreObject creates an object. If the object already exists it is
+// handled with the strategy of the options (the immutable objects of the
+// cluster are not updated). Without strategy it is updated when opts.Overwrite
+// is set, using the current resourceVersion
+func restoreObject(kubeClient *client.Clientset, item restoreItem, opts RestoreOptions, result *RestoreResult) {
+	rc, err := clientForVersion(kubeClient, item.apiVersion)
+	if err != nil {
+		result.addError(errors.Wrapf(err, "unexpected error creating %v", item))
+		return
+	}
+
+	if opts.Strategy == "apply" {
+		err := setLastApplied(item, opts)
+		if err != nil {
+			result.addError(err)
+			return
+		}
+	}
+
+	body, err := requestBody(item, opts)
+	if err != nil {
+		result.addError(err)
+		return
+	}
+
+	err = rc.Post().
+		NamespaceIfScoped(item.namespace, item.namespace != "").
+		Resource(item.objectType).
+		Body(body).
+		Do().
+		Error()
+
+	switch {
+	case err == nil:
+		glog.Infof("\tcreated %v", item)
+		result.Created++
+		return
+	case !k8s_errors.IsAlreadyExists(err):
+		result.addError(errors.Wrapf(err, "unexpected error creating %v", item))
+		return
+	}
+
+	switch {
+	case opts.Strategy == "create-only":
+		result.addError(fmt.Errorf("%v already exists", item))
+		return
+	case opts.Strategy == "replace" && item.objectType != "namespaces":
+		// deleting a namespace would delete its objects, the namespaces are applied
+		replaceObject(rc, item, body, result)
+		return
+	case opts.Strategy == "" && !opts.Overwrite:
+		glog.Infof("\tskipping %v (already exists)", item)
+		result.Skipped++
+		return
+	}
+
+	// the current object is decoded as a map to read the immutable field
+	raw, err := rc.Get().
+		NamespaceIfScoped(item.namespace, item.namespace != "").
+		Resource(item.objectType).
+		Name(item.name).
+		Do().
+		Raw()
+	if err != nil {
+		result.addError(errors.Wrapf(err, "unexpected error obtaining %v", item))
+		return
+	}
+
+	current := map[string]interface{}{}
+	err = json.Unmarshal(raw, &current)
+	if err != nil {
+		result.addError(errors.Wrapf(err, "unexpected error decoding %v", item))
+		return
+	}
+
+	if isImmutable(current) {
+		result.addError(fmt.Errorf("%v is immutable in the cluster and cannot be updated (it must be deleted or replaced to restore it)", item))
+		return
+	}
+
+	if opts.Strategy != "" {
+		applyObject(rc, item, current, opts, result)
+		return
+	}
+
+	objectMeta, err := objectMetaFor(item.obj)
+	if err != nil {
+		result.addError(errors.Wrapf(err, "unexpected error reading the metadata of %v", item))
+		return
+	}
+	currentMeta, _ := current["metadata"].(map[string]interface{})
+	objectMeta.ResourceVersion, _ = currentMeta["resourceVersion"].(string)
+
+	body, err = requestBody(item, opts)
+	if err != nil {
+		result.addError(err)
+		return
+	}
+
+	err = rc.Put().
+		NamespaceIfScoped(item.namespace, item.namespace != "").
+		Resource(item.objectType).
+		Name(item.name).
+		Body(body).
+		Do().
+		Error()
+	if err != nil {
+		result.addError(errors.Wrapf(err, "unexpected error updating %v", item))
+		return
+	}
+
+	glog.Infof("\tupdated %v", item)
+	result.Updated++
+}
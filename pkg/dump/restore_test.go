@@ -0,0 +1,126 @@
+package dump
+
+import (
+	"reflect"
+	"testing"
+
+	api "k8s.io/kubernetes/pkg/api/v1"
+)
+
+// newTestObject returns a decoded object like the documents of the dump files
+func newTestObject(kind, apiVersion, ns, name string) map[string]interface{} {
+	metadata := map[string]interface{}{"name": name}
+	if ns != "" {
+		metadata["namespace"] = ns
+	}
+	return map[string]interface{}{"kind": kind, "apiVersion": apiVersion, "metadata": metadata}
+}
+
+func TestRestoreOrder(t *testing.T) {
+	s := newFakeAPIServer()
+	defer s.Close()
+
+	objects := []map[string]interface{}{
+		newTestObject("Deployment", "extensions/v1beta1", "web", "nginx"),
+		newTestObject("ConfigMap", "v1", "web", "settings"),
+		newTestObject("ClusterRole", "rbac.authorization.k8s.io/v1alpha1", "", "system:reader"),
+		newTestObject("Namespace", "v1", "", "web"),
+		newTestObject("ConfigMap", "v1", "other", "settings"),
+	}
+	result := Restore(s.client(t), objects, RestoreOptions{})
+	if result.Failed() {
+		t.Fatalf("unexpected errors: %v", result.Errors)
+	}
+
+	// the namespaces first (other is not in the dump), then the cluster-scoped and the namespaced types
+	expected := []string{
+		"POST /api/v1/namespaces",
+		"POST /api/v1/namespaces",
+		"POST /apis/rbac.authorization.k8s.io/v1alpha1/clusterroles",
+		"POST /api/v1/namespaces/other/configmaps",
+		"POST /api/v1/namespaces/web/configmaps",
+		"POST /apis/extensions/v1beta1/namespaces/web/deployments",
+	}
+	if posts := s.received("POST"); !reflect.DeepEqual(posts, expected) {
+		t.Errorf("expected the requests %v, got %v", expected, posts)
+	}
+	if result.Created != 6 {
+		t.Errorf("expected 6 objects created, got %v", result.Created)
+	}
+	for _, name := range []string{"other", "web"} {
+		if s.object("namespaces", "", name) == nil {
+			t.Errorf("expected the namespace %v to be created", name)
+		}
+	}
+}
+
+func TestRestoreSkipped(t *testing.T) {
+	owned := newTestObject("ReplicaSet", "extensions/v1beta1", "web", "nginx-1234")
+	owned["metadata"].(map[string]interface{})["ownerReferences"] = []interface{}{
+		map[string]interface{}{"kind": "Deployment", "name": "nginx"},
+	}
+	redacted := newTestObject("Secret", "v1", "web", "credentials")
+	redacted["data"] = map[string]interface{}{"password": redactedValue}
+
+	objects := []map[string]interface{}{
+		owned,
+		redacted,
+		newTestObject("Event", "v1", "web", "nginx.1"),
+		newTestObject("Node", "v1", "", "node-1"),
+	}
+	result := Restore(nil, objects, RestoreOptions{DryRun: true})
+
+	if result.Skipped != 4 || result.Created != 0 || result.Failed() {
+		t.Errorf("expected 4 objects skipped, got %+v", result)
+	}
+}
+
+func TestRestoreExisting(t *testing.T) {
+	for _, overwrite := range []bool{false, true} {
+		s := newFakeAPIServer()
+		s.add(t, "namespaces", &api.Namespace{ObjectMeta: api.ObjectMeta{Name: "web"}})
+		s.add(t, "configmaps", &api.ConfigMap{
+			ObjectMeta: api.ObjectMeta{Name: "settings", Namespace: "web"},
+			Data:       map[string]string{"color": "blue"},
+		})
+
+		obj := newTestObject("ConfigMap", "v1", "web", "settings")
+		obj["data"] = map[string]interface{}{"color": "green"}
+		result := Restore(s.client(t), []map[string]interface{}{obj}, RestoreOptions{Overwrite: overwrite})
+		if result.Failed() {
+			t.Fatalf("unexpected errors (overwrite %v): %v", overwrite, result.Errors)
+		}
+
+		color := s.object("configmaps", "web", "settings")["data"].(map[string]interface{})["color"]
+		switch {
+		case !overwrite && (result.Skipped != 2 || color != "blue"):
+			t.Errorf("expected the existing objects to be skipped, got %+v and color %v", result, color)
+		case overwrite && (result.Updated != 2 || color != "green"):
+			t.Errorf("expected the existing objects to be updated, got %+v and color %v", result, color)
+		}
+		s.Close()
+	}
+}
+
+func TestRestoreDryRun(t *testing.T) {
+	objects := []map[string]interface{}{
+		newTestObject("ConfigMap", "v1", "web", "settings"),
+	}
+	// the apiserver is not used in a dry run
+	result := Restore(nil, objects, RestoreOptions{DryRun: true})
+
+	if result.Created != 2 || result.Failed() {
+		t.Errorf("expected the namespace and the configmap to be restored, got %+v", result)
+	}
+}
+
+func TestRestoreUnsupportedVersion(t *testing.T) {
+	objects := []map[string]interface{}{
+		newTestObject("Deployment", "apps/v1", "web", "nginx"),
+	}
+	result := Restore(nil, objects, RestoreOptions{DryRun: true})
+
+	if len(result.Errors) != 1 {
+		t.Errorf("expected an error for the unsupported apiVersion, got %+v", result)
+	}
+}
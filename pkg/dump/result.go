@@ -0,0 +1,373 @@
+package dump
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// dumpIssue is a problem found dumping a type in a namespace.
+// namespace and objectType are empty when the problem does not affect a
+// particular type (e.g. an error writing the index)
+type dumpIssue struct {
+	namespace  string
+	objectType string
+	message    string
+}
+
+// byIssue sorts the issues by namespace and type
+type byIssue []dumpIssue
+
+func (b byIssue) Len() int      { return len(b) }
+func (b byIssue) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byIssue) Less(i, j int) bool {
+	if b[i].namespace != b[j].namespace {
+		return b[i].namespace < b[j].namespace
+	}
+	return b[i].objectType < b[j].objectType
+}
+
+// DumpResult collects the outcome of a dump.
+// It is safe to use from the goroutines that dump each namespace
+type DumpResult struct {
+	mu sync.Mutex
+
+	// selector label and field selectors used to list the objects
+	selector string
+	// log writes the summary of the result
+	log *Logger
+	// started time when the dump started
+	started time.Time
+
+	namespaces []string
+	errors     []dumpIssue
+	forbidden  []dumpIssue
+	notFound   []dumpIssue
+	skipped    []dumpIssue
+	deleted    []string
+	overBudget []string
+	notStarted []string
+	// counts number of objects of each type by namespace ("" for the cluster-scoped types)
+	counts map[string]map[string]int
+}
+
+// AddNamespace records a namespace selected to be dumped
+func (r *DumpResult) AddNamespace(ns string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.namespaces = append(r.namespaces, ns)
+}
+
+// AddError records an error that prevented dumping a type (or a whole
+// namespace when objectType is empty). Errors make the dump fail
+func (r *DumpResult) AddError(ns, objectType string, err error) {
+	message := err.Error()
+	switch {
+	case objectType != "":
+		message = fmt.Sprintf("unexpected error querying type %v in %v: %v", objectType, scope(ns), err)
+	case ns != "":
+		message = fmt.Sprintf("unexpected error dumping namespace %v: %v", ns, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errors = append(r.errors, dumpIssue{ns, objectType, message})
+	if ns != "" && objectType == "" {
+		// the namespace was not dumped
+		delete(r.counts, ns)
+	}
+}
+
+// addObjectError records an object that could not be converted to the
+// output format. The object is left out of the dump and the dump fails
+func (r *DumpResult) addObjectError(ns, objectType, name string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errors = append(r.errors, dumpIssue{ns, objectType,
+		fmt.Sprintf("unexpected error converting the object %v of type %v in %v: %v", name, objectType, scope(ns), err)})
+}
+
+// AddForbidden records a type the user is not allowed to list in a namespace
+// (or in the cluster when ns is empty)
+func (r *DumpResult) AddForbidden(ns, objectType string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.forbidden = append(r.forbidden, dumpIssue{ns, objectType,
+		fmt.Sprintf("forbidden to list objects of type %v in %v", objectType, scope(ns))})
+}
+
+// AddNotFound records a type without objects in a namespace
+func (r *DumpResult) AddNotFound(ns, objectType string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	message := fmt.Sprintf("there is no object of type %v in %v", objectType, scope(ns))
+	if r.selector != "" {
+		message = fmt.Sprintf("%v matching the selector %v", message, r.selector)
+	}
+	r.notFound = append(r.notFound, dumpIssue{ns, objectType, message})
+}
+
+// AddDeleted records a namespace that was deleted after the dump started.
+// The issues found querying its types are discarded
+func (r *DumpResult) AddDeleted(ns string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.deleted = append(r.deleted, ns)
+	r.notFound = withoutNamespace(r.notFound, ns)
+	r.forbidden = withoutNamespace(r.forbidden, ns)
+	r.skipped = withoutNamespace(r.skipped, ns)
+}
+
+// AddOverBudget records a namespace that was not dumped because
+// the size budget was exceeded
+func (r *DumpResult) AddOverBudget(ns string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.overBudget = append(r.overBudget, ns)
+}
+
+// AddNotStarted records a namespace that was not dumped because the dump
+// was interrupted
+func (r *DumpResult) AddNotStarted(ns string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.notStarted = append(r.notStarted, ns)
+}
+
+// notStartedCount returns the number of namespaces not started
+func (r *DumpResult) notStartedCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.notStarted)
+}
+
+// namespaceState returns the state of a namespace that was started:
+// written if it was dumped without errors, partial if only some of
+// its files or types were written or failed if the dump of the namespace
+// returned an error (recorded without a type). The mutex must be held
+func (r *DumpResult) namespaceState(ns string) string {
+	state := NamespaceWritten
+	for _, issue := range r.errors {
+		if issue.namespace != ns {
+			continue
+		}
+		if issue.objectType == "" {
+			return NamespaceFailed
+		}
+		state = NamespacePartial
+	}
+	return state
+}
+
+// scope describes where a type is listed: a namespace or, for the
+// cluster-scoped types, the whole cluster
+func scope(ns string) string {
+	if ns == "" {
+		return "the cluster"
+	}
+	return fmt.Sprintf("namespace %v", ns)
+}
+
+// withoutNamespace returns the issues that do not belong to a namespace
+func withoutNamespace(issues []dumpIssue, ns string) []dumpIssue {
+	filtered := []dumpIssue{}
+	for _, issue := range issues {
+		if issue.namespace != ns {
+			filtered = append(filtered, issue)
+		}
+	}
+	return filtered
+}
+
+// addCount records the number of objects of a type dumped in a namespace
+func (r *DumpResult) addCount(ns, objectType string, count int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.counts == nil {
+		r.counts = map[string]map[string]int{}
+	}
+	if r.counts[ns] == nil {
+		r.counts[ns] = map[string]int{}
+	}
+	r.counts[ns][objectType] = count
+}
+
+// objectsIn returns the number of objects dumped in a namespace
+func (r *DumpResult) objectsIn(ns string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	total := 0
+	for _, count := range r.counts[ns] {
+		total += count
+	}
+	return total
+}
+
+// addSkipped records a type excluded from the dump of a namespace
+func (r *DumpResult) addSkipped(ns, objectType, reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.skipped = append(r.skipped, dumpIssue{ns, objectType,
+		fmt.Sprintf("type %v in namespace %v skipped: %v", objectType, ns, reason)})
+}
+
+// messagesFor returns the issues of a namespace, used in the errors
+// section at the beginning of its dump file
+func (r *DumpResult) messagesFor(ns string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	messages := []string{}
+	for _, issues := range [][]dumpIssue{r.errors, r.notFound, r.forbidden, r.skipped} {
+		for _, issue := range issues {
+			if issue.namespace == ns && issue.objectType != "" {
+				messages = append(messages, issue.message)
+			}
+		}
+	}
+	return messages
+}
+
+// Failed returns true if any error was recorded
+func (r *DumpResult) Failed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.errors) > 0
+}
+
+// Err returns an error summarizing the errors recorded (nil if the dump
+// finished without errors). The types without objects are not errors
+func (r *DumpResult) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.errors) == 0 {
+		return nil
+	}
+
+	scopes := []string{}
+	seen := map[string]bool{}
+	for _, issue := range r.errors {
+		if !seen[issue.namespace] {
+			seen[issue.namespace] = true
+			scopes = append(scopes, issue.namespace)
+		}
+	}
+	sort.Strings(scopes)
+
+	for i, ns := range scopes {
+		scopes[i] = scope(ns)
+	}
+
+	return fmt.Errorf("the dump finished with %v errors in %v", len(r.errors), strings.Join(scopes, ", "))
+}
+
+// Empty returns true if no namespace was dumped
+func (r *DumpResult) Empty() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.namespaces) == 0
+}
+
+// Log writes a summary of the result
+func (r *DumpResult) Log() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	elapsed := ""
+	if !r.started.IsZero() {
+		elapsed = fmt.Sprintf(" in %v", truncateDuration(time.Since(r.started), time.Millisecond))
+	}
+	r.log.Infof("", "", "dumped %v namespaces%v (%v types without objects, %v forbidden types, %v errors)",
+		len(r.namespaces), elapsed, len(r.notFound), len(r.forbidden), len(r.errors))
+
+	// the namespaces are dumped concurrently, sort the
+	// issues so the order of the summary is stable
+	sort.Strings(r.deleted)
+	sort.Stable(byIssue(r.forbidden))
+	sort.Stable(byIssue(r.errors))
+
+	for _, ns := range r.deleted {
+		r.log.Warningf(ns, "", "namespace %v was deleted during the dump", ns)
+	}
+
+	names := append([]string{}, r.namespaces...)
+	sort.Strings(names)
+	for _, ns := range names {
+		if containsName(ns, r.notStarted) || containsName(ns, r.deleted) || containsName(ns, r.overBudget) {
+			continue
+		}
+
+		switch r.namespaceState(ns) {
+		case NamespacePartial:
+			r.log.Warningf(ns, "", "namespace %v was partially written", ns)
+		case NamespaceFailed:
+			r.log.Warningf(ns, "", "namespace %v was not dumped", ns)
+		}
+	}
+
+	if len(r.notStarted) > 0 {
+		sort.Strings(r.notStarted)
+		r.log.Warningf("", "", "the dump was interrupted, %v namespaces were not started: %v",
+			len(r.notStarted), strings.Join(r.notStarted, ", "))
+	}
+
+	if len(r.overBudget) > 0 {
+		sort.Strings(r.overBudget)
+		r.log.Warningf("", "", "the maximum total size was exceeded, %v namespaces were not dumped: %v",
+			len(r.overBudget), strings.Join(r.overBudget, ", "))
+	}
+
+	for _, issue := range r.forbidden {
+		r.log.Warningf(issue.namespace, issue.objectType, "%v", issue.message)
+	}
+
+	for _, issue := range r.errors {
+		r.log.Errorf(issue.namespace, issue.objectType, "%v", issue.message)
+	}
+}
+
+// writeCounts writes a table with the number of objects of each type by
+// namespace and the total (the cluster-scoped types are shown in <cluster>)
+func (r *DumpResult) writeCounts(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	namespaces := []string{}
+	for ns := range r.counts {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "NAMESPACE\tTYPE\tOBJECTS\n")
+
+	total := 0
+	for _, ns := range namespaces {
+		types := []string{}
+		for objectType := range r.counts[ns] {
+			types = append(types, objectType)
+		}
+		sort.Strings(types)
+
+		name := ns
+		if ns == "" {
+			name = "<cluster>"
+		}
+
+		for _, objectType := range types {
+			count := r.counts[ns][objectType]
+			fmt.Fprintf(tw, "%v\t%v\t%v\n", name, objectType, count)
+			total += count
+		}
+	}
+	fmt.Fprintf(tw, "TOTAL\t\t%v\n", total)
+
+	return tw.Flush()
+}
@@ -0,0 +1,71 @@
+package dump
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestDumpResultConcurrent(t *testing.T) {
+	r := &DumpResult{}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ns := fmt.Sprintf("ns-%02d", i)
+			r.AddNamespace(ns)
+			r.AddError(ns, "configmaps", fmt.Errorf("connection refused"))
+			r.AddForbidden(ns, "secrets")
+			r.AddNotFound(ns, "jobs")
+			r.addCount(ns, "services", 2)
+		}(i)
+	}
+	wg.Wait()
+
+	if len(r.namespaces) != 50 || len(r.errors) != 50 || len(r.forbidden) != 50 || len(r.notFound) != 50 {
+		t.Fatalf("expected 50 namespaces and issues of each kind, got %v namespaces, %v errors, %v forbidden and %v not found",
+			len(r.namespaces), len(r.errors), len(r.forbidden), len(r.notFound))
+	}
+
+	messages := r.messagesFor("ns-07")
+	expected := []string{
+		"unexpected error querying type configmaps in namespace ns-07: connection refused",
+		"there is no object of type jobs in namespace ns-07",
+		"forbidden to list objects of type secrets in namespace ns-07",
+	}
+	if fmt.Sprint(messages) != fmt.Sprint(expected) {
+		t.Errorf("expected the messages %v, got %v", expected, messages)
+	}
+
+	if !r.Failed() || r.Err() == nil {
+		t.Errorf("expected the result to fail")
+	}
+	if r.objectsIn("ns-07") != 2 {
+		t.Errorf("expected 2 objects in ns-07, got %v", r.objectsIn("ns-07"))
+	}
+}
+
+func TestDumpResultNamespaceError(t *testing.T) {
+	r := &DumpResult{}
+	r.addCount("web", "services", 2)
+	r.AddError("web", "", fmt.Errorf("disk full"))
+
+	if r.objectsIn("web") != 0 {
+		t.Errorf("expected the objects of a namespace that failed not to be counted, got %v", r.objectsIn("web"))
+	}
+	if err := r.Err(); err == nil || err.Error() != "the dump finished with 1 errors in namespace web" {
+		t.Errorf("expected the summary of the errors, got %v", err)
+	}
+}
+
+func TestDumpResultSuccess(t *testing.T) {
+	r := &DumpResult{}
+	r.AddNamespace("web")
+	r.AddNotFound("web", "jobs")
+
+	if r.Failed() || r.Err() != nil {
+		t.Errorf("expected the types without objects not to be errors, got %v", r.Err())
+	}
+}
@@ -0,0 +1,47 @@
+package dump
+
+import (
+	"math/rand"
+	"net"
+	"time"
+
+	k8s_errors "k8s.io/kubernetes/pkg/api/errors"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	utilnet "k8s.io/kubernetes/pkg/util/net"
+)
+
+// withRetries calls fn until it succeeds, returns an error that is not
+// transient or the retries are exhausted. The wait between the attempts
+// doubles after each failure (with up to 50% of jitter)
+func withRetries(description string, opts *dumpOptions, fn func() error) error {
+	interval := opts.retryInterval
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= opts.maxRetries || !isTransient(err) {
+			return err
+		}
+
+		wait := interval + time.Duration(rand.Int63n(int64(interval)/2+1))
+		opts.log.Warningf("", "", "%v failed (%v), retrying in %v (%v/%v)", description, err, wait, attempt+1, opts.maxRetries)
+		time.Sleep(wait)
+		interval *= 2
+	}
+}
+
+// isTransient checks if the error returned by the apiserver is temporary
+// (timeouts, throttling, 5xx responses and connection resets)
+func isTransient(err error) bool {
+	if k8s_errors.IsServerTimeout(err) || k8s_errors.IsTooManyRequests(err) || k8s_errors.IsInternalError(err) {
+		return true
+	}
+
+	if status, ok := err.(k8s_errors.APIStatus); ok {
+		return status.Status().Reason == unversioned.StatusReasonTimeout || status.Status().Code >= 500
+	}
+
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return true
+	}
+
+	return utilnet.IsProbableEOF(err)
+}
@@ -0,0 +1,71 @@
+package dump
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDumpClusterRetries(t *testing.T) {
+	s := newTestCluster(t)
+	defer s.Close()
+
+	// the list of the configmaps of web fails twice
+	var mu sync.Mutex
+	attempts := 0
+	s.handle = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path != "/api/v1/namespaces/web/configmaps" {
+			return false
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts <= 2 {
+			writeFakeStatus(w, http.StatusServiceUnavailable, "ServiceUnavailable", "the server is currently unable to handle the request")
+			return true
+		}
+		return false
+	}
+
+	files := dumpTestCluster(t, s, func(o *Options) {
+		o.MaxRetries = 3
+		o.RetryInterval = time.Millisecond
+	})
+
+	if attempts != 3 {
+		t.Errorf("expected 3 attempts to list the configmaps, got %v", attempts)
+	}
+	if web := string(files["web.yaml"]); !strings.Contains(web, "# configmaps\n") || !strings.Contains(web, "name: settings") {
+		t.Errorf("expected the configmaps in web.yaml, got\n%v", web)
+	}
+}
+
+func TestDumpClusterRetriesExhausted(t *testing.T) {
+	s := newTestCluster(t)
+	defer s.Close()
+
+	attempts := 0
+	s.handle = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path != "/api/v1/namespaces/web/configmaps" {
+			return false
+		}
+		attempts++
+		writeFakeStatus(w, http.StatusServiceUnavailable, "ServiceUnavailable", "the server is currently unable to handle the request")
+		return true
+	}
+
+	result, _ := runTestDump(t, s, func(o *Options) {
+		o.MaxRetries = 2
+		o.RetryInterval = time.Millisecond
+	})
+
+	if attempts != 3 {
+		t.Errorf("expected 3 attempts to list the configmaps, got %v", attempts)
+	}
+	if !result.Failed() {
+		t.Errorf("expected the dump to fail after the retries")
+	}
+}
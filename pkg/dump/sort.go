@@ -0,0 +1,66 @@
+package dump
+
+import (
+	"fmt"
+	"sort"
+
+	"k8s.io/kubernetes/pkg/api/meta"
+	"k8s.io/kubernetes/pkg/runtime"
+)
+
+// validSortBy checks the value of the --sort-by flag
+func validSortBy(sortBy string) error {
+	switch sortBy {
+	case "name", "created":
+		return nil
+	default:
+		return fmt.Errorf("invalid sort order %q (valid values are name and created)", sortBy)
+	}
+}
+
+// byName sorts objects by namespace and name
+type byName []runtime.Object
+
+func (o byName) Len() int      { return len(o) }
+func (o byName) Swap(i, j int) { o[i], o[j] = o[j], o[i] }
+func (o byName) Less(i, j int) bool {
+	a, _ := meta.Accessor(o[i])
+	b, _ := meta.Accessor(o[j])
+	if a.GetNamespace() != b.GetNamespace() {
+		return a.GetNamespace() < b.GetNamespace()
+	}
+	return a.GetName() < b.GetName()
+}
+
+// byCreationTimestamp sorts objects by creation time (oldest first) and name
+type byCreationTimestamp struct {
+	byName
+}
+
+func (o byCreationTimestamp) Less(i, j int) bool {
+	a, _ := meta.Accessor(o.byName[i])
+	b, _ := meta.Accessor(o.byName[j])
+	ta := a.GetCreationTimestamp()
+	tb := b.GetCreationTimestamp()
+	if !ta.Equal(tb) {
+		return ta.Before(tb)
+	}
+	return o.byName.Less(i, j)
+}
+
+// sortItems sorts the items of a list using the order name or created
+func sortItems(list runtime.Object, sortBy string) error {
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return err
+	}
+
+	switch sortBy {
+	case "created":
+		sort.Sort(byCreationTimestamp{byName(items)})
+	default:
+		sort.Sort(byName(items))
+	}
+
+	return meta.SetList(list, items)
+}
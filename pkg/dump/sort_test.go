@@ -0,0 +1,61 @@
+package dump
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	api "k8s.io/kubernetes/pkg/api/v1"
+)
+
+// configMapNamePattern matches the names of the objects of the namespace web in a dump
+var configMapNamePattern = regexp.MustCompile(`(?m)^  name: (\S+)\n  namespace: web$`)
+
+func TestDumpClusterSortBy(t *testing.T) {
+	s := newFakeAPIServer()
+	defer s.Close()
+	s.add(t, "namespaces", &api.Namespace{ObjectMeta: api.ObjectMeta{Name: "web"}})
+
+	created := map[string]time.Time{
+		"alpha":   time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC),
+		"bravo":   time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
+		"charlie": time.Date(2017, 2, 1, 0, 0, 0, 0, time.UTC),
+		// the objects created at the same time are sorted by name
+		"delta": time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	// the apiserver does not return the objects sorted
+	for _, name := range []string{"charlie", "delta", "alpha", "bravo"} {
+		cm := newTestConfigMap("web", name)
+		cm.CreationTimestamp = unversioned.NewTime(created[name])
+		s.add(t, "configmaps", cm)
+	}
+
+	for sortBy, expected := range map[string]string{
+		"name":    "alpha,bravo,charlie,delta",
+		"created": "bravo,delta,charlie,alpha",
+	} {
+		files := dumpTestCluster(t, s, func(o *Options) {
+			o.IncludeTypes = []string{"configmaps"}
+			o.SortBy = sortBy
+		})
+
+		names := []string{}
+		for _, match := range configMapNamePattern.FindAllStringSubmatch(string(files["web.yaml"]), -1) {
+			names = append(names, match[1])
+		}
+		if strings.Join(names, ",") != expected {
+			t.Errorf("expected the order %v with --sort-by=%v, got %v", expected, sortBy, names)
+		}
+	}
+}
+
+func TestValidSortBy(t *testing.T) {
+	opts := newTestOptions("")
+	opts.SortBy = "size"
+	_, err := opts.complete()
+	if err == nil || !strings.Contains(err.Error(), `invalid sort order "size"`) {
+		t.Errorf("expected an error with an invalid sort order, got %v", err)
+	}
+}
@@ -0,0 +1,257 @@
+package dump
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+
+	unversioned_api "k8s.io/kubernetes/pkg/api"
+	k8s_errors "k8s.io/kubernetes/pkg/api/errors"
+	restclient "k8s.io/kubernetes/pkg/client/restclient"
+	"k8s.io/kubernetes/pkg/util/wait"
+)
+
+// lastAppliedAnnotation annotation with the configuration of the last apply
+// (the same used by kubectl apply, so both can be used on the objects)
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+const (
+	// replaceInterval time between the attempts to create a replaced object
+	replaceInterval = 500 * time.Millisecond
+	// replaceTimeout maximum time to wait for the deletion of a replaced object
+	replaceTimeout = 30 * time.Second
+)
+
+// validRestoreStrategy checks the strategy used with the objects that already
+// exist. The empty strategy skips or updates them (see RestoreOptions.Overwrite)
+func validRestoreStrategy(strategy string) error {
+	switch strategy {
+	case "", "apply", "create-only", "replace":
+		return nil
+	default:
+		return fmt.Errorf("invalid restore strategy %q (valid values are apply, create-only and replace)", strategy)
+	}
+}
+
+// appliedConfiguration returns the configuration of an object used by the
+// apply strategy: the document of the dump without status and empty fields
+func appliedConfiguration(item restoreItem, opts RestoreOptions) (map[string]interface{}, error) {
+	b, err := json.Marshal(item.doc)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unexpected error encoding %v", item)
+	}
+
+	config := map[string]interface{}{}
+	err = json.Unmarshal(b, &config)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unexpected error encoding %v", item)
+	}
+
+	delete(config, "status")
+	if opts.StripImmutable {
+		delete(config, "immutable")
+	}
+
+	if metadata, ok := config["metadata"].(map[string]interface{}); ok {
+		for _, field := range []string{"resourceVersion", "uid", "selfLink", "creationTimestamp", "generation"} {
+			delete(metadata, field)
+		}
+		if annotations, ok := metadata["annotations"].(map[string]interface{}); ok {
+			delete(annotations, lastAppliedAnnotation)
+		}
+	}
+
+	removeNulls(config)
+	return config, nil
+}
+
+// removeNulls removes the fields without value of a decoded object
+func removeNulls(data interface{}) {
+	switch v := data.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			if item == nil {
+				delete(v, k)
+				continue
+			}
+			removeNulls(item)
+		}
+	case []interface{}:
+		for _, item := range v {
+			removeNulls(item)
+		}
+	}
+}
+
+// setLastApplied sets the annotation with the applied configuration in the
+// object created by the apply strategy, so the next apply can remove the
+// fields deleted from the dump
+func setLastApplied(item restoreItem, opts RestoreOptions) error {
+	config, err := appliedConfiguration(item, opts)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(config)
+	if err != nil {
+		return errors.Wrapf(err, "unexpected error encoding %v", item)
+	}
+
+	objectMeta, err := objectMetaFor(item.obj)
+	if err != nil {
+		return errors.Wrapf(err, "unexpected error reading the metadata of %v", item)
+	}
+	if objectMeta.Annotations == nil {
+		objectMeta.Annotations = map[string]string{}
+	}
+	objectMeta.Annotations[lastAppliedAnnotation] = string(b)
+	return nil
+}
+
+// applyObject updates an existing object with a json merge patch computed
+// like kubectl apply: the fields of the dump that differ from the current
+// object are set and the fields of the last applied configuration that are
+// not in the dump are removed. The other fields of the current object are kept
+func applyObject(rc restclient.Interface, item restoreItem, current map[string]interface{}, opts RestoreOptions, result *RestoreResult) {
+	config, err := appliedConfiguration(item, opts)
+	if err != nil {
+		result.addError(err)
+		return
+	}
+
+	b, err := json.Marshal(config)
+	if err != nil {
+		result.addError(errors.Wrapf(err, "unexpected error encoding %v", item))
+		return
+	}
+
+	original := map[string]interface{}{}
+	metadata, _ := current["metadata"].(map[string]interface{})
+	annotations, _ := metadata["annotations"].(map[string]interface{})
+	if last, ok := annotations[lastAppliedAnnotation].(string); ok {
+		err := json.Unmarshal([]byte(last), &original)
+		if err != nil {
+			glog.Warningf("ignoring the invalid last applied configuration of %v: %v", item, err)
+		}
+	}
+
+	modified := config
+	modifiedMetadata, _ := modified["metadata"].(map[string]interface{})
+	if modifiedMetadata == nil {
+		modifiedMetadata = map[string]interface{}{}
+		modified["metadata"] = modifiedMetadata
+	}
+	modifiedAnnotations, _ := modifiedMetadata["annotations"].(map[string]interface{})
+	if modifiedAnnotations == nil {
+		modifiedAnnotations = map[string]interface{}{}
+		modifiedMetadata["annotations"] = modifiedAnnotations
+	}
+	modifiedAnnotations[lastAppliedAnnotation] = string(b)
+
+	patch := threeWayMergePatch(original, modified, current)
+	if len(patch) == 0 {
+		glog.Infof("\tskipping %v (unchanged)", item)
+		result.Skipped++
+		return
+	}
+
+	body, err := json.Marshal(patch)
+	if err != nil {
+		result.addError(errors.Wrapf(err, "unexpected error encoding the patch of %v", item))
+		return
+	}
+
+	err = rc.Patch(unversioned_api.MergePatchType).
+		NamespaceIfScoped(item.namespace, item.namespace != "").
+		Resource(item.objectType).
+		Name(item.name).
+		Body(body).
+		Do().
+		Error()
+	if err != nil {
+		result.addError(errors.Wrapf(err, "unexpected error applying %v", item))
+		return
+	}
+
+	glog.Infof("\tapplied %v", item)
+	result.Updated++
+}
+
+// threeWayMergePatch returns the json merge patch that sets the fields of
+// modified that are different in current and removes the fields of original
+// that are not in modified. The lists are replaced
+func threeWayMergePatch(original, modified, current map[string]interface{}) map[string]interface{} {
+	patch := map[string]interface{}{}
+	for k, v := range modified {
+		c, ok := current[k]
+		if !ok {
+			patch[k] = v
+			continue
+		}
+
+		vm, okm := v.(map[string]interface{})
+		cm, okc := c.(map[string]interface{})
+		if okm && okc {
+			om, _ := original[k].(map[string]interface{})
+			if p := threeWayMergePatch(om, vm, cm); len(p) > 0 {
+				patch[k] = p
+			}
+			continue
+		}
+
+		if !reflect.DeepEqual(v, c) {
+			patch[k] = v
+		}
+	}
+
+	for k := range original {
+		if _, ok := modified[k]; ok {
+			continue
+		}
+		if _, ok := current[k]; ok {
+			patch[k] = nil
+		}
+	}
+
+	return patch
+}
+
+// replaceObject deletes an existing object and creates it again, waiting
+// until the deletion is completed
+func replaceObject(rc restclient.Interface, item restoreItem, body interface{}, result *RestoreResult) {
+	err := rc.Delete().
+		NamespaceIfScoped(item.namespace, item.namespace != "").
+		Resource(item.objectType).
+		Name(item.name).
+		Do().
+		Error()
+	if err != nil && !k8s_errors.IsNotFound(err) {
+		result.addError(errors.Wrapf(err, "unexpected error deleting %v", item))
+		return
+	}
+
+	err = wait.PollImmediate(replaceInterval, replaceTimeout, func() (bool, error) {
+		err := rc.Post().
+			NamespaceIfScoped(item.namespace, item.namespace != "").
+			Resource(item.objectType).
+			Body(body).
+			Do().
+			Error()
+		if k8s_errors.IsAlreadyExists(err) {
+			// the object is still being deleted
+			return false, nil
+		}
+		return true, err
+	})
+	if err != nil {
+		result.addError(errors.Wrapf(err, "unexpected error replacing %v", item))
+		return
+	}
+
+	glog.Infof("\treplaced %v", item)
+	result.Updated++
+}
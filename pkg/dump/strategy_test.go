@@ -0,0 +1,125 @@
+package dump
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	api "k8s.io/kubernetes/pkg/api/v1"
+)
+
+// newStrategyServer returns a fake apiserver with an existing namespace and
+// configmap, and the configmap of the dump
+func newStrategyServer(t *testing.T) (*fakeAPIServer, map[string]interface{}) {
+	s := newFakeAPIServer()
+	s.add(t, "namespaces", &api.Namespace{ObjectMeta: api.ObjectMeta{Name: "web"}})
+	s.add(t, "configmaps", &api.ConfigMap{
+		ObjectMeta: api.ObjectMeta{Name: "settings", Namespace: "web", Labels: map[string]string{"owner": "ops"}},
+		Data:       map[string]string{"color": "blue", "size": "big"},
+	})
+
+	obj := newTestObject("ConfigMap", "v1", "web", "settings")
+	obj["data"] = map[string]interface{}{"color": "green"}
+	return s, obj
+}
+
+func TestRestoreCreateOnly(t *testing.T) {
+	s, obj := newStrategyServer(t)
+	defer s.Close()
+
+	objects := []map[string]interface{}{obj, newTestObject("ConfigMap", "v1", "web", "new")}
+	result := Restore(s.client(t), objects, RestoreOptions{Strategy: "create-only"})
+
+	// the namespace and the configmap already exist
+	if len(result.Errors) != 2 || !strings.Contains(result.Errors[1], "configmaps/web/settings already exists") {
+		t.Errorf("expected an error for each existing object, got %v", result.Errors)
+	}
+	if result.Created != 1 || s.object("configmaps", "web", "new") == nil {
+		t.Errorf("expected the new configmap to be created, got %+v", result)
+	}
+	if color := s.object("configmaps", "web", "settings")["data"].(map[string]interface{})["color"]; color != "blue" {
+		t.Errorf("expected the existing configmap not to be changed, got color %v", color)
+	}
+}
+
+func TestRestoreApply(t *testing.T) {
+	s, obj := newStrategyServer(t)
+	defer s.Close()
+
+	result := Restore(s.client(t), []map[string]interface{}{obj}, RestoreOptions{Strategy: "apply"})
+	if result.Failed() || result.Updated != 2 {
+		t.Fatalf("expected 2 objects applied, got %+v", result)
+	}
+
+	cm := s.object("configmaps", "web", "settings")
+	data := cm["data"].(map[string]interface{})
+	labels := cm["metadata"].(map[string]interface{})["labels"].(map[string]interface{})
+	if data["color"] != "green" || data["size"] != "big" || labels["owner"] != "ops" {
+		t.Errorf("expected the dump merged into the configmap, got %v", cm)
+	}
+	annotations := cm["metadata"].(map[string]interface{})["annotations"].(map[string]interface{})
+	if _, ok := annotations[lastAppliedAnnotation]; !ok {
+		t.Errorf("expected the annotation %v, got %v", lastAppliedAnnotation, annotations)
+	}
+
+	// a second restore of the same dump does not change the objects
+	patches := len(s.received("PATCH"))
+	result = Restore(s.client(t), []map[string]interface{}{obj}, RestoreOptions{Strategy: "apply"})
+	if result.Failed() || result.Skipped != 2 || len(s.received("PATCH")) != patches {
+		t.Errorf("expected the objects to be unchanged, got %+v and %v patches", result, len(s.received("PATCH"))-patches)
+	}
+}
+
+func TestRestoreApplyRemovedField(t *testing.T) {
+	s := newFakeAPIServer()
+	defer s.Close()
+
+	obj := newTestObject("ConfigMap", "v1", "web", "settings")
+	obj["data"] = map[string]interface{}{"color": "green", "size": "big"}
+	result := Restore(s.client(t), []map[string]interface{}{obj}, RestoreOptions{Strategy: "apply"})
+	if result.Failed() || result.Created != 2 {
+		t.Fatalf("expected 2 objects created, got %+v", result)
+	}
+
+	// the field removed from the dump is removed from the object
+	obj["data"] = map[string]interface{}{"color": "green"}
+	result = Restore(s.client(t), []map[string]interface{}{obj}, RestoreOptions{Strategy: "apply"})
+	if result.Failed() || result.Updated != 1 {
+		t.Fatalf("expected the configmap to be applied, got %+v", result)
+	}
+
+	data := s.object("configmaps", "web", "settings")["data"]
+	if expected := map[string]interface{}{"color": "green"}; !reflect.DeepEqual(data, expected) {
+		t.Errorf("expected the data %v, got %v", expected, data)
+	}
+}
+
+func TestRestoreReplace(t *testing.T) {
+	s, obj := newStrategyServer(t)
+	defer s.Close()
+
+	result := Restore(s.client(t), []map[string]interface{}{obj}, RestoreOptions{Strategy: "replace"})
+	if result.Failed() || result.Updated != 2 {
+		t.Fatalf("expected 2 objects restored, got %+v", result)
+	}
+
+	if deletes := s.received("DELETE"); !reflect.DeepEqual(deletes, []string{"DELETE /api/v1/namespaces/web/configmaps/settings"}) {
+		t.Errorf("expected only the configmap to be deleted, got %v", deletes)
+	}
+
+	cm := s.object("configmaps", "web", "settings")
+	if expected := map[string]interface{}{"color": "green"}; !reflect.DeepEqual(cm["data"], expected) {
+		t.Errorf("expected the data %v, got %v", expected, cm["data"])
+	}
+	if _, ok := cm["metadata"].(map[string]interface{})["labels"]; ok {
+		t.Errorf("expected the configmap of the dump, got %v", cm)
+	}
+}
+
+func TestRestoreInvalidStrategy(t *testing.T) {
+	result := Restore(nil, []map[string]interface{}{newTestObject("ConfigMap", "v1", "web", "settings")}, RestoreOptions{Strategy: "merge"})
+
+	if len(result.Errors) != 1 || result.Created != 0 {
+		t.Errorf("expected an error for the invalid strategy, got %+v", result)
+	}
+}
@@ -0,0 +1,153 @@
+package dump
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"k8s.io/kubernetes/pkg/api/meta"
+	"k8s.io/kubernetes/pkg/runtime"
+)
+
+// summaryFile name of the file with the summary of the dump
+const summaryFile = "_summary.json"
+
+// states of the namespaces in the summary
+const (
+	// NamespaceWritten the namespace was dumped without errors
+	NamespaceWritten = "written"
+	// NamespacePartial only some of the files or types of the namespace were
+	// written (see the errors of the namespace)
+	NamespacePartial = "partial"
+	// NamespaceFailed the dump of the namespace stopped with an error (for
+	// example with --partial-writes=false) and its files were not written
+	// or are incomplete
+	NamespaceFailed = "failed"
+)
+
+// Summary is a machine-readable record of what was dumped
+type Summary struct {
+	// Namespaces namespaces dumped, in alphabetical order
+	Namespaces []NamespaceSummary `json:"namespaces"`
+	// Cluster number of objects of each cluster-scoped type
+	Cluster map[string]int `json:"cluster,omitempty"`
+	// Deleted namespaces deleted during the dump
+	Deleted []string `json:"deleted,omitempty"`
+	// OverBudget namespaces not dumped because the size budget was exceeded
+	OverBudget []string `json:"overBudget,omitempty"`
+	// NotStarted namespaces not dumped because the dump was interrupted
+	NotStarted []string `json:"notStarted,omitempty"`
+	// Errors errors that do not belong to a namespace (including the cluster-scoped types)
+	Errors []string `json:"errors,omitempty"`
+}
+
+// NamespaceSummary is the record of the dump of a namespace
+type NamespaceSummary struct {
+	Name string `json:"name"`
+	// State written, partial or failed
+	State string `json:"state"`
+	// Objects number of objects of each type
+	Objects map[string]int `json:"objects"`
+	// Skipped types excluded because of the number of items
+	Skipped []string `json:"skipped,omitempty"`
+	// NotFound types without objects
+	NotFound []string `json:"notFound,omitempty"`
+	// Forbidden types the user is not allowed to list
+	Forbidden []string `json:"forbidden,omitempty"`
+	// Errors errors found dumping the namespace
+	Errors []string `json:"errors,omitempty"`
+}
+
+// countObjects returns the number of items of a list that are dumped
+// (the items skipped by skipObject are not counted)
+func countObjects(list runtime.Object, opts *dumpOptions) (int, error) {
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return 0, errors.Wrap(err, "unexpected error extracting items")
+	}
+
+	count := 0
+	for _, item := range items {
+		if skipObject(item, opts) {
+			continue
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Summary returns the record of the dump. The namespaces deleted during
+// the dump, skipped by the size budget or not started are not included in Namespaces.
+// The summary is included in the manifest, so it does not contain the
+// durations (they are logged) and two dumps of the same cluster are equal
+func (r *DumpResult) Summary() *Summary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := &Summary{
+		Namespaces: []NamespaceSummary{},
+		Cluster:    r.counts[""],
+		Deleted:    append([]string{}, r.deleted...),
+		OverBudget: append([]string{}, r.overBudget...),
+		NotStarted: append([]string{}, r.notStarted...),
+	}
+	sort.Strings(s.Deleted)
+	sort.Strings(s.OverBudget)
+	sort.Strings(s.NotStarted)
+
+	names := []string{}
+	for _, name := range r.namespaces {
+		if !containsName(name, r.deleted) && !containsName(name, r.overBudget) && !containsName(name, r.notStarted) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	summaries := map[string]*NamespaceSummary{}
+	for _, name := range names {
+		objects := r.counts[name]
+		if objects == nil {
+			objects = map[string]int{}
+		}
+		s.Namespaces = append(s.Namespaces, NamespaceSummary{Name: name, State: r.namespaceState(name), Objects: objects})
+	}
+	for i := range s.Namespaces {
+		summaries[s.Namespaces[i].Name] = &s.Namespaces[i]
+	}
+
+	errs := append([]dumpIssue{}, r.errors...)
+	sort.Stable(byIssue(errs))
+	for _, issue := range errs {
+		if issue.namespace == "" {
+			s.Errors = append(s.Errors, issue.message)
+		} else if ns, ok := summaries[issue.namespace]; ok {
+			ns.Errors = append(ns.Errors, issue.message)
+		}
+	}
+
+	types := func(issues []dumpIssue, add func(ns *NamespaceSummary, objectType string)) {
+		sorted := append([]dumpIssue{}, issues...)
+		sort.Stable(byIssue(sorted))
+		for _, issue := range sorted {
+			if ns, ok := summaries[issue.namespace]; ok {
+				add(ns, issue.objectType)
+			}
+		}
+	}
+	types(r.skipped, func(ns *NamespaceSummary, objectType string) { ns.Skipped = append(ns.Skipped, objectType) })
+	types(r.notFound, func(ns *NamespaceSummary, objectType string) { ns.NotFound = append(ns.NotFound, objectType) })
+	types(r.forbidden, func(ns *NamespaceSummary, objectType string) { ns.Forbidden = append(ns.Forbidden, objectType) })
+
+	return s
+}
+
+// writeSummary writes the summary of the dump to _summary.json
+func writeSummary(r *DumpResult, opts *dumpOptions) error {
+	data, err := json.MarshalIndent(r.Summary(), "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "unexpected error encoding summary")
+	}
+
+	return writeOutput(summaryFile, append(data, '\n'), opts)
+}
@@ -0,0 +1,87 @@
+package dump
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	api "k8s.io/kubernetes/pkg/api/v1"
+)
+
+func TestDumpClusterInterruptedSummary(t *testing.T) {
+	s := newFakeAPIServer()
+	defer s.Close()
+	for _, ns := range []string{"a", "b", "c", "d"} {
+		s.add(t, "namespaces", &api.Namespace{ObjectMeta: api.ObjectMeta{Name: ns}})
+		s.add(t, "configmaps", newTestConfigMap(ns, "settings"))
+	}
+
+	// the dump is interrupted while the namespace b is dumped
+	interrupt := make(chan struct{})
+	var once sync.Once
+	s.handle = func(w http.ResponseWriter, r *http.Request) bool {
+		switch r.URL.Path {
+		case "/api/v1/namespaces/a/services":
+			writeFakeStatus(w, http.StatusInternalServerError, "InternalError", "etcd is unavailable")
+			return true
+		case "/api/v1/namespaces/b/configmaps":
+			once.Do(func() { close(interrupt) })
+		}
+		return false
+	}
+
+	dir, err := ioutil.TempDir("", "dump")
+	if err != nil {
+		t.Fatalf("unexpected error creating a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := newTestOptions(dir)
+	opts.Concurrency = 1
+	opts.IncludeTypes = []string{"configmaps", "services"}
+	opts.Interrupt = interrupt
+	result, err := DumpCluster(s.client(t), opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.Failed() || !strings.Contains(result.Err().Error(), "the cluster") {
+		t.Errorf("expected the interrupted dump to fail, got %v", result.Err())
+	}
+
+	files := readDumpFiles(t, dir)
+	for _, name := range []string{"a.yaml", "b.yaml"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("expected the file %v of a namespace started before the interruption", name)
+		}
+	}
+	for _, name := range []string{"c.yaml", "d.yaml"} {
+		if _, ok := files[name]; ok {
+			t.Errorf("expected no file %v of a namespace not started", name)
+		}
+	}
+
+	var summary Summary
+	err = json.Unmarshal(files[summaryFile], &summary)
+	if err != nil {
+		t.Fatalf("unexpected error decoding the summary: %v", err)
+	}
+
+	states := map[string]string{}
+	for _, ns := range summary.Namespaces {
+		states[ns.Name] = ns.State
+	}
+	if expected := map[string]string{"a": NamespacePartial, "b": NamespaceWritten}; !reflect.DeepEqual(states, expected) {
+		t.Errorf("expected the states %v, got %v", expected, states)
+	}
+	if expected := []string{"c", "d"}; !reflect.DeepEqual(summary.NotStarted, expected) {
+		t.Errorf("expected the namespaces %v not started, got %v", expected, summary.NotStarted)
+	}
+	if len(summary.Errors) != 1 || summary.Errors[0] != "the dump was interrupted, 2 namespaces were not started" {
+		t.Errorf("expected the interruption in the errors of the summary, got %v", summary.Errors)
+	}
+}
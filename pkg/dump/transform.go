@@ -0,0 +1,37 @@
+package dump
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// transformObject pipes the serialized object to the stdin of the command
+// configured in --transform-exec (executed using sh -c) and returns the
+// content written to stdout. The command is killed after the timeout
+func transformObject(s, command string, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdin = strings.NewReader(s)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", errors.Errorf("transform command timed out after %v", timeout)
+	}
+	if err != nil {
+		return "", errors.Wrapf(err, "transform command failed: %v", strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.String(), nil
+}
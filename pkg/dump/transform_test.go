@@ -0,0 +1,75 @@
+package dump
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	api "k8s.io/kubernetes/pkg/api/v1"
+)
+
+// failingTransform is a --transform-exec command that fails for the
+// objects named features and returns the other objects unchanged
+const failingTransform = `input=$(cat); if echo "$input" | grep -q features; then echo cannot transform >&2; exit 1; fi; echo "$input"`
+
+func TestDumpClusterTransformExecFailure(t *testing.T) {
+	s := newFakeAPIServer()
+	defer s.Close()
+	s.add(t, "namespaces", &api.Namespace{ObjectMeta: api.ObjectMeta{Name: "web"}})
+	for _, name := range []string{"settings", "features"} {
+		s.add(t, "configmaps", newTestConfigMap("web", name))
+	}
+
+	tests := []struct {
+		name      string
+		configure func(*Options)
+		// header is false if the files do not contain the errors header
+		header bool
+	}{
+		{name: "yaml", header: true, configure: func(o *Options) {}},
+		{name: "json", configure: func(o *Options) { o.OutputFormat = "json" }},
+		{name: "hash names", header: true, configure: func(o *Options) { o.OutputHashNames = true }},
+		{name: "per object files", header: true, configure: func(o *Options) { o.PerObjectFiles = true }},
+		{name: "gitops", header: true, configure: func(o *Options) { o.GitOpsLayout = true }},
+	}
+
+	for _, test := range tests {
+		dir, err := ioutil.TempDir("", "dump")
+		if err != nil {
+			t.Fatalf("unexpected error creating a temporary directory: %v", err)
+		}
+		defer os.RemoveAll(dir)
+
+		opts := newTestOptions(dir)
+		opts.IncludeTypes = []string{"configmaps"}
+		opts.TransformExec = failingTransform
+		test.configure(&opts)
+
+		result, err := DumpCluster(s.client(t), opts)
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", test.name, err)
+		}
+		if !result.Failed() || !strings.Contains(result.Err().Error(), "namespace web") {
+			t.Errorf("%v: expected the dump to fail in namespace web, got %v", test.name, result.Err())
+		}
+
+		files := readDumpFiles(t, dir)
+		all := ""
+		for _, content := range files {
+			all += string(content)
+		}
+
+		if !strings.Contains(all, "settings") {
+			t.Errorf("%v: expected the object settings in the dump, got\n%v", test.name, all)
+		}
+		if strings.Contains(all, "name: features") || strings.Contains(all, `"name": "features"`) {
+			t.Errorf("%v: expected the object features to be left out of the dump, got\n%v", test.name, all)
+		}
+
+		message := "# unexpected error converting the object features of type configmaps in namespace web: transform command failed: cannot transform"
+		if test.header != strings.Contains(all, message) {
+			t.Errorf("%v: expected the error in the header of the files to be %v, got\n%v", test.name, test.header, all)
+		}
+	}
+}
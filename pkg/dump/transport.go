@@ -0,0 +1,52 @@
+package dump
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
+// WrapTransport is used as the WrapTransport of the client configuration.
+// The request builder of the client does not accept a context, so the
+// timeout of the list and get requests (the timeout parameter set with
+// Timeout) is enforced here, cancelling the request when it expires. The
+// requests without a timeout, like the log streams, are not limited
+func WrapTransport(rt http.RoundTripper) http.RoundTripper {
+	return &timeoutRoundTripper{rt: rt}
+}
+
+// timeoutRoundTripper cancels the requests that are not completed
+// (including the read of the body) before their timeout parameter
+type timeoutRoundTripper struct {
+	rt http.RoundTripper
+}
+
+func (t *timeoutRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	timeout, err := time.ParseDuration(req.URL.Query().Get("timeout"))
+	if err != nil || timeout <= 0 {
+		return t.rt.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	resp, err := t.rt.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelBody releases the context of a request when the body is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
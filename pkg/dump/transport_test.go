@@ -0,0 +1,113 @@
+package dump
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	api "k8s.io/kubernetes/pkg/api/v1"
+)
+
+func TestDumpClusterStuckList(t *testing.T) {
+	s := newTestCluster(t)
+	defer s.Close()
+
+	// the list of the configmaps of web never ends (until the test finishes)
+	release := make(chan struct{})
+	defer close(release)
+	s.handle = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path != "/api/v1/namespaces/web/configmaps" {
+			return false
+		}
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		<-release
+		return true
+	}
+
+	dir, err := ioutil.TempDir("", "dump")
+	if err != nil {
+		t.Fatalf("unexpected error creating a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := newTestOptions(dir)
+	opts.RequestTimeout = 100 * time.Millisecond
+
+	done := make(chan *DumpResult)
+	go func() {
+		result, err := DumpCluster(s.client(t), opts)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		done <- result
+	}()
+
+	var result *DumpResult
+	select {
+	case result = <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("the dump did not finish with a stuck list request")
+	}
+	if result == nil {
+		return
+	}
+
+	msgs := result.messagesFor("web")
+	if result.Err() == nil || len(msgs) != 1 || !strings.Contains(msgs[0], "configmaps") {
+		t.Fatalf("expected an error of the configmaps of web, got %v", msgs)
+	}
+	if msgs := result.messagesFor("other"); len(msgs) != 0 {
+		t.Errorf("expected the namespace other to be dumped, got %v", msgs)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "other.yaml")); err != nil {
+		t.Errorf("expected the file of the namespace other, got %v", err)
+	}
+}
+
+func TestCollectPodLogsWithoutTimeout(t *testing.T) {
+	s := newFakeAPIServer()
+	defer s.Close()
+	s.add(t, "pods", &api.Pod{
+		ObjectMeta: api.ObjectMeta{Name: "slow", Namespace: "web"},
+		Spec:       api.PodSpec{Containers: []api.Container{{Name: "app"}}},
+		Status:     api.PodStatus{Phase: api.PodRunning},
+	})
+	s.handle = func(w http.ResponseWriter, r *http.Request) bool {
+		if !strings.HasSuffix(r.URL.Path, "/pods/slow/log") {
+			return false
+		}
+		// the log is streamed for longer than the timeout of the requests
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("line 1\n"))
+		w.(http.Flusher).Flush()
+		time.Sleep(300 * time.Millisecond)
+		w.Write([]byte("line 2\n"))
+		return true
+	}
+
+	dir, err := ioutil.TempDir("", "dump")
+	if err != nil {
+		t.Fatalf("unexpected error creating a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	options := newTestOptions(dir)
+	options.CollectLogs = true
+	options.RequestTimeout = 100 * time.Millisecond
+	opts := completeTestOptions(t, options)
+
+	err = collectPodLogs(s.client(t), "web", opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "web/logs/slow-app.log"))
+	if err != nil || string(b) != "line 1\nline 2\n" {
+		t.Errorf("expected the whole log of the pod, got %q (%v)", b, err)
+	}
+}
@@ -0,0 +1,131 @@
+package dump
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	autoscaling "k8s.io/kubernetes/pkg/apis/autoscaling/v1"
+	batch "k8s.io/kubernetes/pkg/apis/batch/v1"
+	batchv2alpha1 "k8s.io/kubernetes/pkg/apis/batch/v2alpha1"
+	extensions "k8s.io/kubernetes/pkg/apis/extensions/v1beta1"
+	client "k8s.io/kubernetes/pkg/client/clientset_generated/release_1_5"
+	restclient "k8s.io/kubernetes/pkg/client/restclient"
+	"k8s.io/kubernetes/pkg/runtime"
+)
+
+// typeVersions apiVersions of the types served by different versions
+// depending on the version of the cluster, in order of preference.
+// The first one is used when the served versions are unknown
+var typeVersions = map[string][]string{
+	"horizontalpodautoscalers": {"autoscaling/v1", "extensions/v1beta1"},
+	"jobs":                     {"batch/v1", "batch/v2alpha1"},
+}
+
+// typeLists constructors of the lists of the objects of a type in each of the
+// apiVersions of typeVersions. The client does not convert the objects, so
+// the response must be decoded into the list of the served version
+var typeLists = map[string]map[string]func() runtime.Object{
+	"horizontalpodautoscalers": {
+		"autoscaling/v1":     func() runtime.Object { return &autoscaling.HorizontalPodAutoscalerList{} },
+		"extensions/v1beta1": func() runtime.Object { return &extensions.HorizontalPodAutoscalerList{} },
+	},
+	"jobs": {
+		"batch/v1":       func() runtime.Object { return &batch.JobList{} },
+		"batch/v2alpha1": func() runtime.Object { return &batchv2alpha1.JobList{} },
+	},
+}
+
+// listForVersion returns an empty list of the objects of a type in an
+// apiVersion, or nil if the type is only served by one version
+func listForVersion(objectType, apiVersion string) runtime.Object {
+	if newList, ok := typeLists[objectType][apiVersion]; ok {
+		return newList()
+	}
+	return nil
+}
+
+// versionsFor returns the apiVersions that can be used to list a type, in
+// order of preference
+func versionsFor(objectType string) []string {
+	if versions, ok := typeVersions[objectType]; ok {
+		return versions
+	}
+	return []string{apiVersionFor(objectType)}
+}
+
+// servedAPIVersion returns the preferred apiVersion of a type served by the
+// apiserver, or an empty string if none is served. Without the served
+// versions (discovery was not used) the preferred version is returned
+func servedAPIVersion(objectType string, opts *dumpOptions) string {
+	versions := versionsFor(objectType)
+	if opts == nil || opts.servedVersions == nil {
+		return versions[0]
+	}
+
+	for _, version := range versions {
+		if opts.servedVersions[version] {
+			return version
+		}
+	}
+	return ""
+}
+
+// discoverServedVersions returns the group versions served by the apiserver
+func discoverServedVersions(kubeClient *client.Clientset) (map[string]bool, error) {
+	groups, err := kubeClient.Discovery().ServerGroups()
+	if err != nil {
+		return nil, errors.Wrap(err, "unexpected error obtaining the API groups")
+	}
+
+	served := map[string]bool{}
+	for _, group := range groups.Groups {
+		for _, version := range group.Versions {
+			served[version.GroupVersion] = true
+		}
+	}
+	return served, nil
+}
+
+// unservedTypes returns the types of the mapping for which the apiserver
+// does not serve any of the supported versions
+func unservedTypes(opts *dumpOptions) map[string]bool {
+	unserved := map[string]bool{}
+	for objectType := range newMappingFactoring() {
+		if servedAPIVersion(objectType, opts) != "" {
+			continue
+		}
+
+		unserved[objectType] = true
+		if !skipType(objectType, opts) {
+			opts.log.Warningf("", objectType, "skipping type %v (the apiserver does not serve %v)",
+				objectType, strings.Join(versionsFor(objectType), " or "))
+		}
+	}
+	return unserved
+}
+
+// clientForVersion returns the REST client of a group version
+func clientForVersion(kubeClient *client.Clientset, apiVersion string) (restclient.Interface, error) {
+	switch apiVersion {
+	case "v1":
+		return kubeClient.Core().RESTClient(), nil
+	case "autoscaling/v1":
+		return kubeClient.Autoscaling().RESTClient(), nil
+	case "batch/v1":
+		return kubeClient.BatchV1().RESTClient(), nil
+	case "batch/v2alpha1":
+		return kubeClient.BatchV2alpha1().RESTClient(), nil
+	case "rbac.authorization.k8s.io/v1alpha1":
+		return kubeClient.Rbac().RESTClient(), nil
+	case "apps/v1beta1":
+		return kubeClient.Apps().RESTClient(), nil
+	case "storage.k8s.io/v1beta1":
+		return kubeClient.Storage().RESTClient(), nil
+	case "extensions/v1beta1":
+		return kubeClient.Extensions().RESTClient(), nil
+	default:
+		return nil, fmt.Errorf("unsupported apiVersion %v", apiVersion)
+	}
+}
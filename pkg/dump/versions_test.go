@@ -0,0 +1,96 @@
+package dump
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	api "k8s.io/kubernetes/pkg/api/v1"
+	autoscaling "k8s.io/kubernetes/pkg/apis/autoscaling/v1"
+	batch "k8s.io/kubernetes/pkg/apis/batch/v1"
+)
+
+func TestDumpClusterServedVersions(t *testing.T) {
+	defer func(versions []string) { fakeGroupVersions = versions }(fakeGroupVersions)
+
+	s := newFakeAPIServer()
+	defer s.Close()
+	s.add(t, "namespaces", &api.Namespace{ObjectMeta: api.ObjectMeta{Name: "web"}})
+	s.add(t, "jobs", &batch.Job{ObjectMeta: api.ObjectMeta{Name: "migrate", Namespace: "web"}})
+	s.add(t, "horizontalpodautoscalers", &autoscaling.HorizontalPodAutoscaler{
+		ObjectMeta: api.ObjectMeta{Name: "nginx", Namespace: "web"},
+		Spec:       autoscaling.HorizontalPodAutoscalerSpec{ScaleTargetRef: autoscaling.CrossVersionObjectReference{Kind: "Deployment", Name: "nginx"}},
+	})
+
+	tests := []struct {
+		name     string
+		versions []string
+		// apiVersions expected apiVersion of the jobs and the horizontalpodautoscalers
+		apiVersions []string
+		warnings    []string
+	}{
+		{
+			name:        "the preferred versions",
+			versions:    []string{"autoscaling/v1", "batch/v1", "batch/v2alpha1", "extensions/v1beta1"},
+			apiVersions: []string{"batch/v1", "autoscaling/v1"},
+		},
+		{
+			name:        "the versions of the older clusters",
+			versions:    []string{"batch/v2alpha1", "extensions/v1beta1"},
+			apiVersions: []string{"batch/v2alpha1", "extensions/v1beta1"},
+		},
+		{
+			name:        "no version served",
+			versions:    []string{"storage.k8s.io/v1beta1"},
+			apiVersions: []string{"", ""},
+			warnings: []string{
+				"warning  horizontalpodautoscalers skipping type horizontalpodautoscalers (the apiserver does not serve autoscaling/v1 or extensions/v1beta1)",
+				"warning  jobs skipping type jobs (the apiserver does not serve batch/v1 or batch/v2alpha1)",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		fakeGroupVersions = test.versions
+		s.mu.Lock()
+		s.requests = nil
+		s.mu.Unlock()
+
+		out := new(bytes.Buffer)
+		logger, _ := NewLogger("json", out)
+		files := dumpTestCluster(t, s, func(o *Options) {
+			o.IncludeTypes = []string{"jobs", "horizontalpodautoscalers"}
+			o.Logger = logger
+		})
+
+		web := string(files["web.yaml"])
+		requests := strings.Join(s.received("GET"), "\n")
+		for i, objectType := range []string{"jobs", "horizontalpodautoscalers"} {
+			apiVersion := test.apiVersions[i]
+			if apiVersion == "" {
+				if strings.Contains(requests, "/"+objectType) || strings.Contains(web, "# "+objectType+"\n") {
+					t.Errorf("%v: expected the type %v to be skipped, got\n%v\n%v", test.name, objectType, requests, web)
+				}
+				continue
+			}
+
+			path := "GET /apis/" + apiVersion + "/namespaces/web/" + objectType
+			if !strings.Contains(requests, path+"\n") && !strings.HasSuffix(requests, path) {
+				t.Errorf("%v: expected the request %v, got\n%v", test.name, path, requests)
+			}
+			if !strings.Contains(web, "# "+objectType+"\n---\napiVersion: "+apiVersion+"\n") {
+				t.Errorf("%v: expected the %v with the apiVersion %v, got\n%v", test.name, objectType, apiVersion, web)
+			}
+		}
+
+		messages := strings.Join(logMessages(t, out), "\n")
+		for _, warning := range test.warnings {
+			if !strings.Contains(messages, warning) {
+				t.Errorf("%v: expected the warning %q, got\n%v", test.name, warning, messages)
+			}
+		}
+		if len(test.warnings) == 0 && strings.Contains(messages, "warning  jobs") {
+			t.Errorf("%v: expected no warning about the jobs, got\n%v", test.name, messages)
+		}
+	}
+}
@@ -1,10 +1,12 @@
-package main
+package dump
 
 import (
 	"fmt"
 	"io"
 
 	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"k8s.io/kubernetes/pkg/api/unversioned"
 	"k8s.io/kubernetes/pkg/runtime"
 )
 
@@ -20,7 +22,9 @@ func (p *YAMLPrinter) AfterPrint(w io.Writer, res string) error {
 	return nil
 }
 
-// PrintObj prints the data as YAML.
+// PrintObj prints the data as YAML. When version and converter are set the
+// object is converted to that version first. The apiVersion and kind of the
+// converted object are not printed, they are written by the caller
 func (p *YAMLPrinter) PrintObj(obj runtime.Object, w io.Writer) error {
 	switch obj := obj.(type) {
 	case *runtime.Unknown:
@@ -32,6 +36,19 @@ func (p *YAMLPrinter) PrintObj(obj runtime.Object, w io.Writer) error {
 		return err
 	}
 
+	if p.version != "" && p.converter != nil {
+		gv, err := unversioned.ParseGroupVersion(p.version)
+		if err != nil {
+			return errors.Wrapf(err, "invalid version %v", p.version)
+		}
+
+		obj, err = p.converter.ConvertToVersion(obj, gv)
+		if err != nil {
+			return errors.Wrapf(err, "unexpected error converting object to %v", p.version)
+		}
+		obj.GetObjectKind().SetGroupVersionKind(unversioned.GroupVersionKind{})
+	}
+
 	output, err := yaml.Marshal(obj)
 	if err != nil {
 		return err
@@ -0,0 +1,76 @@
+package dump
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+
+	unversioned_api "k8s.io/kubernetes/pkg/api"
+	internalextensions "k8s.io/kubernetes/pkg/apis/extensions"
+	extensions "k8s.io/kubernetes/pkg/apis/extensions/v1beta1"
+)
+
+// newInternalTestDeployment returns a deployment in the internal version of the API
+func newInternalTestDeployment() *internalextensions.Deployment {
+	return &internalextensions.Deployment{
+		ObjectMeta: unversioned_api.ObjectMeta{Name: "nginx", Namespace: "web"},
+		Spec: internalextensions.DeploymentSpec{
+			Replicas: 3,
+			Template: unversioned_api.PodTemplateSpec{
+				Spec: unversioned_api.PodSpec{
+					// hostNetwork is a field of the pod spec in the external version
+					SecurityContext: &unversioned_api.PodSecurityContext{HostNetwork: true},
+					Containers:      []unversioned_api.Container{{Name: "nginx", Image: "nginx:1.11"}},
+				},
+			},
+		},
+	}
+}
+
+func TestYAMLPrinterConvertToVersion(t *testing.T) {
+	printer := &YAMLPrinter{version: "extensions/v1beta1", converter: unversioned_api.Scheme}
+	buf := new(bytes.Buffer)
+	if err := printer.PrintObj(newInternalTestDeployment(), buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	out := buf.String()
+	if !strings.Contains(out, "\n    spec:\n      containers:\n") || !strings.Contains(out, "\n      hostNetwork: true\n") {
+		t.Errorf("expected the pod spec of the external version, got\n%v", out)
+	}
+	// apiVersion and kind are written by marshalObject
+	if strings.Contains(out, "apiVersion:") || strings.Contains(out, "kind:") {
+		t.Errorf("expected no type information in the output, got\n%v", out)
+	}
+
+	var deployment extensions.Deployment
+	if err := yaml.Unmarshal(buf.Bytes(), &deployment); err != nil {
+		t.Fatalf("unexpected error decoding the output: %v", err)
+	}
+	if deployment.Spec.Replicas == nil || *deployment.Spec.Replicas != 3 || !deployment.Spec.Template.Spec.HostNetwork {
+		t.Errorf("expected the output to round-trip to extensions/v1beta1, got %+v", deployment.Spec)
+	}
+}
+
+func TestYAMLPrinterWithoutVersion(t *testing.T) {
+	for _, printer := range []*YAMLPrinter{{}, {version: "extensions/v1beta1"}, {converter: unversioned_api.Scheme}} {
+		buf := new(bytes.Buffer)
+		if err := printer.PrintObj(newInternalTestDeployment(), buf); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		// the object is printed without conversion
+		if out := buf.String(); !strings.Contains(out, "\n      securityContext:\n        hostNetwork: true\n") {
+			t.Errorf("expected the internal version of the object with %+v, got\n%v", printer, out)
+		}
+	}
+}
+
+func TestYAMLPrinterInvalidVersion(t *testing.T) {
+	printer := &YAMLPrinter{version: "extensions/v1beta1/deployments", converter: unversioned_api.Scheme}
+	err := printer.PrintObj(newInternalTestDeployment(), new(bytes.Buffer))
+	if err == nil || !strings.Contains(err.Error(), "invalid version extensions/v1beta1/deployments") {
+		t.Errorf("expected an invalid version error, got %v", err)
+	}
+}
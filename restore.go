@@ -0,0 +1,129 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/spf13/pflag"
+
+	client "k8s.io/kubernetes/pkg/client/clientset_generated/release_1_5"
+
+	"k8s.io/dump/pkg/dump"
+)
+
+// restoreSkippedFiles names (without extension) of the files of a dump that
+// do not contain objects to restore
+var restoreSkippedFiles = []string{"_audit-secrets", "kustomization", "_nodes"}
+
+// runRestore reads the files of a dump and creates the objects in the cluster
+func runRestore(args []string) {
+	var (
+		flags = pflag.NewFlagSet("restore", pflag.ExitOnError)
+
+		input         = flags.String("input", "", "Directory with the dump files.")
+		apiserverHost = flags.String("apiserver-host", "", "The address of the Kubernetes Apiserver "+
+			"to connect to in the format of protocol://address:port, e.g., http://localhost:8080.")
+		kubeConfigFile        = flags.String("kubeconfig", "", "Path to kubeconfig file with authorization and master location information.")
+		kubeContext           = flags.String("context", "", "Name of the kubeconfig context to use (the current context if not specified).")
+		userAgent             = flags.String("user-agent", fmt.Sprintf("k8s-dump/%v (restore)", version), "User-Agent used in the requests to the apiserver.")
+		insecureSkipTLSVerify = flags.Bool("insecure-skip-tls-verify", false, "Do not verify the certificate of the apiserver. "+
+			"This makes the connection insecure.")
+		certificateAuthority = flags.String("certificate-authority", "", "Path to a certificate file for the certificate authority "+
+			"used to verify the apiserver (replaces the one of the kubeconfig).")
+		token     = flags.String("token", "", "Bearer token used to authenticate with the apiserver (replaces the credentials of the kubeconfig).")
+		tokenFile = flags.String("token-file", "", "File with the bearer token used to authenticate with the apiserver, read again "+
+			"when it changes (e.g. a projected service account token).")
+		dryRun    = flags.Bool("dry-run", false, "Decode the objects and print what would be restored without contacting the apiserver.")
+		overwrite = flags.Bool("overwrite", false, "Update the objects that already exist with the content of the dump instead of "+
+			"skipping them (false skips them). Cannot be used with --restore-strategy.")
+		strategy = flags.String("restore-strategy", "apply", "Strategy used with the objects that already exist: create-only "+
+			"(fail the restore of the object), apply (merge the dump into the object like kubectl apply) or replace "+
+			"(delete and create the object, the namespaces are applied).")
+		dryRunServer = flags.Bool("dry-run-server", false, "Send the objects to the apiserver with dryRun=All and print the objects that "+
+			"would be rejected without creating them (the objects are validated by the client if the apiserver is older than 1.13).")
+		stripImmutable = flags.Bool("strip-immutable", false, "Remove the immutable field of the configmaps and secrets, "+
+			"so the restored objects can be updated (by default the field is preserved). The dumps of this tool never contain "+
+			"the field: it is dropped by the API types of the dump, so only the files edited or created by other tools are affected.")
+	)
+
+	flags.AddGoFlagSet(flag.CommandLine)
+	flags.Parse(args)
+
+	flag.Set("logtostderr", "true")
+
+	if *input == "" {
+		glog.Fatalf("the flag --input is required")
+	}
+
+	if *dryRun && *dryRunServer {
+		glog.Fatalf("--dry-run and --dry-run-server cannot be used together")
+	}
+
+	if flags.Changed("overwrite") {
+		if flags.Changed("restore-strategy") {
+			glog.Fatalf("--overwrite and --restore-strategy cannot be used together")
+		}
+		// the objects that already exist are updated or skipped
+		*strategy = ""
+	}
+
+	objects, err := loadDump(*input, skipFileNames(restoreSkippedFiles))
+	if err != nil {
+		glog.Fatalf("unexpected error reading the dump: %v", err)
+	}
+
+	var kubeClient *client.Clientset
+	if !*dryRun {
+		err = validateContext(*kubeConfigFile, *kubeContext)
+		if err != nil {
+			glog.Fatalf("%v", err)
+		}
+
+		kubeClient, err = createApiserverClient(apiserverConfig{
+			host:        *apiserverHost,
+			kubeConfig:  *kubeConfigFile,
+			kubeContext: *kubeContext,
+			userAgent:   *userAgent,
+			qps:         defaultQPS,
+			burst:       defaultBurst,
+			timeout:     defaultTimeout,
+			insecure:    *insecureSkipTLSVerify,
+			caFile:      *certificateAuthority,
+			token:       *token,
+			tokenFile:   *tokenFile,
+		})
+		if err != nil {
+			handleFatalInitError(err)
+		}
+	}
+
+	glog.Infof("Restoring %v objects...", len(objects))
+	result := dump.Restore(kubeClient, objects, dump.RestoreOptions{
+		DryRun:         *dryRun,
+		Overwrite:      *overwrite,
+		Strategy:       *strategy,
+		DryRunServer:   *dryRunServer,
+		StripImmutable: *stripImmutable,
+	})
+
+	if len(result.Immutable) > 0 {
+		state := "preserved"
+		if *stripImmutable {
+			state = "removed"
+		}
+		glog.Infof("%v immutable objects (the field was %v): %v", len(result.Immutable), state, strings.Join(result.Immutable, ", "))
+	}
+
+	if *dryRunServer {
+		glog.Infof("validated %v objects, skipped %v (%v rejected)", result.Created, result.Skipped, len(result.Errors))
+	} else {
+		glog.Infof("created %v objects, updated %v, skipped %v (%v errors)",
+			result.Created, result.Updated, result.Skipped, len(result.Errors))
+	}
+	if result.Failed() {
+		os.Exit(1)
+	}
+}
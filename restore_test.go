@@ -0,0 +1,63 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// writeDumpTestFiles writes the files of a dump in a new directory (the
+// caller must remove it)
+func writeDumpTestFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "dump")
+	if err != nil {
+		t.Fatalf("unexpected error creating a temporary directory: %v", err)
+	}
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err == nil {
+			err = ioutil.WriteFile(path, []byte(content), 0644)
+		}
+		if err != nil {
+			t.Fatalf("unexpected error writing %v: %v", name, err)
+		}
+	}
+	return dir
+}
+
+// objectNames returns the kind and name of the objects, sorted
+func objectNames(objects []map[string]interface{}) []string {
+	names := []string{}
+	for _, obj := range objects {
+		metadata, _ := obj["metadata"].(map[string]interface{})
+		names = append(names, obj["kind"].(string)+"/"+metadata["name"].(string))
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestLoadDumpRestoreSkippedFiles(t *testing.T) {
+	dir := writeDumpTestFiles(t, map[string]string{
+		// the file of the namespace named nodes
+		"nodes.yaml":             "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: nodes\n",
+		"_nodes.yaml":            "# nodes\napiVersion: v1\nkind: Node\nmetadata:\n  name: node-1\n",
+		"web/kustomization.yaml": "resources:\n- namespace.yaml\n",
+		"web/namespace.yaml":     "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: web\n",
+	})
+	defer os.RemoveAll(dir)
+
+	objects, err := loadDump(dir, skipFileNames(restoreSkippedFiles))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{"Namespace/nodes", "Namespace/web"}
+	if names := objectNames(objects); strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected the objects %v, got %v", expected, names)
+	}
+}
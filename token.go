@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"k8s.io/kubernetes/pkg/client/restclient"
+)
+
+// serviceAccountCAFile certificate authority of the cluster mounted in the pods
+const serviceAccountCAFile = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+
+// tokenFileCheckInterval minimum time between the checks of the modification time of the token file
+const tokenFileCheckInterval = 10 * time.Second
+
+// tokenFileRoundTripper sets the bearer token read from a file in each
+// request. The file is read again when it is modified, so the rotated
+// tokens (like the projected service account tokens) are used
+type tokenFileRoundTripper struct {
+	path string
+	rt   http.RoundTripper
+
+	mu      sync.Mutex
+	token   string
+	modTime time.Time
+	checked time.Time
+}
+
+// newTokenFileRoundTripper reads the token file, returning an error if the
+// file cannot be read or is empty
+func newTokenFileRoundTripper(path string) (*tokenFileRoundTripper, error) {
+	t := &tokenFileRoundTripper{path: path}
+	_, err := t.currentToken()
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// wrap is used as the WrapTransport of the client configuration
+func (t *tokenFileRoundTripper) wrap(rt http.RoundTripper) http.RoundTripper {
+	t.rt = rt
+	return t
+}
+
+func (t *tokenFileRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.currentToken()
+	if err != nil {
+		return nil, err
+	}
+
+	// the request must not be modified
+	r := new(http.Request)
+	*r = *req
+	r.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		r.Header[k] = append([]string(nil), v...)
+	}
+	r.Header.Set("Authorization", fmt.Sprintf("Bearer %v", token))
+
+	return t.rt.RoundTrip(r)
+}
+
+// currentToken returns the token of the file, reading the file again if
+// it was modified since the last read
+func (t *tokenFileRoundTripper) currentToken() (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.token != "" && time.Since(t.checked) < tokenFileCheckInterval {
+		return t.token, nil
+	}
+	t.checked = time.Now()
+
+	info, err := os.Stat(t.path)
+	if err != nil {
+		if t.token != "" {
+			// keep the last token if the file is being replaced
+			return t.token, nil
+		}
+		return "", errors.Wrapf(err, "unexpected error reading the token file %v", t.path)
+	}
+
+	if t.token != "" && info.ModTime().Equal(t.modTime) {
+		return t.token, nil
+	}
+
+	content, err := ioutil.ReadFile(t.path)
+	if err != nil {
+		if t.token != "" {
+			return t.token, nil
+		}
+		return "", errors.Wrapf(err, "unexpected error reading the token file %v", t.path)
+	}
+
+	token := string(bytes.TrimSpace(content))
+	if token == "" {
+		if t.token != "" {
+			return t.token, nil
+		}
+		return "", fmt.Errorf("the token file %v is empty", t.path)
+	}
+
+	t.token = token
+	t.modTime = info.ModTime()
+	return t.token, nil
+}
+
+// serviceHostConfig returns the configuration to connect to the apiserver
+// of the cluster running the pod using the environment variables
+// KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT (without credentials).
+// The certificate authority of the service account is used if it is mounted
+func serviceHostConfig() (*restclient.Config, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("unable to locate the apiserver, use --apiserver-host or --kubeconfig " +
+			"(KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not defined)")
+	}
+
+	cfg := &restclient.Config{Host: "https://" + net.JoinHostPort(host, port)}
+	if _, err := os.Stat(serviceAccountCAFile); err == nil {
+		cfg.TLSClientConfig.CAFile = serviceAccountCAFile
+	}
+	return cfg, nil
+}
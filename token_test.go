@@ -0,0 +1,106 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateApiserverClientToken(t *testing.T) {
+	s := newClientTestServer(false)
+	defer s.Close()
+
+	tokenFile := writeTestFile(t, []byte("token-from-file\n"))
+	defer os.Remove(tokenFile)
+	emptyFile := writeTestFile(t, []byte("\n"))
+	defer os.Remove(emptyFile)
+
+	tests := []struct {
+		name     string
+		config   apiserverConfig
+		expected string
+		err      string
+	}{
+		{name: "--token", config: apiserverConfig{token: "token-value"}, expected: "Bearer token-value"},
+		{name: "--token-file", config: apiserverConfig{tokenFile: tokenFile}, expected: "Bearer token-from-file"},
+		{name: "--token and --token-file", config: apiserverConfig{token: "token-value", tokenFile: tokenFile},
+			err: "--token and --token-file cannot be used together"},
+		{name: "missing token file", config: apiserverConfig{tokenFile: tokenFile + ".missing"},
+			err: "unexpected error reading the token file"},
+		{name: "empty token file", config: apiserverConfig{tokenFile: emptyFile}, err: "is empty"},
+	}
+
+	for _, test := range tests {
+		test.config.host, test.config.qps, test.config.burst = s.URL, 5, 10
+		err := listNamespaces(test.config)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%v: expected the error %q, got %v", test.name, test.err, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", test.name, err)
+			continue
+		}
+		if auth := s.lastHeader("Authorization"); auth != test.expected {
+			t.Errorf("%v: expected the Authorization header %q, got %q", test.name, test.expected, auth)
+		}
+	}
+}
+
+func TestTokenFileRoundTripperRotation(t *testing.T) {
+	path := writeTestFile(t, []byte("first"))
+	defer os.Remove(path)
+
+	rt, err := newTokenFileRoundTripper(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the file is not checked again before tokenFileCheckInterval
+	if err := ioutil.WriteFile(path, []byte("second"), 0600); err != nil {
+		t.Fatalf("unexpected error writing the token: %v", err)
+	}
+	modTime := time.Now().Add(time.Minute)
+	os.Chtimes(path, modTime, modTime)
+	if token, _ := rt.currentToken(); token != "first" {
+		t.Errorf("expected the token read before the check interval, got %q", token)
+	}
+
+	rt.checked = time.Time{}
+	if token, _ := rt.currentToken(); token != "second" {
+		t.Errorf("expected the rotated token, got %q", token)
+	}
+
+	// the last token is kept while the file is replaced
+	os.Remove(path)
+	rt.checked = time.Time{}
+	if token, err := rt.currentToken(); token != "second" || err != nil {
+		t.Errorf("expected the last token without the file, got %q %v", token, err)
+	}
+}
+
+func TestServiceHostConfig(t *testing.T) {
+	for _, name := range []string{"KUBERNETES_SERVICE_HOST", "KUBERNETES_SERVICE_PORT"} {
+		defer os.Setenv(name, os.Getenv(name))
+	}
+
+	os.Setenv("KUBERNETES_SERVICE_HOST", "")
+	if _, err := serviceHostConfig(); err == nil || !strings.Contains(err.Error(), "unable to locate the apiserver") {
+		t.Errorf("expected an error without KUBERNETES_SERVICE_HOST, got %v", err)
+	}
+
+	os.Setenv("KUBERNETES_SERVICE_HOST", "fd00::1")
+	os.Setenv("KUBERNETES_SERVICE_PORT", "443")
+	cfg, err := serviceHostConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Host != "https://[fd00::1]:443" || cfg.BearerToken != "" {
+		t.Errorf("expected the host of the service without credentials, got %+v", cfg)
+	}
+}